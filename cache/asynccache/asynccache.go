@@ -39,6 +39,13 @@ type Options struct {
 
 	IsSame     func(key string, oldData, newData interface{}) bool
 	ErrLogFunc func(str string)
+
+	// Codec encodes values in snapshots, GobCodec by default.
+	Codec Codec
+	// If SnapshotFile is set, the cache is restored from it on creation and
+	// persisted to it every SnapshotInterval (1 minute by default) and on Close.
+	SnapshotFile     string
+	SnapshotInterval time.Duration
 }
 
 // AsyncCache .
@@ -74,6 +81,10 @@ type asyncCache struct {
 	sfg  sf.Group
 	opt  Options
 	data sync.Map
+
+	snapshotStop chan struct{}
+	snapshotDone chan struct{}
+	snapshotOnce sync.Once
 }
 
 type tickerType int
@@ -154,6 +165,13 @@ func NewAsyncCache(opt Options) AsyncCache {
 		go rt.tick(rt.ticker, refreshTicker)
 	}
 	rt.Unlock()
+
+	if c.opt.Codec == nil {
+		c.opt.Codec = GobCodec()
+	}
+	if c.opt.SnapshotFile != "" {
+		c.startSnapshot()
+	}
 	return c
 }
 
@@ -250,6 +268,10 @@ func (c *asyncCache) DeleteIf(shouldDelete func(key string) bool) {
 
 // Close stops the background goroutine.
 func (c *asyncCache) Close() {
+	if c.opt.SnapshotFile != "" {
+		c.stopSnapshot()
+	}
+
 	// close refresh ticker
 	ti, _ := refreshTickerMap.Load(c.opt.RefreshDuration)
 	rt := ti.(*sharedTicker)
@@ -0,0 +1,283 @@
+package asynccache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A snapshot is laid out as:
+//
+//	magic "ACSN" | version uint8 | codec name (uvarint length + bytes) |
+//	entry count uvarint | entries (key, value as uvarint length + bytes) |
+//	crc32 (IEEE, big endian) of all the preceding bytes
+const (
+	snapshotMagic   = "ACSN"
+	snapshotVersion = 1
+
+	defaultSnapshotInterval = time.Minute
+)
+
+var (
+	// ErrInvalidSnapshot is returned by Restore when the snapshot is malformed or corrupted.
+	ErrInvalidSnapshot = errors.New("asynccache: invalid snapshot")
+)
+
+// Snapshotter saves and loads the entries of a cache, the AsyncCache created
+// by NewAsyncCache implements it:
+//
+//	err := c.(asynccache.Snapshotter).Snapshot(w)
+type Snapshotter interface {
+	// Snapshot writes all cache entries to w, values are encoded with Options.Codec.
+	Snapshot(w io.Writer) error
+
+	// Restore sets the entries of a snapshot written by Snapshot with SetDefault,
+	// so the existing entries are kept.
+	Restore(r io.Reader) error
+}
+
+// Codec encodes the values of snapshots.
+type Codec interface {
+	// Name identifies the codec in snapshots, a snapshot can only be restored with the same codec.
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+type jsonCodec[T any] struct{}
+
+// JSONCodec returns a codec encoding values of type T in json, restored values are of type T.
+func JSONCodec[T any]() Codec {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Name() string { return "json" }
+
+func (jsonCodec[T]) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte) (interface{}, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type gobCodec struct{}
+
+// GobCodec returns a codec encoding values in gob with their types, values of
+// types other than the builtin ones must be registered with gob.Register.
+func GobCodec() Codec {
+	return gobCodec{}
+}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Snapshot writes all cache entries to w, entries without a value are skipped.
+func (c *asyncCache) Snapshot(w io.Writer) error {
+	data := c.Dump()
+	keys := make([]string, 0, len(data))
+	for k, v := range data {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(w)
+	mw := io.MultiWriter(bw, crc)
+	var buf [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		n := binary.PutUvarint(buf[:], uint64(len(b)))
+		mw.Write(buf[:n])
+		mw.Write(b)
+	}
+
+	io.WriteString(mw, snapshotMagic)
+	mw.Write([]byte{snapshotVersion})
+	writeBytes([]byte(c.opt.Codec.Name()))
+	n := binary.PutUvarint(buf[:], uint64(len(keys)))
+	mw.Write(buf[:n])
+	for _, k := range keys {
+		v, err := c.opt.Codec.Marshal(data[k])
+		if err != nil {
+			return fmt.Errorf("asynccache: marshal key(%s) err(%w)", k, err)
+		}
+		writeBytes([]byte(k))
+		writeBytes(v)
+	}
+	binary.Write(bw, binary.BigEndian, crc.Sum32())
+	return bw.Flush()
+}
+
+// Restore sets the entries of a snapshot with SetDefault, it checks the whole
+// snapshot before setting any entry.
+func (c *asyncCache) Restore(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(snapshotMagic)+1+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+	if v := body[len(snapshotMagic)]; v != snapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, v)
+	}
+
+	br := bytes.NewReader(body[len(snapshotMagic)+1:])
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil || n > uint64(br.Len()) {
+			return nil, ErrInvalidSnapshot
+		}
+		b := make([]byte, n)
+		br.Read(b)
+		return b, nil
+	}
+
+	name, err := readBytes()
+	if err != nil {
+		return err
+	}
+	if string(name) != c.opt.Codec.Name() {
+		return fmt.Errorf("asynccache: snapshot codec %q, want %q", name, c.opt.Codec.Name())
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrInvalidSnapshot
+	}
+
+	entries := make(map[string]interface{})
+	for i := uint64(0); i < count; i++ {
+		k, err := readBytes()
+		if err != nil {
+			return err
+		}
+		b, err := readBytes()
+		if err != nil {
+			return err
+		}
+		v, err := c.opt.Codec.Unmarshal(b)
+		if err != nil {
+			return fmt.Errorf("asynccache: unmarshal key(%s) err(%w)", k, err)
+		}
+		entries[string(k)] = v
+	}
+	if br.Len() != 0 {
+		return ErrInvalidSnapshot
+	}
+
+	for k, v := range entries {
+		c.SetDefault(k, v)
+	}
+	return nil
+}
+
+func (c *asyncCache) startSnapshot() {
+	if err := c.restoreFile(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: restore %s err(%v)", c.opt.SnapshotFile, err))
+	}
+
+	interval := c.opt.SnapshotInterval
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	c.snapshotStop = make(chan struct{})
+	c.snapshotDone = make(chan struct{})
+	go func() {
+		defer close(c.snapshotDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.persist()
+			case <-c.snapshotStop:
+				c.persist()
+				return
+			}
+		}
+	}()
+}
+
+func (c *asyncCache) stopSnapshot() {
+	c.snapshotOnce.Do(func() {
+		close(c.snapshotStop)
+		<-c.snapshotDone
+	})
+}
+
+func (c *asyncCache) restoreFile() error {
+	f, err := os.Open(c.opt.SnapshotFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Restore(f)
+}
+
+// persist writes a snapshot to a temporary file and renames it, so the
+// snapshot file is never partially written.
+func (c *asyncCache) persist() {
+	if err := c.writeFile(); err != nil {
+		c.opt.ErrLogFunc(fmt.Sprintf("asynccache: persist %s err(%v)", c.opt.SnapshotFile, err))
+	}
+}
+
+func (c *asyncCache) writeFile() error {
+	dir, name := filepath.Split(c.opt.SnapshotFile)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := c.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.opt.SnapshotFile)
+}
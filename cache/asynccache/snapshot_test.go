@@ -0,0 +1,83 @@
+package asynccache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshotValue struct {
+	Name string
+	N    int
+}
+
+func newSnapshotCache(opt Options) AsyncCache {
+	opt.RefreshDuration = time.Hour
+	opt.Fetcher = func(key string) (interface{}, error) {
+		return nil, errors.New("no fetch")
+	}
+	return NewAsyncCache(opt)
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	opt := Options{Codec: JSONCodec[snapshotValue]()}
+	c := newSnapshotCache(opt)
+	defer c.Close()
+	c.SetDefault("a", snapshotValue{"a", 1})
+	c.SetDefault("b", snapshotValue{"b", 2})
+	c.Get("failed")
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.(Snapshotter).Snapshot(&buf))
+
+	c2 := newSnapshotCache(opt)
+	defer c2.Close()
+	c2.SetDefault("a", snapshotValue{"newer", 3})
+	assert.NoError(t, c2.(Snapshotter).Restore(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, map[string]interface{}{
+		"a": snapshotValue{"newer", 3},
+		"b": snapshotValue{"b", 2},
+	}, c2.Dump())
+
+	// a corrupted snapshot is rejected as a whole
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	c3 := newSnapshotCache(opt)
+	defer c3.Close()
+	assert.ErrorIs(t, c3.(Snapshotter).Restore(bytes.NewReader(data)), ErrInvalidSnapshot)
+	assert.Len(t, c3.Dump(), 0)
+	assert.ErrorIs(t, c3.(Snapshotter).Restore(bytes.NewReader([]byte("ACSN"))), ErrInvalidSnapshot)
+
+	// the codec must match
+	c4 := newSnapshotCache(Options{})
+	defer c4.Close()
+	data[len(data)/2] ^= 0xff
+	assert.Error(t, c4.(Snapshotter).Restore(bytes.NewReader(data)))
+}
+
+func TestSnapshotFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.snapshot")
+	opt := Options{SnapshotFile: file, SnapshotInterval: 20 * time.Millisecond}
+
+	c := newSnapshotCache(opt)
+	c.SetDefault("a", "1")
+	c.SetDefault("b", 2)
+	c.Close()
+
+	c2 := newSnapshotCache(opt)
+	assert.Equal(t, map[string]interface{}{"a": "1", "b": 2}, c2.Dump())
+
+	// persisted periodically
+	c2.SetDefault("c", 3.5)
+	time.Sleep(50 * time.Millisecond)
+	c3 := newSnapshotCache(Options{SnapshotFile: file})
+	defer c3.Close()
+	assert.Equal(t, 3.5, c3.Dump()["c"])
+	c2.Close()
+	// closing twice does not stop the snapshots again
+	c2.Close()
+}
@@ -0,0 +1,421 @@
+package asynccache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aaabigfish/gopkg/gopool"
+)
+
+const (
+	defaultRefreshInterval    = time.Minute
+	defaultFetchTimeout       = 10 * time.Second
+	defaultRefreshConcurrency = 16
+	maxTickInterval           = time.Second
+)
+
+// Fetcher fetches the latest value of key.
+type Fetcher[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Config controls the behavior of a Cache, zero fields use the defaults.
+type Config[K comparable, V any] struct {
+	// Fetcher fetches the values, it is required.
+	Fetcher Fetcher[K, V]
+
+	// RefreshInterval is the interval between two refreshes of a key, 1 minute by default.
+	RefreshInterval time.Duration
+	// RefreshIntervalOf overrides RefreshInterval for some keys, it is called
+	// when a key is added and should return 0 to use RefreshInterval.
+	RefreshIntervalOf func(key K) time.Duration
+	// FetchTimeout is the timeout of fetches and background refreshes, 10s by default.
+	FetchTimeout time.Duration
+	// RefreshConcurrency is the max number of concurrent refreshes, 16 by default.
+	RefreshConcurrency int32
+
+	// MaxStaleness is how long a value is still served after it should have
+	// been refreshed when the refreshes fail. 0 serves it forever, negative
+	// returns the refresh error at once.
+	MaxStaleness time.Duration
+	// ExpireAfter deletes the keys not read for that long, 0 never deletes them.
+	ExpireAfter time.Duration
+
+	// OnError is called when a refresh fails.
+	OnError func(key K, err error)
+	// OnDelete is called when a key expires.
+	OnDelete func(key K, val V)
+}
+
+func (c Config[K, V]) withDefaults() Config[K, V] {
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = defaultRefreshInterval
+	}
+	if c.FetchTimeout <= 0 {
+		c.FetchTimeout = defaultFetchTimeout
+	}
+	if c.RefreshConcurrency <= 0 {
+		c.RefreshConcurrency = defaultRefreshConcurrency
+	}
+	return c
+}
+
+// Stats is the statistics of a Cache.
+type Stats struct {
+	// Hits is the number of reads served from the cache, including StaleHits.
+	Hits uint64
+	// StaleHits is the number of reads served with a value whose refresh failed.
+	StaleHits uint64
+	// Misses is the number of reads fetching the value.
+	Misses uint64
+	// Refreshes is the number of background refreshes.
+	Refreshes uint64
+	// RefreshErrors is the number of failed background refreshes.
+	RefreshErrors uint64
+	// Expirations is the number of keys deleted for not being read.
+	Expirations uint64
+}
+
+// fetchCall is a fetch on the first read of a key shared by the concurrent reads.
+type fetchCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+type typedEntry[V any] struct {
+	mu         sync.Mutex
+	val        V
+	hasVal     bool
+	err        error
+	updatedAt  time.Time
+	interval   time.Duration
+	next       time.Time
+	accessed   int64
+	refreshing int32
+}
+
+// Cache fetches the values of keys on their first read and keeps them up to
+// date in background, reads never wait for a refresh. It is safe for
+// concurrent use.
+type Cache[K comparable, V any] struct {
+	cfg  Config[K, V]
+	pool gopool.Pool
+
+	mu    sync.RWMutex
+	data  map[K]*typedEntry[V]
+	calls map[K]*fetchCall[V]
+
+	stats Stats
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// New creates a Cache and starts refreshing in background, call Close to stop it.
+func New[K comparable, V any](cfg Config[K, V]) *Cache[K, V] {
+	if cfg.Fetcher == nil {
+		panic("asynccache: nil Fetcher")
+	}
+	cfg = cfg.withDefaults()
+
+	c := &Cache[K, V]{
+		cfg:   cfg,
+		pool:  gopool.NewPool("asynccache", cfg.RefreshConcurrency, gopool.NewConfig()),
+		data:  make(map[K]*typedEntry[V]),
+		calls: make(map[K]*fetchCall[V]),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+// Get returns the value of key. On the first read of a key it fetches the
+// value with the values of ctx, concurrent reads share one fetch and wait for
+// it until their ctx is done. The fetch is not cancelled with ctx, it is bounded
+// by FetchTimeout. A failed fetch is not cached, the next read fetches again.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if e := c.load(key); e != nil {
+		return c.read(e)
+	}
+
+	c.mu.Lock()
+	if e, ok := c.data[key]; ok {
+		c.mu.Unlock()
+		return c.read(e)
+	}
+	atomic.AddUint64(&c.stats.Misses, 1)
+	call, ok := c.calls[key]
+	if !ok {
+		call = &fetchCall[V]{done: make(chan struct{})}
+		c.calls[key] = call
+		c.mu.Unlock()
+		go c.fetch(ctx, key, call)
+	} else {
+		c.mu.Unlock()
+	}
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// fetch runs call for the first read of key and stores the value if it succeeds.
+// The reads sharing call may give up, so it does not use the cancellation of ctx.
+func (c *Cache[K, V]) fetch(ctx context.Context, key K, call *fetchCall[V]) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, c.cfg.FetchTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("asynccache: fetch key(%v) panic: %v", key, r)
+		}
+		c.mu.Lock()
+		if call.err == nil {
+			e := c.newEntry(key)
+			e.store(call.val, nil)
+			c.data[key] = e
+		}
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = c.cfg.Fetcher(ctx, key)
+}
+
+// detachedContext keeps the values of a context without its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// GetOrDefault returns the value of key, or def if it can not be fetched.
+func (c *Cache[K, V]) GetOrDefault(ctx context.Context, key K, def V) V {
+	v, err := c.Get(ctx, key)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Set sets the value of key, it is refreshed in background afterwards.
+func (c *Cache[K, V]) Set(key K, val V) {
+	e := c.newEntry(key)
+	e.store(val, nil)
+	c.mu.Lock()
+	c.data[key] = e
+	c.mu.Unlock()
+}
+
+// SetDefault sets the value of key if it is new to the cache, it is useful for warming up.
+func (c *Cache[K, V]) SetDefault(key K, val V) (exist bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.data[key]; ok {
+		e.touch()
+		return true
+	}
+	e := c.newEntry(key)
+	e.store(val, nil)
+	c.data[key] = e
+	return false
+}
+
+// Delete deletes key.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	delete(c.data, key)
+	c.mu.Unlock()
+}
+
+// Dump returns the values of all keys, keys without a value are skipped.
+// It does not count as a read for expiration.
+func (c *Cache[K, V]) Dump() map[K]V {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := make(map[K]V, len(c.data))
+	for k, e := range c.data {
+		e.mu.Lock()
+		if e.hasVal {
+			m[k] = e.val
+		}
+		e.mu.Unlock()
+	}
+	return m
+}
+
+// Len returns the number of keys.
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.data)
+}
+
+// Stats returns the statistics since the cache was created.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:          atomic.LoadUint64(&c.stats.Hits),
+		StaleHits:     atomic.LoadUint64(&c.stats.StaleHits),
+		Misses:        atomic.LoadUint64(&c.stats.Misses),
+		Refreshes:     atomic.LoadUint64(&c.stats.Refreshes),
+		RefreshErrors: atomic.LoadUint64(&c.stats.RefreshErrors),
+		Expirations:   atomic.LoadUint64(&c.stats.Expirations),
+	}
+}
+
+// Close stops refreshing, the running refreshes are not waited.
+func (c *Cache[K, V]) Close() {
+	select {
+	case <-c.stop:
+		return
+	default:
+		close(c.stop)
+	}
+	<-c.done
+}
+
+func (c *Cache[K, V]) load(key K) *typedEntry[V] {
+	c.mu.RLock()
+	e := c.data[key]
+	c.mu.RUnlock()
+	return e
+}
+
+func (c *Cache[K, V]) newEntry(key K) *typedEntry[V] {
+	interval := c.cfg.RefreshInterval
+	if c.cfg.RefreshIntervalOf != nil {
+		if d := c.cfg.RefreshIntervalOf(key); d > 0 {
+			interval = d
+		}
+	}
+	e := &typedEntry[V]{interval: interval}
+	e.next = time.Now().Add(interval)
+	e.touch()
+	return e
+}
+
+func (c *Cache[K, V]) read(e *typedEntry[V]) (V, error) {
+	e.touch()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	atomic.AddUint64(&c.stats.Hits, 1)
+	var zero V
+	if !e.hasVal {
+		return zero, e.err
+	}
+	if e.err == nil {
+		return e.val, nil
+	}
+	// the refresh failed, serve the stale value unless it is too old
+	if c.cfg.MaxStaleness < 0 ||
+		(c.cfg.MaxStaleness > 0 && time.Since(e.updatedAt) > e.interval+c.cfg.MaxStaleness) {
+		return zero, e.err
+	}
+	atomic.AddUint64(&c.stats.StaleHits, 1)
+	return e.val, nil
+}
+
+func (c *Cache[K, V]) loop() {
+	defer close(c.done)
+
+	tick := c.cfg.RefreshInterval
+	if tick > maxTickInterval {
+		tick = maxTickInterval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.scan()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// scan deletes the expired keys and schedules the due refreshes.
+func (c *Cache[K, V]) scan() {
+	now := time.Now()
+	type kv struct {
+		key K
+		e   *typedEntry[V]
+	}
+	var due, expired []kv
+
+	c.mu.Lock()
+	for k, e := range c.data {
+		if c.cfg.ExpireAfter > 0 && now.UnixNano()-atomic.LoadInt64(&e.accessed) > int64(c.cfg.ExpireAfter) {
+			delete(c.data, k)
+			expired = append(expired, kv{k, e})
+			continue
+		}
+		e.mu.Lock()
+		if !now.Before(e.next) && atomic.CompareAndSwapInt32(&e.refreshing, 0, 1) {
+			due = append(due, kv{k, e})
+		}
+		e.mu.Unlock()
+	}
+	c.mu.Unlock()
+
+	for _, x := range expired {
+		atomic.AddUint64(&c.stats.Expirations, 1)
+		if c.cfg.OnDelete != nil {
+			x.e.mu.Lock()
+			val := x.e.val
+			x.e.mu.Unlock()
+			c.cfg.OnDelete(x.key, val)
+		}
+	}
+	for _, x := range due {
+		key, e := x.key, x.e
+		c.pool.Go(func() { c.refresh(key, e) })
+	}
+}
+
+func (c *Cache[K, V]) refresh(key K, e *typedEntry[V]) {
+	defer atomic.StoreInt32(&e.refreshing, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.FetchTimeout)
+	val, err := c.cfg.Fetcher(ctx, key)
+	cancel()
+
+	atomic.AddUint64(&c.stats.Refreshes, 1)
+	if err != nil {
+		atomic.AddUint64(&c.stats.RefreshErrors, 1)
+		if c.cfg.OnError != nil {
+			c.cfg.OnError(key, err)
+		}
+	}
+	e.mu.Lock()
+	if err != nil {
+		e.err = err
+	} else {
+		e.val, e.hasVal, e.err, e.updatedAt = val, true, nil, time.Now()
+	}
+	e.next = time.Now().Add(e.interval)
+	e.mu.Unlock()
+}
+
+func (e *typedEntry[V]) store(val V, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.err = err
+	if err == nil {
+		e.val, e.hasVal, e.updatedAt = val, true, time.Now()
+	}
+}
+
+func (e *typedEntry[V]) touch() {
+	atomic.StoreInt64(&e.accessed, time.Now().UnixNano())
+}
@@ -0,0 +1,243 @@
+package asynccache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheGet(t *testing.T) {
+	var fetches, version int32
+	c := New(Config[string, int]{
+		RefreshInterval: 50 * time.Millisecond,
+		Fetcher: func(ctx context.Context, key string) (int, error) {
+			atomic.AddInt32(&fetches, 1)
+			time.Sleep(10 * time.Millisecond)
+			return int(atomic.LoadInt32(&version)), nil
+		},
+	})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.Get(context.Background(), "a")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, v)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	atomic.StoreInt32(&version, 1)
+	assert.Eventually(t, func() bool {
+		v, _ := c.Get(context.Background(), "a")
+		return v == 1
+	}, time.Second, 10*time.Millisecond)
+
+	st := c.Stats()
+	assert.True(t, st.Misses >= 1)
+	assert.True(t, st.Hits+st.Misses >= 11)
+	assert.True(t, st.Refreshes > 0)
+	assert.Equal(t, map[string]int{"a": 1}, c.Dump())
+	assert.Equal(t, 1, c.GetOrDefault(context.Background(), "a", 2))
+}
+
+func TestCacheServeStale(t *testing.T) {
+	var fail int32
+	boom := errors.New("boom")
+	cfg := Config[string, string]{
+		RefreshInterval: 20 * time.Millisecond,
+		MaxStaleness:    100 * time.Millisecond,
+		Fetcher: func(ctx context.Context, key string) (string, error) {
+			if atomic.LoadInt32(&fail) == 1 {
+				return "", boom
+			}
+			return "v", nil
+		},
+	}
+	c := New(cfg)
+	defer c.Close()
+
+	v, err := c.Get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", v)
+
+	atomic.StoreInt32(&fail, 1)
+	assert.Eventually(t, func() bool { return c.Stats().RefreshErrors > 0 }, time.Second, 5*time.Millisecond)
+	v, err = c.Get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", v)
+	assert.True(t, c.Stats().StaleHits > 0)
+
+	// too stale
+	assert.Eventually(t, func() bool {
+		_, err := c.Get(context.Background(), "a")
+		return err == boom
+	}, time.Second, 10*time.Millisecond)
+
+	// recovers after a successful refresh
+	atomic.StoreInt32(&fail, 0)
+	assert.Eventually(t, func() bool {
+		_, err := c.Get(context.Background(), "a")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// the error of the first fetch is returned and not cached
+	atomic.StoreInt32(&fail, 1)
+	_, err = c.Get(context.Background(), "b")
+	assert.Equal(t, boom, err)
+	assert.Equal(t, "def", c.GetOrDefault(context.Background(), "b", "def"))
+	assert.Equal(t, 1, c.Len())
+	atomic.StoreInt32(&fail, 0)
+	v, err = c.Get(context.Background(), "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "v", v)
+}
+
+func TestCacheFetchPanic(t *testing.T) {
+	var panics int32
+	c := New(Config[string, int]{
+		Fetcher: func(ctx context.Context, key string) (int, error) {
+			if atomic.AddInt32(&panics, 1) == 1 {
+				time.Sleep(20 * time.Millisecond)
+				panic("boom")
+			}
+			return 1, nil
+		},
+	})
+	defer c.Close()
+
+	// the panic is returned to the shared reads, and the next read fetches again
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Get(context.Background(), "a")
+			assert.ErrorContains(t, err, "panic: boom")
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, c.Len())
+	v, err := c.Get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestCacheWaitContext(t *testing.T) {
+	release := make(chan struct{})
+	c := New(Config[string, int]{
+		Fetcher: func(ctx context.Context, key string) (int, error) {
+			<-release
+			return 1, nil
+		},
+	})
+	defer c.Close()
+
+	go c.Get(context.Background(), "a")
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.calls) == 1
+	}, time.Second, time.Millisecond)
+
+	// a shared read stops waiting when its ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.Get(ctx, "a")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		v, err := c.Get(context.Background(), "a")
+		return err == nil && v == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestCacheLeaderCancel(t *testing.T) {
+	type ctxKey struct{}
+	release := make(chan struct{})
+	c := New(Config[string, int]{
+		FetchTimeout: time.Second,
+		Fetcher: func(ctx context.Context, key string) (int, error) {
+			<-release
+			// the values of the first reader are kept, its cancellation is not
+			if ctx.Value(ctxKey{}) != "v" {
+				return 0, errors.New("no value")
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				return 0, errors.New("no deadline")
+			}
+			return 1, ctx.Err()
+		},
+	})
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, "a")
+		leader <- err
+	}()
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.calls) == 1
+	}, time.Second, time.Millisecond)
+
+	waiter := make(chan int, 1)
+	go func() {
+		v, _ := c.Get(context.Background(), "a")
+		waiter <- v
+	}()
+	cancel()
+	assert.Equal(t, context.Canceled, <-leader)
+	close(release)
+	assert.Equal(t, 1, <-waiter)
+}
+
+func TestCacheIntervalAndExpire(t *testing.T) {
+	var fetches sync.Map
+	var deleted int32
+	c := New(Config[string, int]{
+		RefreshInterval: 20 * time.Millisecond,
+		RefreshIntervalOf: func(key string) time.Duration {
+			if key == "slow" {
+				return time.Hour
+			}
+			return 0
+		},
+		ExpireAfter: 200 * time.Millisecond,
+		OnDelete: func(key string, val int) {
+			atomic.AddInt32(&deleted, 1)
+		},
+		Fetcher: func(ctx context.Context, key string) (int, error) {
+			n, _ := fetches.LoadOrStore(key, new(int32))
+			return int(atomic.AddInt32(n.(*int32), 1)), nil
+		},
+	})
+	defer c.Close()
+
+	c.Get(context.Background(), "fast")
+	c.Get(context.Background(), "slow")
+	assert.True(t, c.SetDefault("fast", 100))
+	assert.False(t, c.SetDefault("warm", 100))
+
+	time.Sleep(100 * time.Millisecond)
+	n, _ := fetches.Load("fast")
+	assert.True(t, atomic.LoadInt32(n.(*int32)) > 1)
+	n, _ = fetches.Load("slow")
+	assert.Equal(t, int32(1), atomic.LoadInt32(n.(*int32)))
+
+	assert.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&deleted))
+	assert.Equal(t, uint64(3), c.Stats().Expirations)
+}
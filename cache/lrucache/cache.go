@@ -0,0 +1,444 @@
+package lrucache
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EvictReason tells why an entry left a Cache.
+type EvictReason int
+
+const (
+	// EvictedCapacity means the entry was the least recently used one when the cache was full.
+	EvictedCapacity EvictReason = iota
+	// EvictedExpired means the ttl of the entry passed.
+	EvictedExpired
+	// EvictedDeleted means the entry was deleted, replaced or purged.
+	EvictedDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictedCapacity:
+		return "capacity"
+	case EvictedExpired:
+		return "expired"
+	case EvictedDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Options configures a Cache.
+type Options[K comparable, V any] struct {
+	// Capacity is the max number of entries, 0 means no limit on the count.
+	Capacity int
+	// MaxBytes is the max total size of entries computed by Sizer, 0 means no limit on the size.
+	MaxBytes int64
+	// Sizer returns the size of an entry in bytes, it is required if MaxBytes is set.
+	Sizer func(key K, val V) int64
+	// TTL is the default ttl of entries, 0 means entries never expire.
+	TTL time.Duration
+	// Shards splits the cache into shards with their own locks to reduce
+	// contention, the limits are divided evenly among them and the LRU order
+	// is kept per shard. It is rounded up to a power of 2, 1 by default.
+	Shards int
+	// Hash hashes keys to shards, keys of string and integer types are hashed
+	// natively, others with fmt.Sprint by default.
+	Hash func(key K) uint64
+	// OnEvict is called after an entry left the cache, outside the lock.
+	OnEvict func(key K, val V, reason EvictReason)
+}
+
+// Stats is the statistics of a Cache.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+// HitRate returns the ratio of hits to lookups, 0 if there is no lookup.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type entry[K comparable, V any] struct {
+	prev, next *entry[K, V]
+	key        K
+	val        V
+	size       int64
+	expireAt   int64
+}
+
+type eviction[K comparable, V any] struct {
+	key    K
+	val    V
+	reason EvictReason
+}
+
+type shard[K comparable, V any] struct {
+	mu       sync.Mutex
+	items    map[K]*entry[K, V]
+	head     *entry[K, V]
+	tail     *entry[K, V]
+	capacity int
+	maxBytes int64
+	bytes    int64
+}
+
+// Cache is a generic LRU cache with per-entry ttl, it is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	opt    Options[K, V]
+	shards []*shard[K, V]
+	mask   uint64
+	hash   func(key K) uint64
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// NewCache creates a Cache holding at most capacity entries.
+func NewCache[K comparable, V any](capacity int) *Cache[K, V] {
+	return NewWithOptions(Options[K, V]{Capacity: capacity})
+}
+
+// NewWithOptions creates a Cache with opt.
+func NewWithOptions[K comparable, V any](opt Options[K, V]) *Cache[K, V] {
+	if opt.MaxBytes > 0 && opt.Sizer == nil {
+		panic("lrucache: Sizer is required with MaxBytes")
+	}
+	n := 1
+	if opt.Shards > 1 {
+		n = nextPowOf2(opt.Shards)
+	}
+
+	c := &Cache[K, V]{
+		opt:    opt,
+		shards: make([]*shard[K, V], n),
+		mask:   uint64(n - 1),
+		hash:   opt.Hash,
+	}
+	if c.hash == nil {
+		c.hash = defaultHasher[K]()
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard[K, V]{
+			items:    make(map[K]*entry[K, V]),
+			capacity: (opt.Capacity + n - 1) / n,
+			maxBytes: (opt.MaxBytes + int64(n) - 1) / int64(n),
+		}
+	}
+	return c
+}
+
+func defaultHasher[K comparable]() func(key K) uint64 {
+	seed := maphash.MakeSeed()
+	return func(key K) uint64 {
+		switch k := any(key).(type) {
+		case string:
+			return maphash.String(seed, k)
+		case int:
+			return mix(uint64(k))
+		case int32:
+			return mix(uint64(k))
+		case int64:
+			return mix(uint64(k))
+		case uint:
+			return mix(uint64(k))
+		case uint32:
+			return mix(uint64(k))
+		case uint64:
+			return mix(k)
+		default:
+			return maphash.String(seed, fmt.Sprint(k))
+		}
+	}
+}
+
+// mix is the finalizer of splitmix64.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (c *Cache[K, V]) shard(key K) *shard[K, V] {
+	if c.mask == 0 {
+		return c.shards[0]
+	}
+	return c.shards[c.hash(key)&c.mask]
+}
+
+// Get returns the value of key and marks it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	return c.get(key, true)
+}
+
+// Peek returns the value of key without changing the LRU order or the stats.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	return c.get(key, false)
+}
+
+// Contains reports whether key is in the cache, without changing the LRU order or the stats.
+func (c *Cache[K, V]) Contains(key K) bool {
+	_, ok := c.get(key, false)
+	return ok
+}
+
+func (c *Cache[K, V]) get(key K, touch bool) (V, bool) {
+	var zero V
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		if touch {
+			atomic.AddUint64(&c.misses, 1)
+		}
+		return zero, false
+	}
+	if e.expired(time.Now().UnixNano()) {
+		s.remove(e)
+		s.mu.Unlock()
+		if touch {
+			atomic.AddUint64(&c.misses, 1)
+		}
+		c.evicted([]eviction[K, V]{{e.key, e.val, EvictedExpired}})
+		return zero, false
+	}
+	if touch {
+		s.moveToFront(e)
+	}
+	v := e.val
+	s.mu.Unlock()
+	if touch {
+		atomic.AddUint64(&c.hits, 1)
+	}
+	return v, true
+}
+
+// Set stores the value of key with the default ttl.
+func (c *Cache[K, V]) Set(key K, val V) {
+	c.SetWithTTL(key, val, c.opt.TTL)
+}
+
+// SetWithTTL stores the value of key with ttl, 0 means it never expires.
+// An entry larger than the size limit of a shard is not stored.
+func (c *Cache[K, V]) SetWithTTL(key K, val V, ttl time.Duration) {
+	e := &entry[K, V]{key: key, val: val}
+	if ttl > 0 {
+		e.expireAt = time.Now().Add(ttl).UnixNano()
+	}
+	if c.opt.Sizer != nil {
+		e.size = c.opt.Sizer(key, val)
+	}
+
+	var evs []eviction[K, V]
+	s := c.shard(key)
+	s.mu.Lock()
+	if old, ok := s.items[key]; ok {
+		s.remove(old)
+		evs = append(evs, eviction[K, V]{old.key, old.val, EvictedDeleted})
+	}
+	if s.maxBytes > 0 && e.size > s.maxBytes {
+		s.mu.Unlock()
+		c.evicted(evs)
+		return
+	}
+	s.pushFront(e)
+	now := time.Now().UnixNano()
+	for s.over() {
+		t := s.tail
+		s.remove(t)
+		reason := EvictedCapacity
+		if t.expired(now) {
+			reason = EvictedExpired
+		}
+		evs = append(evs, eviction[K, V]{t.key, t.val, reason})
+	}
+	s.mu.Unlock()
+	c.evicted(evs)
+}
+
+// Delete removes key, it returns false if key is not in the cache.
+func (c *Cache[K, V]) Delete(key K) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if ok {
+		s.remove(e)
+	}
+	s.mu.Unlock()
+	if ok {
+		c.evicted([]eviction[K, V]{{e.key, e.val, EvictedDeleted}})
+	}
+	return ok
+}
+
+// DeleteExpired removes all the expired entries, expired entries are
+// otherwise removed lazily when they are read or evicted.
+func (c *Cache[K, V]) DeleteExpired() {
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		var evs []eviction[K, V]
+		s.mu.Lock()
+		for e := s.head; e != nil; {
+			next := e.next
+			if e.expired(now) {
+				s.remove(e)
+				evs = append(evs, eviction[K, V]{e.key, e.val, EvictedExpired})
+			}
+			e = next
+		}
+		s.mu.Unlock()
+		c.evicted(evs)
+	}
+}
+
+// Purge removes all entries.
+func (c *Cache[K, V]) Purge() {
+	for _, s := range c.shards {
+		var evs []eviction[K, V]
+		s.mu.Lock()
+		if c.opt.OnEvict != nil {
+			for e := s.head; e != nil; e = e.next {
+				evs = append(evs, eviction[K, V]{e.key, e.val, EvictedDeleted})
+			}
+		}
+		s.items = make(map[K]*entry[K, V])
+		s.head, s.tail, s.bytes = nil, nil, 0
+		s.mu.Unlock()
+		c.evicted(evs)
+	}
+}
+
+// Range calls f for each unexpired entry from the most recently used one of
+// each shard, it stops if f returns false. f must not modify the cache.
+func (c *Cache[K, V]) Range(f func(key K, val V) bool) {
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for e := s.head; e != nil; e = e.next {
+			if e.expired(now) {
+				continue
+			}
+			if !f(e.key, e.val) {
+				s.mu.Unlock()
+				return
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Len returns the number of entries, including the expired ones not removed yet.
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Bytes returns the total size of entries computed by Sizer.
+func (c *Cache[K, V]) Bytes() int64 {
+	var n int64
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.bytes
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the statistics since the cache was created.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Evictions:   atomic.LoadUint64(&c.evictions),
+		Expirations: atomic.LoadUint64(&c.expirations),
+	}
+}
+
+func (c *Cache[K, V]) evicted(evs []eviction[K, V]) {
+	for _, ev := range evs {
+		switch ev.reason {
+		case EvictedCapacity:
+			atomic.AddUint64(&c.evictions, 1)
+		case EvictedExpired:
+			atomic.AddUint64(&c.expirations, 1)
+		}
+		if c.opt.OnEvict != nil {
+			c.opt.OnEvict(ev.key, ev.val, ev.reason)
+		}
+	}
+}
+
+func (e *entry[K, V]) expired(now int64) bool {
+	return e.expireAt > 0 && now >= e.expireAt
+}
+
+func (s *shard[K, V]) over() bool {
+	if s.tail == nil {
+		return false
+	}
+	return (s.capacity > 0 && len(s.items) > s.capacity) || (s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+func (s *shard[K, V]) pushFront(e *entry[K, V]) {
+	s.items[e.key] = e
+	s.bytes += e.size
+	e.prev, e.next = nil, s.head
+	if s.head != nil {
+		s.head.prev = e
+	} else {
+		s.tail = e
+	}
+	s.head = e
+}
+
+func (s *shard[K, V]) moveToFront(e *entry[K, V]) {
+	if s.head == e {
+		return
+	}
+	s.unlink(e)
+	e.prev, e.next = nil, s.head
+	s.head.prev = e
+	s.head = e
+}
+
+func (s *shard[K, V]) remove(e *entry[K, V]) {
+	delete(s.items, e.key)
+	s.bytes -= e.size
+	s.unlink(e)
+}
+
+func (s *shard[K, V]) unlink(e *entry[K, V]) {
+	if e.prev == nil {
+		s.head = e.next
+	} else {
+		e.prev.next = e.next
+	}
+	if e.next == nil {
+		s.tail = e.prev
+	} else {
+		e.next.prev = e.prev
+	}
+	e.prev, e.next = nil, nil
+}
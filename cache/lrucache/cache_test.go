@@ -0,0 +1,163 @@
+package lrucache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache[string, int](2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("get a: %v %v", v, ok)
+	}
+	c.Set("c", 3)
+	if c.Contains("b") {
+		t.Fatal("b should be evicted")
+	}
+	if c.Len() != 2 {
+		t.Fatalf("len: %d", c.Len())
+	}
+
+	// Peek does not refresh
+	c.Peek("a")
+	c.Set("d", 4)
+	if c.Contains("a") || !c.Contains("c") {
+		t.Fatal("a should be evicted")
+	}
+
+	if !c.Delete("c") || c.Delete("c") {
+		t.Fatal("delete c")
+	}
+	if _, ok := c.Get("x"); ok {
+		t.Fatal("get x")
+	}
+
+	st := c.Stats()
+	if st.Hits != 1 || st.Misses != 1 || st.Evictions != 2 {
+		t.Fatalf("stats: %+v", st)
+	}
+	if st.HitRate() != 0.5 {
+		t.Fatalf("hit rate: %v", st.HitRate())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	var evicted []string
+	c := NewWithOptions(Options[string, int]{
+		Capacity: 10,
+		TTL:      20 * time.Millisecond,
+		OnEvict: func(key string, val int, reason EvictReason) {
+			evicted = append(evicted, key+":"+reason.String())
+		},
+	})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.SetWithTTL("c", 3, 0)
+	c.Set("b", 3)
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("a should be expired")
+	}
+	c.DeleteExpired()
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Fatalf("get c: %v %v", v, ok)
+	}
+	c.Purge()
+	if c.Len() != 0 {
+		t.Fatalf("len: %d", c.Len())
+	}
+
+	want := []string{"b:deleted", "a:expired", "b:expired", "c:deleted"}
+	if len(evicted) != len(want) {
+		t.Fatalf("evicted: %v", evicted)
+	}
+	for i := range want {
+		if evicted[i] != want[i] {
+			t.Fatalf("evicted: %v", evicted)
+		}
+	}
+	if st := c.Stats(); st.Expirations != 2 || st.Evictions != 0 {
+		t.Fatalf("stats: %+v", st)
+	}
+}
+
+func TestCacheBytes(t *testing.T) {
+	c := NewWithOptions(Options[string, []byte]{
+		MaxBytes: 10,
+		Sizer:    func(key string, val []byte) int64 { return int64(len(val)) },
+	})
+	c.Set("a", make([]byte, 4))
+	c.Set("b", make([]byte, 4))
+	c.Set("c", make([]byte, 4))
+	if c.Contains("a") || c.Bytes() != 8 {
+		t.Fatalf("bytes: %d", c.Bytes())
+	}
+
+	// too large to store
+	c.Set("d", make([]byte, 11))
+	if c.Contains("d") || c.Len() != 2 {
+		t.Fatal("d should not be stored")
+	}
+	c.Set("b", make([]byte, 1))
+	if c.Bytes() != 5 {
+		t.Fatalf("bytes: %d", c.Bytes())
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	c := NewWithOptions(Options[int, int]{Capacity: 1024, Shards: 10})
+	if len(c.shards) != 16 {
+		t.Fatalf("shards: %d", len(c.shards))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Set(i*1000+j, j)
+				c.Get(i*1000 + j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.Len() > 1024 {
+		t.Fatalf("len: %d", c.Len())
+	}
+	n := 0
+	c.Range(func(key, val int) bool {
+		n++
+		return true
+	})
+	if n != c.Len() {
+		t.Fatalf("range: %d", n)
+	}
+
+	s := NewWithOptions(Options[string, int]{Shards: 4})
+	for i := 0; i < 100; i++ {
+		s.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := s.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Fatalf("get %d: %v %v", i, v, ok)
+		}
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	c := NewWithOptions(Options[int, int]{Capacity: 1 << 16, Shards: 16})
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.Set(i&0xffff, i)
+			c.Get(i & 0xfff)
+			i++
+		}
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	gredis "github.com/redis/go-redis/v9"
+
+	dredis "github.com/aaabigfish/gopkg/database/redis"
 )
 
 // Client redis 客户端
@@ -14,18 +16,22 @@ type Client struct {
 	gredis.UniversalClient
 }
 
-// Get 获取缓存实例
+// NewClient 获取缓存实例，dsn格式见database/redis.ParseDSN，dsn错误时panic
 func NewClient(dsn string) *Client {
-	opts := &gredis.UniversalOptions{}
-
-	setOptions(opts, dsn)
-
-	rdb := gredis.NewUniversalClient(opts)
-
-	db := &Client{rdb}
-
-	return db
+	c, err := Open(dsn)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
 
+// Open 获取缓存实例，dsn格式见database/redis.ParseDSN
+func Open(dsn string) (*Client, error) {
+	d, err := dredis.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{d.NewUniversalClient()}, nil
 }
 
 func (c *Client) SaveStruct(ctx context.Context, key string, data interface{}, second int) error {
@@ -0,0 +1,345 @@
+// Package tiered implements a two-level cache: an in-process LRU layered over
+// Redis, filled by a loader.
+//
+// A Get looks up the local LRU, then Redis, then calls the loader, concurrent
+// misses of the same key share one load. Entries expire after their TTL plus a
+// random jitter so keys written together do not expire together. A loader
+// returning ErrNotFound is cached as well (negative caching) for NegativeTTL.
+// Set and Delete publish the key on a Redis channel so the other instances drop
+// their local copies.
+package tiered
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/rs/xid"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/aaabigfish/gopkg/cache/lrucache"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// ErrNotFound is returned by a loader when the key does not exist, and by Get
+// when the key is cached as not found.
+var ErrNotFound = errors.New("tiered: not found")
+
+const (
+	defaultLocalSize = 1024
+	defaultLocalTTL  = time.Minute
+	defaultRedisTTL  = 10 * time.Minute
+	defaultJitter    = 0.1
+
+	flagValue    byte = 0
+	flagNotFound byte = 1
+)
+
+// Loader loads the value of key from the source, it returns ErrNotFound if key does not exist.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Options configures a Cache, zero fields use the defaults.
+type Options[K comparable, V any] struct {
+	// Name prefixes the redis keys and the invalidation channel, it is required.
+	Name string
+	// Loader loads the missing keys, Get returns ErrNotFound on a miss if it is nil.
+	Loader Loader[K, V]
+
+	// LocalSize is the capacity of the local LRU, 1024 by default, negative disables the local tier.
+	LocalSize int
+	// LocalTTL is the ttl of the local entries, 1 minute by default.
+	LocalTTL time.Duration
+
+	// Redis is the client of the remote tier, nil disables the remote tier.
+	Redis gredis.UniversalClient
+	// RedisTTL is the ttl of the redis entries, 10 minutes by default.
+	RedisTTL time.Duration
+
+	// Jitter extends each ttl by a random fraction in [0, Jitter), 0.1 by default.
+	Jitter float64
+	// NegativeTTL is the ttl of not found entries in both tiers, 0 disables negative caching.
+	NegativeTTL time.Duration
+
+	// Key formats the key, fmt.Sprint by default.
+	Key func(key K) string
+	// Marshal and Unmarshal encode values in redis, json by default.
+	Marshal   func(v V) ([]byte, error)
+	Unmarshal func(data []byte, v *V) error
+
+	// DisableInvalidation stops publishing and subscribing the invalidation
+	// channel, so local copies may be stale for up to LocalTTL after a change.
+	DisableInvalidation bool
+}
+
+func (o Options[K, V]) withDefaults() Options[K, V] {
+	if o.LocalSize == 0 {
+		o.LocalSize = defaultLocalSize
+	}
+	if o.LocalTTL <= 0 {
+		o.LocalTTL = defaultLocalTTL
+	}
+	if o.RedisTTL <= 0 {
+		o.RedisTTL = defaultRedisTTL
+	}
+	if o.Jitter == 0 {
+		o.Jitter = defaultJitter
+	}
+	if o.Key == nil {
+		o.Key = func(key K) string { return fmt.Sprint(key) }
+	}
+	if o.Marshal == nil {
+		o.Marshal = func(v V) ([]byte, error) { return json.Marshal(v) }
+	}
+	if o.Unmarshal == nil {
+		o.Unmarshal = func(data []byte, v *V) error { return json.Unmarshal(data, v) }
+	}
+	return o
+}
+
+type localEntry[V any] struct {
+	val      V
+	notFound bool
+}
+
+// Cache is a two-level cache, it is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	opt     Options[K, V]
+	id      string
+	channel string
+
+	local *lrucache.Cache[string, *localEntry[V]]
+
+	sfg    singleflight.Group
+	pubsub *gredis.PubSub
+	done   chan struct{}
+}
+
+// New creates a Cache. If Redis is set and invalidation is enabled it
+// subscribes the invalidation channel, call Close to release it.
+func New[K comparable, V any](opt Options[K, V]) (*Cache[K, V], error) {
+	if opt.Name == "" {
+		return nil, errors.New("tiered: empty name")
+	}
+	opt = opt.withDefaults()
+
+	c := &Cache[K, V]{
+		opt:     opt,
+		id:      xid.New().String(),
+		channel: opt.Name + ":invalidate",
+		done:    make(chan struct{}),
+	}
+	if opt.LocalSize > 0 {
+		c.local = lrucache.NewWithOptions(lrucache.Options[string, *localEntry[V]]{
+			Capacity: opt.LocalSize,
+			Shards:   16,
+		})
+	}
+	if c.broadcasting() {
+		c.pubsub = opt.Redis.Subscribe(context.Background(), c.channel)
+		// wait for the subscription so no invalidation after New is missed
+		if _, err := c.pubsub.Receive(context.Background()); err != nil {
+			c.pubsub.Close()
+			return nil, err
+		}
+		go c.subscribe()
+	} else {
+		close(c.done)
+	}
+	return c, nil
+}
+
+func (c *Cache[K, V]) broadcasting() bool {
+	return c.opt.Redis != nil && c.local != nil && !c.opt.DisableInvalidation
+}
+
+// Get returns the value of key from the local tier, the redis tier or the
+// loader in turn. Concurrent loads of the same key are merged, the ctx of the
+// first caller is passed to the loader.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	k := c.opt.Key(key)
+	if e, ok := c.getLocal(k); ok {
+		if e.notFound {
+			return e.val, ErrNotFound
+		}
+		return e.val, nil
+	}
+
+	v, err, _ := c.sfg.Do(k, func() (interface{}, error) {
+		e, err := c.getRedis(ctx, k)
+		if err == nil {
+			c.setLocal(k, e)
+			return e, nil
+		}
+		if !errors.Is(err, gredis.Nil) {
+			log.Warnf("tiered: get redis key(%s) err(%v)", c.redisKey(k), err)
+		}
+
+		if c.opt.Loader == nil {
+			return nil, ErrNotFound
+		}
+		val, err := c.opt.Loader(ctx, key)
+		switch {
+		case err == nil:
+			e = &localEntry[V]{val: val}
+		case errors.Is(err, ErrNotFound) && c.opt.NegativeTTL > 0:
+			e = &localEntry[V]{notFound: true}
+		default:
+			return nil, err
+		}
+		c.setLocal(k, e)
+		if err := c.setRedis(ctx, k, e); err != nil {
+			log.Warnf("tiered: set redis key(%s) err(%v)", c.redisKey(k), err)
+		}
+		return e, nil
+	})
+
+	var zero V
+	if err != nil {
+		return zero, err
+	}
+	e := v.(*localEntry[V])
+	if e.notFound {
+		return zero, ErrNotFound
+	}
+	return e.val, nil
+}
+
+// Set stores the value of key in both tiers and invalidates the other instances.
+func (c *Cache[K, V]) Set(ctx context.Context, key K, val V) error {
+	k := c.opt.Key(key)
+	e := &localEntry[V]{val: val}
+	if err := c.setRedis(ctx, k, e); err != nil {
+		return err
+	}
+	c.setLocal(k, e)
+	return c.publish(ctx, k)
+}
+
+// Delete removes key from both tiers and invalidates the other instances.
+func (c *Cache[K, V]) Delete(ctx context.Context, key K) error {
+	k := c.opt.Key(key)
+	if c.opt.Redis != nil {
+		if err := c.opt.Redis.Del(ctx, c.redisKey(k)).Err(); err != nil {
+			return err
+		}
+	}
+	c.deleteLocal(k)
+	return c.publish(ctx, k)
+}
+
+// Invalidate removes key from the local tier of all instances, the redis tier is kept.
+func (c *Cache[K, V]) Invalidate(ctx context.Context, key K) error {
+	k := c.opt.Key(key)
+	c.deleteLocal(k)
+	return c.publish(ctx, k)
+}
+
+// Close stops subscribing the invalidation channel.
+func (c *Cache[K, V]) Close() error {
+	if c.pubsub == nil {
+		return nil
+	}
+	err := c.pubsub.Close()
+	<-c.done
+	return err
+}
+
+func (c *Cache[K, V]) redisKey(k string) string {
+	return c.opt.Name + ":" + k
+}
+
+func (c *Cache[K, V]) ttl(d time.Duration) time.Duration {
+	return d + time.Duration(rand.Float64()*c.opt.Jitter*float64(d))
+}
+
+func (c *Cache[K, V]) getLocal(k string) (*localEntry[V], bool) {
+	if c.local == nil {
+		return nil, false
+	}
+	return c.local.Get(k)
+}
+
+func (c *Cache[K, V]) setLocal(k string, e *localEntry[V]) {
+	if c.local == nil {
+		return
+	}
+	ttl := c.opt.LocalTTL
+	if e.notFound && c.opt.NegativeTTL < ttl {
+		ttl = c.opt.NegativeTTL
+	}
+	c.local.SetWithTTL(k, e, c.ttl(ttl))
+}
+
+func (c *Cache[K, V]) deleteLocal(k string) {
+	if c.local == nil {
+		return
+	}
+	c.local.Delete(k)
+}
+
+func (c *Cache[K, V]) getRedis(ctx context.Context, k string) (*localEntry[V], error) {
+	if c.opt.Redis == nil {
+		return nil, gredis.Nil
+	}
+	data, err := c.opt.Redis.Get(ctx, c.redisKey(k)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("tiered: invalid redis value")
+	}
+
+	e := &localEntry[V]{}
+	switch data[0] {
+	case flagNotFound:
+		e.notFound = true
+	case flagValue:
+		if err := c.opt.Unmarshal(data[1:], &e.val); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("tiered: invalid redis value flag(%d)", data[0])
+	}
+	return e, nil
+}
+
+func (c *Cache[K, V]) setRedis(ctx context.Context, k string, e *localEntry[V]) error {
+	if c.opt.Redis == nil {
+		return nil
+	}
+	data := []byte{flagNotFound}
+	ttl := c.opt.NegativeTTL
+	if !e.notFound {
+		b, err := c.opt.Marshal(e.val)
+		if err != nil {
+			return err
+		}
+		data = append([]byte{flagValue}, b...)
+		ttl = c.opt.RedisTTL
+	}
+	return c.opt.Redis.Set(ctx, c.redisKey(k), data, c.ttl(ttl)).Err()
+}
+
+// invalidation messages are "<instance id> <key>", an instance ignores its own messages.
+func (c *Cache[K, V]) publish(ctx context.Context, k string) error {
+	if !c.broadcasting() {
+		return nil
+	}
+	return c.opt.Redis.Publish(ctx, c.channel, c.id+" "+k).Err()
+}
+
+func (c *Cache[K, V]) subscribe() {
+	defer close(c.done)
+	for msg := range c.pubsub.Channel() {
+		id, k, ok := strings.Cut(msg.Payload, " ")
+		if !ok || id == c.id {
+			continue
+		}
+		c.deleteLocal(k)
+	}
+}
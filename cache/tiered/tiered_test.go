@@ -0,0 +1,165 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, gredis.UniversalClient) {
+	s := miniredis.RunT(t)
+	rdb := gredis.NewClient(&gredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return s, rdb
+}
+
+func newCache(t *testing.T, opt Options[int, user]) *Cache[int, user] {
+	c, err := New(opt)
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGetLoad(t *testing.T) {
+	s, rdb := newRedis(t)
+	var loads int32
+	opt := Options[int, user]{
+		Name:  "user",
+		Redis: rdb,
+		Loader: func(ctx context.Context, id int) (user, error) {
+			atomic.AddInt32(&loads, 1)
+			time.Sleep(10 * time.Millisecond)
+			return user{ID: id, Name: "foo"}, nil
+		},
+	}
+	c := newCache(t, opt)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := c.Get(context.Background(), 1)
+			assert.NoError(t, err)
+			assert.Equal(t, user{ID: 1, Name: "foo"}, u)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// stored in redis with a jittered ttl
+	assert.True(t, s.Exists("user:1"))
+	ttl := s.TTL("user:1")
+	assert.True(t, ttl >= defaultRedisTTL && ttl < defaultRedisTTL+defaultRedisTTL/10, ttl)
+
+	// another instance gets it from redis
+	c2 := newCache(t, opt)
+	u, err := c2.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", u.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// served by the local tier after redis is flushed
+	s.FlushAll()
+	_, err = c2.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestNegativeCache(t *testing.T) {
+	s, rdb := newRedis(t)
+	var loads int32
+	boom := errors.New("boom")
+	c := newCache(t, Options[int, user]{
+		Name:        "user",
+		Redis:       rdb,
+		NegativeTTL: time.Minute,
+		Loader: func(ctx context.Context, id int) (user, error) {
+			atomic.AddInt32(&loads, 1)
+			if id == 2 {
+				return user{}, boom
+			}
+			return user{}, ErrNotFound
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(context.Background(), 1)
+		assert.Equal(t, ErrNotFound, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	assert.True(t, s.Exists("user:1"))
+
+	// other errors are not cached
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(context.Background(), 2)
+		assert.Equal(t, boom, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads))
+	assert.False(t, s.Exists("user:2"))
+}
+
+func TestInvalidation(t *testing.T) {
+	_, rdb := newRedis(t)
+	var loads int32
+	opt := Options[int, user]{
+		Name:  "user",
+		Redis: rdb,
+		Loader: func(ctx context.Context, id int) (user, error) {
+			atomic.AddInt32(&loads, 1)
+			return user{ID: id, Name: "foo"}, nil
+		},
+	}
+	c1 := newCache(t, opt)
+	c2 := newCache(t, opt)
+
+	c1.Get(context.Background(), 1)
+	c2.Get(context.Background(), 1)
+
+	assert.NoError(t, c1.Set(context.Background(), 1, user{ID: 1, Name: "bar"}))
+	assert.Eventually(t, func() bool {
+		u, _ := c2.Get(context.Background(), 1)
+		return u.Name == "bar"
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, c2.Delete(context.Background(), 1))
+	assert.Eventually(t, func() bool {
+		u, _ := c1.Get(context.Background(), 1)
+		return u.Name == "foo"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+}
+
+func TestLocalOnly(t *testing.T) {
+	c := newCache(t, Options[int, user]{
+		Name:     "user",
+		LocalTTL: 20 * time.Millisecond,
+		Loader: func(ctx context.Context, id int) (user, error) {
+			return user{ID: id, Name: time.Now().String()}, nil
+		},
+	})
+
+	u1, err := c.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	u2, _ := c.Get(context.Background(), 1)
+	assert.Equal(t, u1, u2)
+
+	time.Sleep(30 * time.Millisecond)
+	u3, _ := c.Get(context.Background(), 1)
+	assert.NotEqual(t, u1, u3)
+
+	_, err = New(Options[int, user]{})
+	assert.Error(t, err)
+}
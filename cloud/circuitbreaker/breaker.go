@@ -0,0 +1,321 @@
+// Package circuitbreaker implements circuit breakers based on the rolling
+// counters of stat/counter.
+//
+// A breaker is closed at first and every call is allowed. When the trip
+// policy reports the downstream is unhealthy, the breaker opens and calls
+// fail fast with ErrOpen. After the cooling timeout the breaker turns to
+// half-open and lets a few probes through, it closes if they all succeed,
+// otherwise it opens again.
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/stat/counter"
+)
+
+var (
+	// ErrOpen is returned when the breaker is open.
+	ErrOpen = errors.New("circuitbreaker: breaker is open")
+	// ErrTooManyProbes is returned when the breaker is half-open and the probes are exhausted.
+	ErrTooManyProbes = errors.New("circuitbreaker: too many probes in half-open state")
+)
+
+// State is the state of a breaker.
+type State int32
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultWindow         = 10 * time.Second
+	defaultBuckets        = 10
+	defaultCoolingTimeout = 5 * time.Second
+	defaultHalfOpenProbes = 1
+)
+
+// Options configures a breaker, zero fields use the defaults.
+type Options struct {
+	// Window is the time range of the rolling statistics, 10s by default.
+	Window time.Duration
+	// Buckets is the number of buckets the window is divided into, 10 by default.
+	Buckets int
+	// CoolingTimeout is how long the breaker stays open before probing, 5s by default.
+	CoolingTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent probes in half-open state, the
+	// breaker closes after that many probes succeed. 1 by default.
+	HalfOpenProbes int
+	// Trip decides whether to open the breaker after a failure,
+	// ErrorRateTrip(0.5, 20) by default.
+	Trip TripFunc
+	// IsFailure reports whether the error of a call is a failure, err != nil by default.
+	IsFailure func(err error) bool
+	// OnStateChange is called after the state of a breaker changed, key is the
+	// key of the breaker in a Panel or "" for a standalone breaker.
+	OnStateChange func(key string, from, to State)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window <= 0 {
+		o.Window = defaultWindow
+	}
+	if o.Buckets <= 0 {
+		o.Buckets = defaultBuckets
+	}
+	if o.CoolingTimeout <= 0 {
+		o.CoolingTimeout = defaultCoolingTimeout
+	}
+	if o.HalfOpenProbes <= 0 {
+		o.HalfOpenProbes = defaultHalfOpenProbes
+	}
+	if o.Trip == nil {
+		o.Trip = ErrorRateTrip(0.5, 20)
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = func(err error) bool { return err != nil }
+	}
+	return o
+}
+
+// Metrics is the statistics of a breaker in the current window.
+type Metrics struct {
+	Successes           int64
+	Failures            int64
+	ConsecutiveFailures int64
+}
+
+// Total returns the number of calls.
+func (m Metrics) Total() int64 {
+	return m.Successes + m.Failures
+}
+
+// ErrorRate returns the ratio of failures, 0 if there is no call.
+func (m Metrics) ErrorRate() float64 {
+	if m.Total() == 0 {
+		return 0
+	}
+	return float64(m.Failures) / float64(m.Total())
+}
+
+// TripFunc decides whether to open the breaker with the current metrics.
+type TripFunc func(m Metrics) bool
+
+// ErrorRateTrip opens the breaker when the error rate reaches rate and there are
+// at least minSamples calls in the window.
+func ErrorRateTrip(rate float64, minSamples int64) TripFunc {
+	return func(m Metrics) bool {
+		return m.Total() >= minSamples && m.ErrorRate() >= rate
+	}
+}
+
+// ConsecutiveTrip opens the breaker after n consecutive failures.
+func ConsecutiveTrip(n int64) TripFunc {
+	return func(m Metrics) bool {
+		return m.ConsecutiveFailures >= n
+	}
+}
+
+// AnyTrip opens the breaker if any of the policies does.
+func AnyTrip(trips ...TripFunc) TripFunc {
+	return func(m Metrics) bool {
+		for _, t := range trips {
+			if t(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Done reports the result of an allowed call.
+type Done func(err error)
+
+// Breaker is a circuit breaker, it is safe for concurrent use.
+type Breaker struct {
+	key  string
+	opts Options
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64
+	openedAt    time.Time
+	successes   counter.Counter
+	failures    counter.Counter
+	consecutive int64
+	probes      int
+	probeOK     int
+}
+
+// NewBreaker creates a breaker.
+func NewBreaker(opts Options) *Breaker {
+	return newBreaker("", opts.withDefaults())
+}
+
+func newBreaker(key string, opts Options) *Breaker {
+	return &Breaker{
+		key:       key,
+		opts:      opts,
+		successes: counter.NewRolling(opts.Window, opts.Buckets),
+		failures:  counter.NewRolling(opts.Window, opts.Buckets),
+	}
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	from := b.state
+	b.refresh(time.Now())
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return to
+}
+
+// Metrics returns the statistics in the current window.
+func (b *Breaker) Metrics() Metrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.metrics()
+}
+
+func (b *Breaker) metrics() Metrics {
+	return Metrics{
+		Successes:           b.successes.Value(),
+		Failures:            b.failures.Value(),
+		ConsecutiveFailures: b.consecutive,
+	}
+}
+
+// Allow checks whether a call is allowed. If so, done must be called with the
+// result of the call, otherwise err is ErrOpen or ErrTooManyProbes.
+func (b *Breaker) Allow() (done Done, err error) {
+	b.mu.Lock()
+	from := b.state
+	b.refresh(time.Now())
+	to := b.state
+
+	switch b.state {
+	case StateOpen:
+		err = ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.opts.HalfOpenProbes {
+			err = ErrTooManyProbes
+		} else {
+			b.probes++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		b.done(generation, b.opts.IsFailure(err))
+	}, nil
+}
+
+// Do calls fn if the breaker allows and records its result.
+func (b *Breaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+func (b *Breaker) done(generation uint64, failed bool) {
+	b.mu.Lock()
+	from := b.state
+	// the state changed since the call was allowed, the result is stale
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if failed {
+		b.failures.Add(1)
+		b.consecutive++
+	} else {
+		b.successes.Add(1)
+		b.consecutive = 0
+	}
+
+	switch b.state {
+	case StateClosed:
+		if failed && b.opts.Trip(b.metrics()) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failed {
+			b.setState(StateOpen, now)
+		} else if b.probeOK++; b.probeOK >= b.opts.HalfOpenProbes {
+			b.setState(StateClosed, now)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// refresh turns an open breaker to half-open after the cooling timeout.
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.opts.CoolingTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(s State, now time.Time) {
+	b.state = s
+	b.generation++
+	b.probes = 0
+	b.probeOK = 0
+	switch s {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.successes.Reset()
+		b.failures.Reset()
+		b.consecutive = 0
+	}
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.key, from, to)
+	}
+}
+
+// Reset closes the breaker and clears the statistics.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	from := b.state
+	b.setState(StateClosed, time.Now())
+	b.mu.Unlock()
+
+	b.notify(from, StateClosed)
+}
@@ -0,0 +1,202 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTest = errors.New("test")
+
+type stateLog struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (l *stateLog) record(key string, from, to State) {
+	l.mu.Lock()
+	l.changes = append(l.changes, key+":"+from.String()+"->"+to.String())
+	l.mu.Unlock()
+}
+
+func (l *stateLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.changes...)
+}
+
+func TestConsecutiveTrip(t *testing.T) {
+	l := &stateLog{}
+	b := NewBreaker(Options{
+		Trip:           ConsecutiveTrip(3),
+		CoolingTimeout: 50 * time.Millisecond,
+		OnStateChange:  l.record,
+	})
+
+	assert.Equal(t, errTest, b.Do(func() error { return errTest }))
+	assert.Equal(t, errTest, b.Do(func() error { return errTest }))
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.Equal(t, StateClosed, b.State())
+
+	for i := 0; i < 3; i++ {
+		b.Do(func() error { return errTest })
+	}
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, ErrOpen, b.Do(func() error { return nil }))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	// only one probe at a time
+	done, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrTooManyProbes, err)
+
+	// failed probe opens again
+	done(errTest)
+	assert.Equal(t, StateOpen, b.State())
+
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, Metrics{}, b.Metrics())
+
+	assert.Equal(t, []string{
+		":closed->open",
+		":open->half-open",
+		":half-open->open",
+		":open->half-open",
+		":half-open->closed",
+	}, l.get())
+}
+
+func TestErrorRateTrip(t *testing.T) {
+	b := NewBreaker(Options{Trip: ErrorRateTrip(0.5, 10)})
+
+	// not enough samples
+	for i := 0; i < 5; i++ {
+		b.Do(func() error { return errTest })
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	for i := 0; i < 4; i++ {
+		b.Do(func() error { return nil })
+	}
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, Metrics{Successes: 4, Failures: 5}, b.Metrics())
+
+	b.Do(func() error { return errTest })
+	assert.Equal(t, StateOpen, b.State())
+
+	b.Reset()
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestStaleResult(t *testing.T) {
+	b := NewBreaker(Options{Trip: ConsecutiveTrip(1)})
+	done1, err := b.Allow()
+	assert.NoError(t, err)
+	done2, err := b.Allow()
+	assert.NoError(t, err)
+
+	done1(errTest)
+	assert.Equal(t, StateOpen, b.State())
+	// the result of a call allowed before opening is ignored
+	done2(nil)
+	assert.Equal(t, Metrics{Failures: 1, ConsecutiveFailures: 1}, b.Metrics())
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	b := NewBreaker(Options{Trip: ConsecutiveTrip(1), CoolingTimeout: time.Millisecond, HalfOpenProbes: 2})
+	b.Do(func() error { return errTest })
+	time.Sleep(2 * time.Millisecond)
+
+	done1, err := b.Allow()
+	assert.NoError(t, err)
+	done2, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrTooManyProbes, err)
+
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(nil)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestPanel(t *testing.T) {
+	l := &stateLog{}
+	p := NewPanel(Options{Trip: ConsecutiveTrip(1), OnStateChange: l.record})
+	assert.Same(t, p.Get("a"), p.Get("a"))
+
+	p.Do("a", func() error { return errTest })
+	assert.Equal(t, ErrOpen, p.Do("a", func() error { return nil }))
+	assert.NoError(t, p.Do("b", func() error { return nil }))
+	assert.Equal(t, map[string]State{"a": StateOpen, "b": StateClosed}, p.States())
+	assert.Equal(t, []string{"a:closed->open"}, l.get())
+
+	p.Remove("a")
+	assert.Equal(t, StateClosed, p.Get("a").State())
+}
+
+func TestTransport(t *testing.T) {
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewPanel(Options{Trip: ConsecutiveTrip(2), CoolingTimeout: 50 * time.Millisecond})
+	c := NewHTTPClient(p, nil)
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	_, err := c.Get(srv.URL)
+	assert.ErrorIs(t, err, ErrOpen)
+
+	fail = false
+	time.Sleep(60 * time.Millisecond)
+	resp, err := c.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, map[string]State{srv.Listener.Addr().String(): StateClosed}, p.States())
+}
+
+func TestPanelStateChangeCallback(t *testing.T) {
+	var p *Panel
+	// 回调中使用panel不会死锁
+	p = NewPanel(Options{
+		Trip:           ConsecutiveTrip(1),
+		CoolingTimeout: 10 * time.Millisecond,
+		OnStateChange: func(key string, from, to State) {
+			if to == StateHalfOpen {
+				p.Remove(key)
+				p.Get(key + "-probe")
+			}
+		},
+	})
+	p.Do("a", func() error { return errTest })
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan map[string]State)
+	go func() { done <- p.States() }()
+	select {
+	case states := <-done:
+		assert.Equal(t, StateHalfOpen, states["a"])
+	case <-time.After(time.Second):
+		t.Fatal("States deadlocked")
+	}
+	assert.Equal(t, map[string]State{"a-probe": StateClosed}, p.States())
+}
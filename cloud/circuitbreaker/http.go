@@ -0,0 +1,53 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper guarded by a breaker per host.
+// Requests to an open host fail with ErrOpen, transport errors and responses
+// with status >= 500 are failures.
+type Transport struct {
+	Panel *Panel
+	// Base is the underlying transport, http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+// NewTransport creates a Transport over base.
+func NewTransport(p *Panel, base http.RoundTripper) *Transport {
+	return &Transport{Panel: p, Base: base}
+}
+
+// NewHTTPClient returns a copy of c whose transport is guarded by p.
+func NewHTTPClient(p *Panel, c *http.Client) *http.Client {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	nc := *c
+	nc.Transport = NewTransport(p, c.Transport)
+	return &nc
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.Panel.Allow(req.URL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, req.URL.Host)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		done(fmt.Errorf("circuitbreaker: http status %d", resp.StatusCode))
+	default:
+		done(nil)
+	}
+	return resp, err
+}
@@ -0,0 +1,74 @@
+package circuitbreaker
+
+import (
+	"sync"
+)
+
+// Panel manages breakers by key, e.g. one breaker per downstream host.
+// Breakers are created on first use and share the same options.
+type Panel struct {
+	opts Options
+
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// NewPanel creates a panel.
+func NewPanel(opts Options) *Panel {
+	return &Panel{
+		opts:     opts.withDefaults(),
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of key, it is created if not exists.
+func (p *Panel) Get(key string) *Breaker {
+	p.mu.RLock()
+	b, ok := p.breakers[key]
+	p.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if b, ok = p.breakers[key]; !ok {
+		b = newBreaker(key, p.opts)
+		p.breakers[key] = b
+	}
+	return b
+}
+
+// Allow checks the breaker of key, see Breaker.Allow.
+func (p *Panel) Allow(key string) (Done, error) {
+	return p.Get(key).Allow()
+}
+
+// Do calls fn with the breaker of key, see Breaker.Do.
+func (p *Panel) Do(key string, fn func() error) error {
+	return p.Get(key).Do(fn)
+}
+
+// Remove removes the breaker of key.
+func (p *Panel) Remove(key string) {
+	p.mu.Lock()
+	delete(p.breakers, key)
+	p.mu.Unlock()
+}
+
+// States returns the states of all breakers.
+func (p *Panel) States() map[string]State {
+	p.mu.RLock()
+	breakers := make(map[string]*Breaker, len(p.breakers))
+	for k, b := range p.breakers {
+		breakers[k] = b
+	}
+	p.mu.RUnlock()
+
+	// State may call OnStateChange, which is free to use the panel
+	states := make(map[string]State, len(breakers))
+	for k, b := range breakers {
+		states[k] = b.State()
+	}
+	return states
+}
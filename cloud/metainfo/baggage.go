@@ -0,0 +1,103 @@
+package metainfo
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// W3C Baggage header, see https://www.w3.org/TR/baggage/
+const (
+	HeaderBaggage = "baggage"
+
+	maxBaggageMembers = 180
+	maxBaggageBytes   = 8192
+)
+
+// ParseBaggage parses a baggage header value into key-value pairs.
+// Member properties are discarded and malformed members are skipped.
+func ParseBaggage(s string) map[string]string {
+	var m map[string]string
+	for _, member := range strings.Split(s, ",") {
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i]
+		}
+		i := strings.IndexByte(member, '=')
+		if i <= 0 {
+			continue
+		}
+		k := strings.TrimSpace(member[:i])
+		v, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+		if err != nil || !httpguts.ValidHeaderFieldName(k) || len(v) == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// FormatBaggage formats key-value pairs as a baggage header value.
+// Invalid keys are discarded, and members are dropped once the W3C limits are reached.
+func FormatBaggage(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if httpguts.ValidHeaderFieldName(k) && len(v) > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i == maxBaggageMembers {
+			break
+		}
+		member := k + "=" + url.PathEscape(m[k])
+		if b.Len()+len(member)+1 > maxBaggageBytes {
+			break
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(member)
+	}
+	return b.String()
+}
+
+// FromBaggageHeader reads the baggage header from the given carrier and sets its members as persistent values.
+func FromBaggageHeader(ctx context.Context, h HTTPHeaderCarrier) context.Context {
+	if ctx == nil || h == nil {
+		return ctx
+	}
+
+	var kvs []string
+	h.Visit(func(k, v string) {
+		if strings.ToLower(k) != HeaderBaggage {
+			return
+		}
+		for k, v := range ParseBaggage(v) {
+			kvs = append(kvs, k, v)
+		}
+	})
+	if len(kvs) == 0 {
+		return ctx
+	}
+	return WithPersistentValues(ctx, kvs...)
+}
+
+// ToBaggageHeader writes all persistent values of ctx as the baggage header.
+func ToBaggageHeader(ctx context.Context, h HTTPHeaderSetter) {
+	if ctx == nil || h == nil {
+		return
+	}
+
+	if s := FormatBaggage(GetAllPersistentValues(ctx)); s != "" {
+		h.Set(HeaderBaggage, s)
+	}
+}
@@ -0,0 +1,175 @@
+package metainfo
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCMetadata is provided to wrap a metadata.MD into an HTTPHeaderCarrier and an HTTPHeaderSetter.
+// gRPC metadata uses the same prefixes as HTTP headers.
+type GRPCMetadata metadata.MD
+
+// Visit implements the HTTPHeaderCarrier interface.
+func (m GRPCMetadata) Visit(v func(k, v string)) {
+	for k, vs := range m {
+		if len(vs) > 0 {
+			v(k, vs[0])
+		}
+	}
+}
+
+// Set implements the HTTPHeaderSetter interface.
+func (m GRPCMetadata) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+// FromGRPCMetadata reads metainfo from the given gRPC metadata and sets them into the context.
+// Note that this function does not call TransferForward inside.
+func FromGRPCMetadata(ctx context.Context, md metadata.MD) context.Context {
+	return FromHTTPHeader(ctx, GRPCMetadata(md))
+}
+
+// ToGRPCMetadata writes all metainfo into the given gRPC metadata.
+// Note that this function does not call TransferForward inside.
+func ToGRPCMetadata(ctx context.Context, md metadata.MD) {
+	ToHTTPHeader(ctx, GRPCMetadata(md))
+}
+
+// backwardToGRPCMetadata writes the values collected by `SendBackwardValue` into md.
+func backwardToGRPCMetadata(ctx context.Context, md metadata.MD) {
+	for k, v := range AllBackwardValuesToSend(ctx) {
+		if httpguts.ValidHeaderFieldName(k) && httpguts.ValidHeaderFieldValue(v) {
+			md.Set(HTTPPrefixBackward+CGIVariableToHTTPHeader(k), v)
+		}
+	}
+}
+
+// backwardFromGRPCMetadata passes the backward values found in mds to `SetBackwardValuesFromMap`.
+func backwardFromGRPCMetadata(ctx context.Context, mds ...metadata.MD) {
+	var kvs map[string]string
+	for _, md := range mds {
+		for k, vs := range md {
+			if len(vs) == 0 || len(vs[0]) == 0 {
+				continue
+			}
+			kk := strings.ToLower(k)
+			if len(kk) > lenHPB && strings.HasPrefix(kk, HTTPPrefixBackward) {
+				if kvs == nil {
+					kvs = make(map[string]string)
+				}
+				kvs[HTTPHeaderToCGIVariable(kk[lenHPB:])] = vs[0]
+			}
+		}
+	}
+	SetBackwardValuesFromMap(ctx, kvs)
+}
+
+// outgoingContext attaches metainfo of ctx to the outgoing gRPC metadata.
+func outgoingContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	ToGRPCMetadata(TransferForward(ctx), md)
+	ToTraceHeader(ctx, GRPCMetadata(md))
+	if len(md) == 0 {
+		return ctx
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// incomingContext reads metainfo and the remote span context from the incoming gRPC metadata,
+// and prepares ctx to collect backward values. Server spans are started by cloud/trace.
+func incomingContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = FromGRPCMetadata(ctx, md)
+		ctx = FromTraceHeader(ctx, GRPCMetadata(md))
+	}
+	return WithBackwardValuesToSend(TransferForward(ctx))
+}
+
+// UnaryClientInterceptor propagates transient and persistent values to the server,
+// and receives backward values into a context prepared with `WithBackwardValues`.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var header, trailer metadata.MD
+		opts = append(opts, grpc.Header(&header), grpc.Trailer(&trailer))
+		err := invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+		backwardFromGRPCMetadata(ctx, header, trailer)
+		return err
+	}
+}
+
+// StreamClientInterceptor is the streaming version of UnaryClientInterceptor.
+// Backward values are received once the stream ends.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(outgoingContext(ctx), desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, ctx: ctx}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		header, _ := s.ClientStream.Header()
+		backwardFromGRPCMetadata(s.ctx, header, s.ClientStream.Trailer())
+	}
+	return err
+}
+
+// UnaryServerInterceptor reads transient and persistent values sent by the client into the context,
+// and sends values set with `SendBackwardValue` back in the trailer.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = incomingContext(ctx)
+		resp, err := handler(ctx, req)
+		setBackwardTrailer(ctx, func(md metadata.MD) { grpc.SetTrailer(ctx, md) })
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the streaming version of UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		ctx := incomingContext(ss.Context())
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		setBackwardTrailer(ctx, ss.SetTrailer)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func setBackwardTrailer(ctx context.Context, set func(metadata.MD)) {
+	md := metadata.MD{}
+	backwardToGRPCMetadata(ctx, md)
+	if len(md) > 0 {
+		set(md)
+	}
+}
@@ -0,0 +1,134 @@
+package metainfo_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	got chan context.Context
+}
+
+func (s *healthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.got <- ctx
+	metainfo.SendBackwardValue(ctx, "bk", "unary")
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(_ *grpc_health_v1.HealthCheckRequest, ss grpc_health_v1.Health_WatchServer) error {
+	s.got <- ss.Context()
+	metainfo.SendBackwardValue(ss.Context(), "bk", "stream")
+	return ss.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
+
+func newGRPCClient(t *testing.T) (grpc_health_v1.HealthClient, *healthServer) {
+	lis := bufconn.Listen(1 << 20)
+	hs := &healthServer{got: make(chan context.Context, 1)}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(metainfo.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(metainfo.StreamServerInterceptor()),
+	)
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(metainfo.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(metainfo.StreamClientInterceptor()),
+	)
+	assert(t, err == nil, err)
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn), hs
+}
+
+func newGRPCContext() context.Context {
+	ctx := context.Background()
+	ctx = metainfo.WithValue(ctx, "uk", "uv")
+	ctx = metainfo.TransferForward(ctx)
+	ctx = metainfo.WithValue(ctx, "tk", "tv")
+	ctx = metainfo.WithPersistentValue(ctx, "pk", "pv")
+	ctx = metainfo.WithBackwardValues(ctx)
+	ctx, _ = metainfo.StartSpan(ctx)
+	return metadata.AppendToOutgoingContext(ctx, "other", "kept")
+}
+
+func checkServerContext(t *testing.T, client, ctx context.Context) {
+	t.Helper()
+	assert(t, metainfo.TraceID(ctx) == metainfo.TraceID(client), metainfo.TraceID(ctx))
+	// the span context of the client is the remote parent, no span is started on the server
+	sc, ok := metainfo.GetSpanContext(ctx)
+	assert(t, ok && sc.Remote, sc)
+	assert(t, metainfo.SpanID(ctx) == metainfo.SpanID(client), metainfo.SpanID(ctx))
+
+	vs := metainfo.GetAllValues(ctx)
+	assert(t, len(vs) == 1 && vs["TK"] == "tv", vs)
+	vs = metainfo.GetAllPersistentValues(ctx)
+	assert(t, len(vs) == 1 && vs["PK"] == "pv", vs)
+
+	// transient values are one hop only
+	next := metainfo.GetAllValues(metainfo.TransferForward(ctx))
+	assert(t, len(next) == 0, next)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	assert(t, len(md.Get("other")) == 1 && md.Get("other")[0] == "kept", md)
+}
+
+func TestGRPCUnaryInterceptor(t *testing.T) {
+	client, hs := newGRPCClient(t)
+	ctx := newGRPCContext()
+
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert(t, err == nil, err)
+	checkServerContext(t, ctx, <-hs.got)
+
+	v, ok := metainfo.RecvBackwardValue(ctx, "BK")
+	assert(t, ok && v == "unary", v)
+}
+
+func TestGRPCStreamInterceptor(t *testing.T) {
+	client, hs := newGRPCClient(t)
+	ctx := newGRPCContext()
+
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert(t, err == nil, err)
+	_, err = stream.Recv()
+	assert(t, err == nil, err)
+	_, err = stream.Recv()
+	assert(t, err == io.EOF, err)
+	checkServerContext(t, ctx, <-hs.got)
+
+	v, ok := metainfo.RecvBackwardValue(ctx, "BK")
+	assert(t, ok && v == "stream", v)
+}
+
+func TestGRPCMetadata(t *testing.T) {
+	ctx := metainfo.WithValue(context.Background(), "k1", "v1")
+	ctx = metainfo.WithPersistentValue(ctx, "k2", "v2")
+
+	md := metadata.MD{}
+	metainfo.ToGRPCMetadata(ctx, md)
+	assert(t, len(md) == 2, md)
+	assert(t, md.Get(metainfo.HTTPPrefixTransient + "k1")[0] == "v1")
+	assert(t, md.Get(metainfo.HTTPPrefixPersistent + "k2")[0] == "v2")
+
+	ctx = metainfo.FromGRPCMetadata(context.Background(), md)
+	v, ok := metainfo.GetValue(ctx, "K1")
+	assert(t, ok && v == "v1")
+	v, ok = metainfo.GetPersistentValue(ctx, "K2")
+	assert(t, ok && v == "v2")
+}
@@ -49,6 +49,9 @@ func TestWithValues(t *testing.T) {
 		assert(t, ok)
 		assert(t, x == fmt.Sprintf("Value-%d", i))
 	}
+
+	x, ok := metainfo.GetValue(ctx, k)
+	assert(t, ok && x == v)
 }
 
 func TestWithEmpty(t *testing.T) {
@@ -186,6 +189,9 @@ func TestWithPersistentEmpty(t *testing.T) {
 func TestWithPersistentValues(t *testing.T) {
 	ctx := context.Background()
 
+	k, v := "Key", "Value"
+	ctx = metainfo.WithPersistentValue(ctx, k, v)
+
 	kvs := []string{"Key-1", "Value-1", "Key-2", "Value-2", "Key-3", "Value-3"}
 	ctx = metainfo.WithPersistentValues(ctx, kvs...)
 	assert(t, ctx != nil)
@@ -195,6 +201,9 @@ func TestWithPersistentValues(t *testing.T) {
 		assert(t, ok)
 		assert(t, x == fmt.Sprintf("Value-%d", i))
 	}
+
+	x, ok := metainfo.GetPersistentValue(ctx, k)
+	assert(t, ok && x == v)
 }
 
 func TestWithPersistentValuesEmpty(t *testing.T) {
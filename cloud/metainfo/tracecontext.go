@@ -0,0 +1,243 @@
+package metainfo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"strings"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+
+	traceParentVersion = "00"
+	lenTraceParent     = 55 // 00-<32 hex>-<16 hex>-<2 hex>
+)
+
+// FlagSampled is the sampled bit of the trace flags.
+const FlagSampled byte = 0x01
+
+// ErrInvalidTraceParent is returned when a traceparent header can not be parsed.
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// W3CTraceID is a 16 bytes W3C trace id.
+type W3CTraceID [16]byte
+
+// IsValid reports whether the trace id is not all zeros.
+func (t W3CTraceID) IsValid() bool {
+	return t != W3CTraceID{}
+}
+
+// String returns the lowercase hex encoding of the trace id.
+func (t W3CTraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// W3CSpanID is an 8 bytes W3C span id.
+type W3CSpanID [8]byte
+
+// IsValid reports whether the span id is not all zeros.
+func (s W3CSpanID) IsValid() bool {
+	return s != W3CSpanID{}
+}
+
+// String returns the lowercase hex encoding of the span id.
+func (s W3CSpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// NewTraceID generates a random trace id.
+func NewTraceID() (t W3CTraceID) {
+	for !t.IsValid() {
+		binary.BigEndian.PutUint64(t[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(t[8:], rand.Uint64())
+	}
+	return
+}
+
+// NewSpanID generates a random span id.
+func NewSpanID() (s W3CSpanID) {
+	for !s.IsValid() {
+		binary.BigEndian.PutUint64(s[:], rand.Uint64())
+	}
+	return
+}
+
+// SpanContext is the part of a span that is propagated across services.
+type SpanContext struct {
+	TraceID    W3CTraceID
+	SpanID     W3CSpanID
+	Flags      byte
+	TraceState string
+	// Remote is true if the span context is received from another service.
+	Remote bool
+}
+
+// IsValid reports whether both the trace id and the span id are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// TraceParent formats the span context as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	var b strings.Builder
+	b.Grow(lenTraceParent)
+	b.WriteString(traceParentVersion)
+	b.WriteByte('-')
+	b.WriteString(sc.TraceID.String())
+	b.WriteByte('-')
+	b.WriteString(sc.SpanID.String())
+	b.WriteByte('-')
+	b.WriteString(hex.EncodeToString([]byte{sc.Flags}))
+	return b.String()
+}
+
+// ParseTraceParent parses a traceparent header value.
+// Future versions are accepted as long as their first four fields are valid.
+func ParseTraceParent(s string) (sc SpanContext, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) < lenTraceParent {
+		return sc, ErrInvalidTraceParent
+	}
+	version := s[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return sc, ErrInvalidTraceParent
+	}
+	if version == traceParentVersion && len(s) != lenTraceParent {
+		return sc, ErrInvalidTraceParent
+	}
+	if len(s) > lenTraceParent && s[lenTraceParent] != '-' {
+		return sc, ErrInvalidTraceParent
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, ErrInvalidTraceParent
+	}
+
+	traceID, spanID, flags := s[3:35], s[36:52], s[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return sc, ErrInvalidTraceParent
+	}
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type spanCtxKeyType struct{}
+
+var spanCtxKey spanCtxKeyType
+
+// WithSpanContext returns a context carrying the span context.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if ctx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanCtxKey, sc)
+}
+
+// GetSpanContext retrieves the span context from the context.
+func GetSpanContext(ctx context.Context) (sc SpanContext, ok bool) {
+	if ctx != nil {
+		sc, ok = ctx.Value(spanCtxKey).(SpanContext)
+	}
+	return
+}
+
+// TraceID returns the hex trace id carried by the context or an empty string.
+func TraceID(ctx context.Context) string {
+	if sc, ok := GetSpanContext(ctx); ok && sc.TraceID.IsValid() {
+		return sc.TraceID.String()
+	}
+	return ""
+}
+
+// SpanID returns the hex span id carried by the context or an empty string.
+func SpanID(ctx context.Context) string {
+	if sc, ok := GetSpanContext(ctx); ok && sc.SpanID.IsValid() {
+		return sc.SpanID.String()
+	}
+	return ""
+}
+
+// StartSpan returns a context carrying a new span context.
+// The new span shares the trace id, flags and trace state of the span in ctx,
+// or starts a new sampled trace if there is none.
+func StartSpan(ctx context.Context) (context.Context, SpanContext) {
+	sc, ok := GetSpanContext(ctx)
+	if !ok || !sc.TraceID.IsValid() {
+		sc = SpanContext{TraceID: NewTraceID(), Flags: FlagSampled}
+	}
+	sc.SpanID = NewSpanID()
+	sc.Remote = false
+	return WithSpanContext(ctx, sc), sc
+}
+
+// FromTraceHeader reads traceparent and tracestate from the given carrier and sets them into the context.
+// An invalid traceparent is ignored and the tracestate is dropped with it.
+func FromTraceHeader(ctx context.Context, h HTTPHeaderCarrier) context.Context {
+	if ctx == nil || h == nil {
+		return ctx
+	}
+
+	var parent, state string
+	h.Visit(func(k, v string) {
+		switch strings.ToLower(k) {
+		case HeaderTraceParent:
+			parent = v
+		case HeaderTraceState:
+			state = v
+		}
+	})
+	if parent == "" {
+		return ctx
+	}
+
+	sc, err := ParseTraceParent(parent)
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = strings.TrimSpace(state)
+	return WithSpanContext(ctx, sc)
+}
+
+// ToTraceHeader writes the span context of ctx as traceparent and tracestate.
+func ToTraceHeader(ctx context.Context, h HTTPHeaderSetter) {
+	if ctx == nil || h == nil {
+		return
+	}
+
+	sc, ok := GetSpanContext(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+	h.Set(HeaderTraceParent, sc.TraceParent())
+	if sc.TraceState != "" {
+		h.Set(HeaderTraceState, sc.TraceState)
+	}
+}
@@ -0,0 +1,96 @@
+package metainfo_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := metainfo.ParseTraceParent(tp)
+	assert(t, err == nil, err)
+	assert(t, sc.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert(t, sc.SpanID.String() == "00f067aa0ba902b7")
+	assert(t, sc.IsSampled() && sc.Remote)
+	assert(t, sc.TraceParent() == tp)
+
+	// future versions may append fields
+	_, err = metainfo.ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what")
+	assert(t, err == nil, err)
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00x",
+	} {
+		_, err = metainfo.ParseTraceParent(s)
+		assert(t, err == metainfo.ErrInvalidTraceParent, s)
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx := context.Background()
+	assert(t, metainfo.TraceID(ctx) == "" && metainfo.SpanID(ctx) == "")
+
+	c1, root := metainfo.StartSpan(ctx)
+	assert(t, root.IsValid() && root.IsSampled() && !root.Remote)
+	assert(t, metainfo.TraceID(c1) == root.TraceID.String())
+	assert(t, metainfo.SpanID(c1) == root.SpanID.String())
+
+	c2, child := metainfo.StartSpan(c1)
+	assert(t, child.TraceID == root.TraceID && child.SpanID != root.SpanID)
+	assert(t, metainfo.SpanID(c2) == child.SpanID.String())
+}
+
+func TestTraceHeader(t *testing.T) {
+	h := make(http.Header)
+	ctx := context.Background()
+	metainfo.ToTraceHeader(ctx, h)
+	assert(t, len(h) == 0)
+
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.Set("tracestate", "congo=t61rcWkgMzE")
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.HTTPHeader(h))
+	sc, ok := metainfo.GetSpanContext(ctx)
+	assert(t, ok && sc.Remote && !sc.IsSampled())
+	assert(t, sc.TraceState == "congo=t61rcWkgMzE")
+
+	ctx, child := metainfo.StartSpan(ctx)
+	out := make(http.Header)
+	metainfo.ToTraceHeader(ctx, out)
+	assert(t, out.Get("traceparent") == child.TraceParent(), out)
+	assert(t, out.Get("tracestate") == "congo=t61rcWkgMzE", out)
+
+	h.Set("traceparent", "bad")
+	c := context.Background()
+	assert(t, metainfo.FromTraceHeader(c, metainfo.HTTPHeader(h)) == c)
+}
+
+func TestBaggage(t *testing.T) {
+	m := metainfo.ParseBaggage("userId=alice, serverNode = DF%2028;p=1,isProduction=false,bad,=x,k=")
+	assert(t, len(m) == 3, m)
+	assert(t, m["userId"] == "alice" && m["serverNode"] == "DF 28" && m["isProduction"] == "false", m)
+
+	s := metainfo.FormatBaggage(map[string]string{"b": "x,y;z", "a": "1", "bad key": "v"})
+	assert(t, s == "a=1,b=x%2Cy%3Bz", s)
+	assert(t, metainfo.ParseBaggage(s)["b"] == "x,y;z")
+
+	h := make(http.Header)
+	h.Set("baggage", "tenant=t1,region=cn")
+	ctx := metainfo.WithPersistentValue(context.Background(), "pk", "pv")
+	ctx = metainfo.FromBaggageHeader(ctx, metainfo.HTTPHeader(h))
+	vs := metainfo.GetAllPersistentValues(ctx)
+	assert(t, len(vs) == 3 && vs["tenant"] == "t1" && vs["region"] == "cn" && vs["pk"] == "pv", vs)
+
+	out := make(http.Header)
+	metainfo.ToBaggageHeader(ctx, out)
+	assert(t, out.Get("baggage") == "pk=pv,region=cn,tenant=t1", out)
+}
@@ -86,6 +86,22 @@ func SaveMetaInfoToMap(ctx context.Context, m map[string]string) {
 	}
 }
 
+// MapHeader is provided to wrap a map[string]string into an HTTPHeaderCarrier and an HTTPHeaderSetter,
+// e.g. to carry the trace context along with SaveMetaInfoToMap in message headers.
+type MapHeader map[string]string
+
+// Visit implements the HTTPHeaderCarrier interface.
+func (m MapHeader) Visit(v func(k, v string)) {
+	for k, vv := range m {
+		v(k, vv)
+	}
+}
+
+// Set implements the HTTPHeaderSetter interface.
+func (m MapHeader) Set(key, value string) {
+	m[key] = value
+}
+
 // sliceToMap converts a kv slice to map. If the slice is empty, an empty map will be returned instead of nil.
 func sliceToMap(slice []kv) (m map[string]string) {
 	if size := len(slice); size == 0 {
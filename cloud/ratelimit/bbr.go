@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBBRWindow       = 10 * time.Second
+	defaultBBRBuckets      = 100
+	defaultBBRCPUThreshold = 800
+	defaultBBRCoolDown     = time.Second
+)
+
+// BBROptions configures a BBR shedder, zero fields use the defaults.
+type BBROptions struct {
+	// Window is the time range of the pass and rt statistics, 10s by default.
+	Window time.Duration
+	// Buckets is the number of buckets the window is divided into, 100 by default.
+	Buckets int
+	// CPUThreshold is the cpu usage in per mille above which requests may be shed, 800 by default.
+	CPUThreshold int64
+	// CoolDown keeps shedding for a while after the cpu usage drops, 1s by default.
+	CoolDown time.Duration
+	// CPU returns the cpu usage in per mille, CPUUsage by default.
+	CPU func() int64
+}
+
+type bbrBucket struct {
+	pass  int64
+	rtSum int64
+	start int64
+}
+
+// BBR is an adaptive load shedder inspired by TCP BBR. When the cpu usage is
+// high, it rejects requests once the in-flight requests exceed the estimated
+// capacity maxPass * minRT, which are the max passed requests and the min
+// average rt of the buckets in the window.
+type BBR struct {
+	opts       BBROptions
+	bucketTime int64
+
+	inflight int64
+	prevDrop int64 // unix nano of the first drop of the current overload
+
+	mu      sync.Mutex
+	buckets []bbrBucket
+}
+
+// NewBBR creates a BBR shedder.
+func NewBBR(opts BBROptions) *BBR {
+	if opts.Window <= 0 {
+		opts.Window = defaultBBRWindow
+	}
+	if opts.Buckets <= 0 {
+		opts.Buckets = defaultBBRBuckets
+	}
+	if opts.CPUThreshold <= 0 {
+		opts.CPUThreshold = defaultBBRCPUThreshold
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = defaultBBRCoolDown
+	}
+	if opts.CPU == nil {
+		opts.CPU = CPUUsage
+	}
+	return &BBR{
+		opts:       opts,
+		bucketTime: int64(opts.Window) / int64(opts.Buckets),
+		buckets:    make([]bbrBucket, opts.Buckets),
+	}
+}
+
+// bucket returns the bucket of now, it is reset if it belongs to an old window.
+func (b *BBR) bucket(now int64) *bbrBucket {
+	start := now - now%b.bucketTime
+	bk := &b.buckets[(now/b.bucketTime)%int64(len(b.buckets))]
+	if bk.start != start {
+		*bk = bbrBucket{start: start}
+	}
+	return bk
+}
+
+// maxInflight estimates the capacity with the finished buckets of the window.
+func (b *BBR) maxInflight(now int64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := now - now%b.bucketTime
+	oldest := current - int64(b.opts.Window)
+	var maxPass int64 = 1
+	minRT := math.MaxFloat64
+	for _, bk := range b.buckets {
+		if bk.start >= current || bk.start <= oldest || bk.pass == 0 {
+			continue
+		}
+		if bk.pass > maxPass {
+			maxPass = bk.pass
+		}
+		if rt := float64(bk.rtSum) / float64(bk.pass); rt < minRT {
+			minRT = rt
+		}
+	}
+	if minRT == math.MaxFloat64 {
+		minRT = 1
+	}
+	perSecond := float64(time.Second) / float64(b.bucketTime)
+	return int64(math.Ceil(float64(maxPass) * minRT / float64(time.Second) * perSecond))
+}
+
+func (b *BBR) shouldDrop(now int64) bool {
+	inflight := atomic.LoadInt64(&b.inflight)
+	if b.opts.CPU() < b.opts.CPUThreshold {
+		prev := atomic.LoadInt64(&b.prevDrop)
+		if prev == 0 {
+			return false
+		}
+		if now-prev <= int64(b.opts.CoolDown) {
+			return inflight > 1 && inflight > b.maxInflight(now)
+		}
+		atomic.StoreInt64(&b.prevDrop, 0)
+		return false
+	}
+
+	drop := inflight > 1 && inflight > b.maxInflight(now)
+	if drop {
+		atomic.CompareAndSwapInt64(&b.prevDrop, 0, now)
+	}
+	return drop
+}
+
+// Allow checks whether a request is allowed. If so, done must be called when
+// the request finishes, otherwise err is ErrLimited.
+func (b *BBR) Allow() (done func(), err error) {
+	start := time.Now().UnixNano()
+	if b.shouldDrop(start) {
+		return nil, ErrLimited
+	}
+
+	atomic.AddInt64(&b.inflight, 1)
+	return func() {
+		now := time.Now().UnixNano()
+		atomic.AddInt64(&b.inflight, -1)
+
+		b.mu.Lock()
+		bk := b.bucket(now)
+		bk.pass++
+		bk.rtSum += now - start
+		b.mu.Unlock()
+	}, nil
+}
+
+// Stat is the current statistics of a BBR shedder.
+type Stat struct {
+	CPU         int64
+	InFlight    int64
+	MaxInFlight int64
+}
+
+// Stat returns the current statistics.
+func (b *BBR) Stat() Stat {
+	return Stat{
+		CPU:         b.opts.CPU(),
+		InFlight:    atomic.LoadInt64(&b.inflight),
+		MaxInFlight: b.maxInflight(time.Now().UnixNano()),
+	}
+}
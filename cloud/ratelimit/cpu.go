@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cpuSampleInterval = 250 * time.Millisecond
+	cpuDecay          = 0.95
+)
+
+var (
+	cpuOnce  sync.Once
+	cpuUsage int64
+)
+
+// CPUUsage returns the cpu usage of the process in per mille of GOMAXPROCS,
+// it is a moving average sampled every 250ms, 0 if unsupported.
+func CPUUsage() int64 {
+	cpuOnce.Do(func() {
+		go sampleCPU()
+	})
+	return atomic.LoadInt64(&cpuUsage)
+}
+
+func sampleCPU() {
+	lastCPU, ok := processCPUTime()
+	if !ok {
+		return
+	}
+	lastTime := time.Now()
+	var avg float64
+
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		cpu, _ := processCPUTime()
+		wall := now.Sub(lastTime) * time.Duration(runtime.GOMAXPROCS(0))
+		if wall > 0 {
+			usage := float64(cpu-lastCPU) / float64(wall) * 1000
+			if usage > 1000 {
+				usage = 1000
+			}
+			avg = avg*cpuDecay + usage*(1-cpuDecay)
+			atomic.StoreInt64(&cpuUsage, int64(avg))
+		}
+		lastCPU, lastTime = cpu, now
+	}
+}
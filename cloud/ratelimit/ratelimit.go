@@ -0,0 +1,99 @@
+// Package ratelimit provides local and distributed rate limiters and an
+// adaptive load shedder.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cache/lrucache"
+)
+
+// ErrLimited is returned when a request is rejected by a limiter or shedder.
+var ErrLimited = errors.New("ratelimit: rate limited")
+
+// Limiter limits requests by key, such as user id or client ip.
+// Use an empty key if there is no need to distinguish.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (bool, error)
+}
+
+// Allower is a local limiter without key.
+type Allower interface {
+	Allow() bool
+}
+
+type global struct {
+	a Allower
+}
+
+// Global returns a Limiter sharing a for all keys.
+func Global(a Allower) Limiter {
+	return global{a: a}
+}
+
+func (g global) Allow(context.Context, string) (bool, error) {
+	return g.a.Allow(), nil
+}
+
+type perKey struct {
+	newFn   func() Allower
+	ttl     int64
+	mask    uint32
+	buckets []perKeyBucket
+}
+
+type perKeyBucket struct {
+	mu    sync.Mutex
+	cache *lrucache.LRUCache
+}
+
+type perKeyEntry struct {
+	a    Allower
+	last int64
+}
+
+// PerKey returns a Limiter creating a local limiter with newFn for each key.
+// At most about capacity keys are kept, the least recently used ones are evicted,
+// and a limiter is recreated if its key is not used for ttl (never if ttl <= 0),
+// so ttl should be longer than the time the limiter needs to become full again.
+func PerKey(newFn func() Allower, capacity int, ttl time.Duration) Limiter {
+	const buckets = 16
+	size := capacity / buckets
+	if size < 1 {
+		size = 1
+	}
+	p := &perKey{
+		newFn:   newFn,
+		ttl:     int64(ttl),
+		mask:    buckets - 1,
+		buckets: make([]perKeyBucket, buckets),
+	}
+	for i := range p.buckets {
+		p.buckets[i].cache = lrucache.New(size)
+	}
+	return p
+}
+
+func (p *perKey) Allow(_ context.Context, key string) (bool, error) {
+	b := &p.buckets[crc32.ChecksumIEEE([]byte(key))&p.mask]
+	now := time.Now().UnixNano()
+
+	// created under the bucket lock so concurrent first requests of a key share one limiter
+	b.mu.Lock()
+	var e *perKeyEntry
+	if v, ok := b.cache.Get(key); ok {
+		e = v.(*perKeyEntry)
+	}
+	if e == nil || (p.ttl > 0 && now-e.last >= p.ttl) {
+		e = &perKeyEntry{a: p.newFn()}
+		b.cache.Put(key, e)
+	}
+	e.last = now
+	b.mu.Unlock()
+
+	return e.a.Allow(), nil
+}
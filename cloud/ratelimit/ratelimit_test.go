@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/database/redis"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(10, 5)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.True(t, tb.AllowN(now, 1))
+	}
+	assert.False(t, tb.AllowN(now, 1))
+
+	// 10 tokens per second
+	now = now.Add(250 * time.Millisecond)
+	assert.True(t, tb.AllowN(now, 2))
+	assert.False(t, tb.AllowN(now, 1))
+
+	// never more than burst
+	now = now.Add(time.Hour)
+	assert.False(t, tb.AllowN(now, 6))
+	assert.True(t, tb.AllowN(now, 5))
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow(3, 200*time.Millisecond, 4)
+	assert.True(t, w.Allow())
+	assert.True(t, w.AllowN(2))
+	assert.False(t, w.Allow())
+
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, w.AllowN(3))
+	assert.False(t, w.Allow())
+}
+
+func TestPerKey(t *testing.T) {
+	l := PerKey(func() Allower { return NewTokenBucket(0.001, 1) }, 100, time.Minute)
+	ctx := context.Background()
+
+	ok, err := l.Allow(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = l.Allow(ctx, "a")
+	assert.False(t, ok)
+	ok, _ = l.Allow(ctx, "b")
+	assert.True(t, ok)
+
+	g := Global(NewTokenBucket(0.001, 1))
+	ok, _ = g.Allow(ctx, "a")
+	assert.True(t, ok)
+	ok, _ = g.Allow(ctx, "b")
+	assert.False(t, ok)
+}
+
+func TestRedisLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := redis.NewClient("redis://" + mr.Addr())
+	defer c.Close()
+	ctx := context.Background()
+
+	for _, args := range [][2]float64{{0, 1}, {-1, 1}, {math.NaN(), 1}, {math.Inf(1), 1}, {1, 0}} {
+		assert.Panics(t, func() { NewRedisLimiter(c, "rl:", args[0], int(args[1])) })
+	}
+
+	l := NewRedisLimiter(c, "rl:", 1, 3)
+	for i := 0; i < 3; i++ {
+		ok, err := l.Allow(ctx, "user")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := l.Allow(ctx, "user")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, _ = l.AllowN(ctx, "other", 3)
+	assert.True(t, ok)
+	assert.True(t, mr.Exists("rl:other"))
+	assert.True(t, mr.TTL("rl:other") > 0)
+}
+
+func TestBBR(t *testing.T) {
+	var cpu int64
+	b := NewBBR(BBROptions{
+		Window:  time.Second,
+		Buckets: 10,
+		CPU:     func() int64 { return atomic.LoadInt64(&cpu) },
+	})
+
+	// warm up with 10ms requests, one at a time
+	for i := 0; i < 20; i++ {
+		done, err := b.Allow()
+		assert.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		done()
+	}
+	max := b.Stat().MaxInFlight
+	assert.True(t, max >= 1)
+
+	// low cpu never sheds
+	var dones []func()
+	for i := int64(0); i < max+5; i++ {
+		done, err := b.Allow()
+		assert.NoError(t, err)
+		dones = append(dones, done)
+	}
+
+	atomic.StoreInt64(&cpu, 900)
+	_, err := b.Allow()
+	assert.Equal(t, ErrLimited, err)
+
+	// keeps shedding for the cool down even if cpu drops
+	atomic.StoreInt64(&cpu, 100)
+	_, err = b.Allow()
+	assert.Equal(t, ErrLimited, err)
+
+	var wg sync.WaitGroup
+	for _, done := range dones {
+		wg.Add(1)
+		go func(done func()) {
+			defer wg.Done()
+			done()
+		}(done)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(0), b.Stat().InFlight)
+
+	done, err := b.Allow()
+	assert.NoError(t, err)
+	done()
+}
+
+func TestCPUUsage(t *testing.T) {
+	assert.True(t, CPUUsage() >= 0)
+}
+
+func TestPerKeyTTL(t *testing.T) {
+	var created int32
+	l := PerKey(func() Allower {
+		atomic.AddInt32(&created, 1)
+		return NewTokenBucket(0.001, 1)
+	}, 100, 50*time.Millisecond)
+	ctx := context.Background()
+
+	// 并发的第一次请求共用一个limiter
+	var wg sync.WaitGroup
+	var allowed int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.Allow(ctx, "a"); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&allowed))
+
+	// 一直在访问的key不会因为ttl重新创建
+	for i := 0; i < 4; i++ {
+		time.Sleep(20 * time.Millisecond)
+		ok, _ := l.Allow(ctx, "a")
+		assert.False(t, ok)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+
+	// 空闲超过ttl后重新创建
+	time.Sleep(60 * time.Millisecond)
+	ok, _ := l.Allow(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&created))
+}
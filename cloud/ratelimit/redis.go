@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/database/redis"
+)
+
+// tokenBucketScript is a token bucket shared by all instances, redis TIME is used
+// as the clock so instances with skewed clocks behave the same.
+var tokenBucketScript = gredis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local v = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(v[1])
+local ts = tonumber(v[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local allowed = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return allowed
+`)
+
+// RedisLimiter is a distributed token bucket limiter shared by all instances.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+	rate   float64
+	burst  int
+	ttl    int64
+}
+
+var _ Limiter = (*RedisLimiter)(nil)
+
+// NewRedisLimiter creates a distributed token bucket limiter, the bucket of key is
+// stored in redis as prefix+key. Tokens are added at rate per second up to burst,
+// it panics if rate or burst is not positive.
+func NewRedisLimiter(c *redis.Client, prefix string, rate float64, burst int) *RedisLimiter {
+	if !(rate > 0) || math.IsInf(rate, 1) || burst <= 0 {
+		panic(fmt.Sprintf("ratelimit: invalid redis limiter rate(%v) burst(%d)", rate, burst))
+	}
+	// keep the bucket until it is full again
+	ttl := int64(math.Ceil(float64(burst)/rate*1000)) + 1000
+	return &RedisLimiter{
+		client: c,
+		prefix: prefix,
+		rate:   rate,
+		burst:  burst,
+		ttl:    ttl,
+	}
+}
+
+// Allow reports whether a request of key can happen now.
+func (l *RedisLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n requests of key can happen now.
+func (l *RedisLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, l.rate, l.burst, n, l.ttl).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket is a local token bucket limiter. Tokens are added at rate per
+// second up to burst, each request takes one token.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full token bucket.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow reports whether a request can happen now.
+func (t *TokenBucket) Allow() bool {
+	return t.AllowN(time.Now(), 1)
+}
+
+// AllowN reports whether n requests can happen at now.
+func (t *TokenBucket) AllowN(now time.Time, n int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if elapsed := now.Sub(t.last); elapsed > 0 {
+		t.tokens += elapsed.Seconds() * t.rate
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+		t.last = now
+	}
+	if t.tokens < float64(n) {
+		return false
+	}
+	t.tokens -= float64(n)
+	return true
+}
+
+// Tokens returns the number of available tokens.
+func (t *TokenBucket) Tokens() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/stat/counter"
+)
+
+const defaultWindowBuckets = 10
+
+// SlidingWindow is a local limiter allowing at most limit requests in any window,
+// it is based on the rolling counter of stat/counter.
+type SlidingWindow struct {
+	mu    sync.Mutex
+	limit int64
+	c     counter.Counter
+}
+
+// NewSlidingWindow creates a sliding window limiter, the window is divided into
+// buckets, 10 buckets if buckets <= 0. More buckets make it more precise.
+func NewSlidingWindow(limit int64, window time.Duration, buckets int) *SlidingWindow {
+	if buckets <= 0 {
+		buckets = defaultWindowBuckets
+	}
+	return &SlidingWindow{
+		limit: limit,
+		c:     counter.NewRolling(window, buckets),
+	}
+}
+
+// Allow reports whether a request can happen now.
+func (w *SlidingWindow) Allow() bool {
+	return w.AllowN(1)
+}
+
+// AllowN reports whether n requests can happen now.
+func (w *SlidingWindow) AllowN(n int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.c.Value()+n > w.limit {
+		return false
+	}
+	w.c.Add(n)
+	return true
+}
@@ -0,0 +1,58 @@
+package retry
+
+import (
+	"math/bits"
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the delay before the n-th retry, n starts from 1 and prev is
+// the delay before the previous retry, 0 for the first one.
+type Backoff func(n int, prev time.Duration) time.Duration
+
+// Constant waits d before each retry.
+func Constant(d time.Duration) Backoff {
+	return func(int, time.Duration) time.Duration {
+		return d
+	}
+}
+
+// Exponential waits base, 2*base, 4*base... up to max, with a random jitter of
+// up to a half of the delay to avoid retries in lockstep.
+func Exponential(base, max time.Duration) Backoff {
+	return func(n int, _ time.Duration) time.Duration {
+		if n < 1 {
+			n = 1
+		}
+		d := max
+		// base<<(n-1) is at most max here, so the shift never overflows
+		if base > 0 && base < max && n-1 < bits.Len64(uint64(max/base)) {
+			if e := base << uint(n-1); e < max {
+				d = e
+			}
+		}
+		if half := int64(d / 2); half > 0 {
+			d = d - time.Duration(half) + time.Duration(rand.Int63n(half+1))
+		}
+		return d
+	}
+}
+
+// DecorrelatedJitter waits a random delay between base and three times the
+// previous delay, capped at max. It spreads retries better than Exponential.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func DecorrelatedJitter(base, max time.Duration) Backoff {
+	return func(_ int, prev time.Duration) time.Duration {
+		if prev < base {
+			prev = base
+		}
+		d := base
+		if span := int64(prev*3 - base); span > 0 {
+			d += time.Duration(rand.Int63n(span))
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
@@ -0,0 +1,48 @@
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/stat/counter"
+)
+
+// Budget limits retries to a ratio of the requests in a rolling window to
+// prevent retry storms when the downstream is overloaded. A budget is usually
+// shared by all calls to the same downstream.
+type Budget struct {
+	mu         sync.Mutex
+	ratio      float64
+	minRetries int64
+	requests   counter.Counter
+	retries    counter.Counter
+}
+
+// NewBudget creates a budget allowing retries up to ratio of the requests in
+// window, plus minPerSecond retries per second so low traffic can still retry.
+func NewBudget(ratio float64, minPerSecond int, window time.Duration) *Budget {
+	return &Budget{
+		ratio:      ratio,
+		minRetries: int64(float64(minPerSecond) * window.Seconds()),
+		requests:   counter.NewRolling(window, 10),
+		retries:    counter.NewRolling(window, 10),
+	}
+}
+
+// Request records a request, it is called once per Do.
+func (b *Budget) Request() {
+	b.requests.Add(1)
+}
+
+// Retry withdraws a retry from the budget, it returns false if the budget is exhausted.
+func (b *Budget) Retry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	allowed := b.minRetries + int64(b.ratio*float64(b.requests.Value()))
+	if b.retries.Value() >= allowed {
+		return false
+	}
+	b.retries.Add(1)
+	return true
+}
@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/aaabigfish/gopkg/ecode"
+)
+
+// Classifier reports whether an error is retryable.
+type Classifier func(err error) bool
+
+type unrecoverable struct {
+	err error
+}
+
+func (e unrecoverable) Error() string { return e.err.Error() }
+func (e unrecoverable) Unwrap() error { return e.err }
+
+// Unrecoverable wraps err so that it is never retried.
+func Unrecoverable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return unrecoverable{err: err}
+}
+
+// IsUnrecoverable reports whether err is wrapped by Unrecoverable.
+func IsUnrecoverable(err error) bool {
+	return errors.As(err, &unrecoverable{})
+}
+
+// All retries every error except context cancellation and deadline, it is the default.
+func All() Classifier {
+	return func(err error) bool {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+}
+
+// Codes retries errors which are one of the ecode codes.
+func Codes(codes ...ecode.ECode) Classifier {
+	set := make(map[ecode.ECode]struct{}, len(codes))
+	for _, c := range codes {
+		set[c] = struct{}{}
+	}
+	return func(err error) bool {
+		var code ecode.ECode
+		if !errors.As(err, &code) {
+			return false
+		}
+		_, ok := set[code]
+		return ok
+	}
+}
+
+// NetErrors retries transient network errors: timeouts, refused or reset
+// connections and unexpected EOF.
+func NetErrors() Classifier {
+	return IsNetError
+}
+
+// IsNetError reports whether err is a transient network error.
+func IsNetError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe)
+}
+
+// Any retries an error if any of the classifiers does.
+func Any(cs ...Classifier) Classifier {
+	return func(err error) bool {
+		for _, c := range cs {
+			if c(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
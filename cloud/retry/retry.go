@@ -0,0 +1,140 @@
+// Package retry retries operations with backoff, retry budgets and error
+// classification.
+//
+//	r := retry.New(
+//		retry.WithMaxAttempts(3),
+//		retry.WithBackoff(retry.DecorrelatedJitter(50*time.Millisecond, time.Second)),
+//		retry.WithRetryable(retry.Any(retry.NetErrors(), retry.Codes(ecode.TooManyRequests))),
+//	)
+//	err := r.Do(ctx, func(ctx context.Context) error {
+//		return call(ctx)
+//	})
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 3
+	defaultBaseDelay   = 100 * time.Millisecond
+	defaultMaxDelay    = 10 * time.Second
+)
+
+// Retrier retries operations, it is safe for concurrent use.
+type Retrier struct {
+	maxAttempts int
+	backoff     Backoff
+	retryable   Classifier
+	budget      *Budget
+	onRetry     func(attempt int, err error, delay time.Duration)
+}
+
+// Option configures a Retrier.
+type Option func(*Retrier)
+
+// WithMaxAttempts sets the max number of attempts including the first one, 3 by default.
+// 0 means no limit, the retries are then bounded by ctx.
+func WithMaxAttempts(n int) Option {
+	return func(r *Retrier) {
+		r.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the backoff between attempts, Exponential(100ms, 10s) by default.
+func WithBackoff(b Backoff) Option {
+	return func(r *Retrier) {
+		r.backoff = b
+	}
+}
+
+// WithRetryable sets the classifier of retryable errors, All() by default.
+// Errors wrapped by Unrecoverable are never retried.
+func WithRetryable(c Classifier) Option {
+	return func(r *Retrier) {
+		r.retryable = c
+	}
+}
+
+// WithBudget limits the retries with a budget.
+func WithBudget(b *Budget) Option {
+	return func(r *Retrier) {
+		r.budget = b
+	}
+}
+
+// WithOnRetry sets a callback called before each retry, e.g. for logging.
+func WithOnRetry(f func(attempt int, err error, delay time.Duration)) Option {
+	return func(r *Retrier) {
+		r.onRetry = f
+	}
+}
+
+// New creates a Retrier.
+func New(opts ...Option) *Retrier {
+	r := &Retrier{
+		maxAttempts: defaultMaxAttempts,
+		backoff:     Exponential(defaultBaseDelay, defaultMaxDelay),
+		retryable:   All(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Do calls fn until it succeeds, the error is not retryable, the attempts or
+// the budget are exhausted, or ctx is done. It returns the last error of fn.
+// A retry is not attempted if it would start after the deadline of ctx.
+func (r *Retrier) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.budget != nil {
+		r.budget.Request()
+	}
+
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || IsUnrecoverable(err) || !r.retryable(err) {
+			return err
+		}
+		if r.maxAttempts > 0 && attempt >= r.maxAttempts {
+			return err
+		}
+
+		delay = r.backoff(attempt, delay)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		if r.budget != nil && !r.budget.Retry() {
+			return err
+		}
+		if r.onRetry != nil {
+			r.onRetry(attempt, err, delay)
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// Do calls fn with a Retrier created with opts, see Retrier.Do.
+func Do(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) error {
+	return New(opts...).Do(ctx, fn)
+}
+
+// DoValue is like Retrier.Do but returns the value of the successful call.
+func DoValue[T any](ctx context.Context, r *Retrier, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := r.Do(ctx, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
@@ -0,0 +1,178 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/ecode"
+)
+
+var errTest = errors.New("test")
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	var retries []int
+	r := New(
+		WithMaxAttempts(3),
+		WithBackoff(Constant(time.Millisecond)),
+		WithOnRetry(func(attempt int, err error, delay time.Duration) {
+			retries = append(retries, attempt)
+		}),
+	)
+
+	n := 0
+	err := r.Do(ctx, func(context.Context) error {
+		n++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []int{1, 2}, retries)
+
+	n = 0
+	err = r.Do(ctx, func(context.Context) error {
+		if n++; n < 2 {
+			return errTest
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n = 0
+	err = r.Do(ctx, func(context.Context) error {
+		n++
+		return Unrecoverable(errTest)
+	})
+	assert.ErrorIs(t, err, errTest)
+	assert.Equal(t, 1, n)
+
+	v, err := DoValue(ctx, r, func(context.Context) (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	n := 0
+	start := time.Now()
+	err := Do(ctx, func(context.Context) error {
+		n++
+		return errTest
+	}, WithMaxAttempts(0), WithBackoff(Constant(20*time.Millisecond)))
+	assert.Equal(t, errTest, err)
+	assert.True(t, n >= 2 && n <= 3, "n=%d", n)
+	// gives up before the deadline instead of waiting for it
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	// canceled while waiting
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	n = 0
+	err = Do(ctx, func(context.Context) error {
+		n++
+		return errTest
+	}, WithBackoff(Constant(time.Hour)))
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestBackoff(t *testing.T) {
+	exp := Exponential(10*time.Millisecond, 100*time.Millisecond)
+	for n, max := range []time.Duration{10, 20, 40, 80, 100, 100} {
+		max *= time.Millisecond
+		d := exp(n+1, 0)
+		assert.True(t, d >= max/2 && d <= max, "n=%d d=%v", n+1, d)
+	}
+	// no overflow
+	d := exp(100, 0)
+	assert.True(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond)
+	exp = Exponential(100*time.Millisecond, 30*time.Second)
+	for n := 1; n < 200; n++ {
+		d := exp(n, 0)
+		assert.True(t, d >= 50*time.Millisecond && d <= 30*time.Second, "n=%d d=%v", n, d)
+		if n > 10 {
+			assert.True(t, d >= 15*time.Second, "n=%d d=%v", n, d)
+		}
+	}
+	assert.True(t, exp(0, 0) <= 100*time.Millisecond)
+	// base <= 0 or base >= max waits max
+	for _, exp := range []Backoff{Exponential(0, time.Second), Exponential(2*time.Second, time.Second)} {
+		d := exp(1, 0)
+		assert.True(t, d >= 500*time.Millisecond && d <= time.Second, d)
+	}
+
+	dj := DecorrelatedJitter(10*time.Millisecond, 100*time.Millisecond)
+	var prev time.Duration
+	for i := 1; i < 20; i++ {
+		d := dj(i, prev)
+		assert.True(t, d >= 10*time.Millisecond && d <= 100*time.Millisecond)
+		assert.True(t, prev == 0 || d <= prev*3)
+		prev = d
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(0.5, 0, time.Second)
+	assert.False(t, b.Retry())
+
+	for i := 0; i < 4; i++ {
+		b.Request()
+	}
+	assert.True(t, b.Retry())
+	assert.True(t, b.Retry())
+	assert.False(t, b.Retry())
+
+	r := New(WithBudget(NewBudget(0, 1, time.Second)), WithMaxAttempts(5), WithBackoff(Constant(0)))
+	n := 0
+	r.Do(context.Background(), func(context.Context) error {
+		n++
+		return errTest
+	})
+	assert.Equal(t, 2, n)
+}
+
+func TestClassifier(t *testing.T) {
+	all := All()
+	assert.True(t, all(errTest))
+	assert.False(t, all(context.Canceled))
+	assert.False(t, all(fmt.Errorf("wrap: %w", context.DeadlineExceeded)))
+
+	codes := Codes(ecode.TooManyRequests)
+	assert.True(t, codes(ecode.TooManyRequests))
+	assert.True(t, codes(fmt.Errorf("wrap: %w", ecode.TooManyRequests)))
+	assert.False(t, codes(ecode.InvalidParam))
+	assert.False(t, codes(errTest))
+
+	ne := NetErrors()
+	assert.True(t, ne(io.ErrUnexpectedEOF))
+	assert.True(t, ne(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+	assert.True(t, ne(fmt.Errorf("wrap: %w", syscall.ECONNRESET)))
+	assert.False(t, ne(errTest))
+	assert.False(t, ne(context.Canceled))
+
+	any := Any(codes, ne)
+	assert.True(t, any(ecode.TooManyRequests))
+	assert.True(t, any(io.ErrUnexpectedEOF))
+	assert.False(t, any(errTest))
+
+	n := 0
+	Do(context.Background(), func(context.Context) error {
+		n++
+		return ecode.InvalidParam
+	}, WithRetryable(codes), WithBackoff(Constant(0)))
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,195 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+const (
+	defaultQueueSize     = 2048
+	defaultBatchSize     = 512
+	defaultBatchInterval = 5 * time.Second
+	defaultExportTimeout = 30 * time.Second
+)
+
+type batchConfig struct {
+	queueSize     int
+	batchSize     int
+	interval      time.Duration
+	exportTimeout time.Duration
+}
+
+// BatchOption configures the batching of WithExporter.
+type BatchOption func(*batchConfig)
+
+// WithQueueSize sets the max number of spans waiting to be exported, spans beyond it are dropped.
+func WithQueueSize(n int) BatchOption {
+	return func(c *batchConfig) {
+		c.queueSize = n
+	}
+}
+
+// WithBatchSize sets the max number of spans of one export.
+func WithBatchSize(n int) BatchOption {
+	return func(c *batchConfig) {
+		c.batchSize = n
+	}
+}
+
+// WithBatchInterval sets the max delay before waiting spans are exported.
+func WithBatchInterval(d time.Duration) BatchOption {
+	return func(c *batchConfig) {
+		c.interval = d
+	}
+}
+
+// WithExportTimeout sets the timeout of one export.
+func WithExportTimeout(d time.Duration) BatchOption {
+	return func(c *batchConfig) {
+		c.exportTimeout = d
+	}
+}
+
+type batcher struct {
+	c        batchConfig
+	exporter Exporter
+	queue    chan SpanData
+	flushc   chan chan struct{}
+	quitc    chan struct{}
+	wg       sync.WaitGroup
+	dropped  uint64
+}
+
+func newBatcher(e Exporter, opts ...BatchOption) *batcher {
+	c := batchConfig{
+		queueSize:     defaultQueueSize,
+		batchSize:     defaultBatchSize,
+		interval:      defaultBatchInterval,
+		exportTimeout: defaultExportTimeout,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.batchSize > c.queueSize {
+		c.batchSize = c.queueSize
+	}
+
+	return &batcher{
+		c:        c,
+		exporter: e,
+		queue:    make(chan SpanData, c.queueSize),
+		flushc:   make(chan chan struct{}),
+		quitc:    make(chan struct{}),
+	}
+}
+
+func (b *batcher) start() {
+	b.wg.Add(1)
+	go b.loop()
+}
+
+func (b *batcher) enqueue(s SpanData) {
+	select {
+	case b.queue <- s:
+	default:
+		atomic.AddUint64(&b.dropped, 1)
+	}
+}
+
+func (b *batcher) loop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.c.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, b.c.batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.c.exportTimeout)
+		if err := b.exporter.Export(ctx, batch); err != nil {
+			logError(err)
+		}
+		cancel()
+		batch = make([]SpanData, 0, b.c.batchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-b.queue:
+				batch = append(batch, s)
+				if len(batch) >= b.c.batchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-b.queue:
+			batch = append(batch, s)
+			if len(batch) >= b.c.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-b.flushc:
+			drain()
+			close(done)
+		case <-b.quitc:
+			drain()
+			return
+		}
+	}
+}
+
+func (b *batcher) flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case b.flushc <- done:
+	case <-b.quitc:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *batcher) stop(ctx context.Context) error {
+	close(b.quitc)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if n := atomic.LoadUint64(&b.dropped); n > 0 {
+		log.Warnf("trace: %d spans dropped, queue size %d", n, b.c.queueSize)
+	}
+	return b.exporter.Shutdown(ctx)
+}
+
+func logError(err error) {
+	log.Errorf("trace: export spans err(%v)", err)
+}
@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryExporter keeps exported spans in memory, it is intended for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewMemoryExporter creates a MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// Export implements the Exporter interface.
+func (e *MemoryExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+// Shutdown implements the Exporter interface.
+func (e *MemoryExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// Spans returns the exported spans in export order.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset drops the exported spans.
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// StdoutExporter writes one json line per span.
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutExporter creates a StdoutExporter writing to w, os.Stdout if w is nil.
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutExporter{w: w}
+}
+
+type jsonEvent struct {
+	Name       string                 `json:"name"`
+	Time       time.Time              `json:"time"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type jsonSpan struct {
+	Name         string                 `json:"name"`
+	Service      string                 `json:"service,omitempty"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	TraceState   string                 `json:"trace_state,omitempty"`
+	Kind         string                 `json:"kind"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	DurationMs   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Events       []jsonEvent            `json:"events,omitempty"`
+	Status       string                 `json:"status"`
+	StatusMsg    string                 `json:"status_message,omitempty"`
+}
+
+func attributesMap(attrs []Attribute) map[string]interface{} {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+// Export implements the Exporter interface.
+func (e *StdoutExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		js := &jsonSpan{
+			Name:       s.Name,
+			Service:    s.Service,
+			TraceID:    s.SpanContext.TraceID.String(),
+			SpanID:     s.SpanContext.SpanID.String(),
+			TraceState: s.SpanContext.TraceState,
+			Kind:       s.Kind.String(),
+			StartTime:  s.StartTime,
+			EndTime:    s.EndTime,
+			DurationMs: float64(s.EndTime.Sub(s.StartTime)) / float64(time.Millisecond),
+			Attributes: attributesMap(s.Attributes),
+			Status:     s.Status.Code.String(),
+			StatusMsg:  s.Status.Message,
+		}
+		if s.ParentSpanID.IsValid() {
+			js.ParentSpanID = s.ParentSpanID.String()
+		}
+		for _, ev := range s.Events {
+			js.Events = append(js.Events, jsonEvent{Name: ev.Name, Time: ev.Time, Attributes: attributesMap(ev.Attributes)})
+		}
+		if err := enc.Encode(js); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown implements the Exporter interface.
+func (e *StdoutExporter) Shutdown(context.Context) error {
+	return nil
+}
@@ -0,0 +1,223 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+// Kind is the role of a span in a trace.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	case KindProducer:
+		return "producer"
+	case KindConsumer:
+		return "consumer"
+	default:
+		return "internal"
+	}
+}
+
+// StatusCode is the status of a finished span.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+func (c StatusCode) String() string {
+	switch c {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	default:
+		return "unset"
+	}
+}
+
+// Status is the status code and description of a span.
+type Status struct {
+	Code    StatusCode
+	Message string
+}
+
+// Attribute is a key-value pair describing a span or an event.
+// Value should be a string, bool, integer or float.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(k, v string) Attribute          { return Attribute{Key: k, Value: v} }
+func Bool(k string, v bool) Attribute       { return Attribute{Key: k, Value: v} }
+func Int(k string, v int) Attribute         { return Attribute{Key: k, Value: int64(v)} }
+func Int64(k string, v int64) Attribute     { return Attribute{Key: k, Value: v} }
+func Float64(k string, v float64) Attribute { return Attribute{Key: k, Value: v} }
+
+// Event is a time-stamped annotation of a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// SpanData is the snapshot of an ended span passed to exporters.
+type SpanData struct {
+	Name         string
+	Service      string
+	SpanContext  metainfo.SpanContext
+	ParentSpanID metainfo.W3CSpanID
+	Kind         Kind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   []Attribute
+	Events       []Event
+	Status       Status
+}
+
+// Span is an operation of a trace. A nil *Span is valid and does nothing,
+// it is returned by Start when tracing is disabled.
+type Span struct {
+	mu    sync.Mutex
+	p     *Provider
+	data  SpanData
+	ended bool
+}
+
+type spanCtxKeyType struct{}
+
+var spanCtxKey spanCtxKeyType
+
+// FromContext returns the current span of ctx or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanCtxKey).(*Span)
+	return s
+}
+
+// SpanContext returns the propagated part of the span.
+func (s *Span) SpanContext() metainfo.SpanContext {
+	if s == nil {
+		return metainfo.SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// IsRecording reports whether the span will be exported when it ends.
+func (s *Span) IsRecording() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.ended && s.data.SpanContext.IsSampled()
+}
+
+// SetName overrides the name given to Start.
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes sets attributes, an attribute with an existing key overrides the old value.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = mergeAttributes(s.data.Attributes, attrs)
+	s.mu.Unlock()
+}
+
+// AddEvent records an event at the current time.
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+	s.mu.Unlock()
+}
+
+// SetStatus sets the status of the span, StatusOK can not be overridden.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.data.Status.Code != StatusOK {
+		s.data.Status = Status{Code: code, Message: msg}
+	}
+	s.mu.Unlock()
+}
+
+// RecordError records err as an exception event and sets the status to error.
+func (s *Span) RecordError(err error) {
+	if err == nil || !s.IsRecording() {
+		return
+	}
+	s.AddEvent("exception", String("exception.message", err.Error()))
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and hands it to the exporters, calls after the first one are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() {
+		s.p.export(data)
+	}
+}
+
+func mergeAttributes(dst, src []Attribute) []Attribute {
+	for _, a := range src {
+		replaced := false
+		for i := range dst {
+			if dst[i].Key == a.Key {
+				dst[i].Value = a.Value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst = append(dst, a)
+		}
+	}
+	return dst
+}
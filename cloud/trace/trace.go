@@ -0,0 +1,246 @@
+// Package trace is a lightweight distributed tracing subsystem.
+// Spans are propagated with cloud/metainfo, so the trace context crosses
+// HTTP, gRPC and mq boundaries together with the other meta information.
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/config"
+)
+
+// Exporter sends ended spans to a backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Sampler decides whether a new trace is sampled, child spans follow their parent.
+type Sampler func(traceID metainfo.W3CTraceID) bool
+
+// AlwaysSample samples every trace.
+func AlwaysSample() Sampler {
+	return func(metainfo.W3CTraceID) bool { return true }
+}
+
+// NeverSample samples no trace.
+func NeverSample() Sampler {
+	return func(metainfo.W3CTraceID) bool { return false }
+}
+
+// RatioSample samples the given fraction of traces based on the trace id.
+func RatioSample(ratio float64) Sampler {
+	if ratio >= 1 {
+		return AlwaysSample()
+	}
+	if ratio <= 0 {
+		return NeverSample()
+	}
+	bound := uint64(ratio * (1 << 63))
+	return func(id metainfo.W3CTraceID) bool {
+		var x uint64
+		for _, b := range id[8:] {
+			x = x<<8 | uint64(b)
+		}
+		return x>>1 < bound
+	}
+}
+
+// Provider creates spans and dispatches the ended ones to its exporters.
+type Provider struct {
+	service  string
+	sampler  Sampler
+	syncers  []Exporter
+	batchers []*batcher
+	shutdown int32
+}
+
+// Option configures a Provider.
+type Option func(*Provider)
+
+// WithServiceName sets the service name of spans, config.App by default.
+func WithServiceName(name string) Option {
+	return func(p *Provider) {
+		p.service = name
+	}
+}
+
+// WithSampler sets the sampler of new traces, AlwaysSample by default.
+func WithSampler(s Sampler) Option {
+	return func(p *Provider) {
+		p.sampler = s
+	}
+}
+
+// WithSyncer exports every span synchronously when it ends, mainly for tests and debugging.
+func WithSyncer(e Exporter) Option {
+	return func(p *Provider) {
+		p.syncers = append(p.syncers, e)
+	}
+}
+
+// WithExporter exports spans in batches in background.
+func WithExporter(e Exporter, opts ...BatchOption) Option {
+	return func(p *Provider) {
+		p.batchers = append(p.batchers, newBatcher(e, opts...))
+	}
+}
+
+// NewProvider creates a Provider, spans are only created if it has at least one exporter.
+func NewProvider(opts ...Option) *Provider {
+	p := &Provider{
+		service: config.App,
+		sampler: AlwaysSample(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	for _, b := range p.batchers {
+		b.start()
+	}
+	return p
+}
+
+var global atomic.Value
+
+// SetProvider sets the provider used by Start.
+func SetProvider(p *Provider) {
+	global.Store(p)
+}
+
+// GetProvider returns the provider used by Start, it may be nil.
+func GetProvider() *Provider {
+	p, _ := global.Load().(*Provider)
+	return p
+}
+
+// Start starts a span with the global provider, see Provider.Start.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	return GetProvider().Start(ctx, name, opts...)
+}
+
+// StartChild starts a span with the global provider only if ctx already has a valid span context,
+// otherwise ctx is returned as is with a nil span. Client integrations use it so that calls outside
+// of a trace, like polling loops and background jobs, do not create a root span each.
+func StartChild(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	if sc, ok := metainfo.GetSpanContext(ctx); !ok || !sc.IsValid() {
+		return ctx, nil
+	}
+	return Start(ctx, name, opts...)
+}
+
+type startConfig struct {
+	kind  Kind
+	attrs []Attribute
+}
+
+// StartOption configures a span.
+type StartOption func(*startConfig)
+
+// WithKind sets the kind of the span, KindInternal by default.
+func WithKind(k Kind) StartOption {
+	return func(c *startConfig) {
+		c.kind = k
+	}
+}
+
+// WithAttributes sets the initial attributes of the span.
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(c *startConfig) {
+		c.attrs = append(c.attrs, attrs...)
+	}
+}
+
+func (p *Provider) enabled() bool {
+	return p != nil && len(p.syncers)+len(p.batchers) > 0 && atomic.LoadInt32(&p.shutdown) == 0
+}
+
+// Start starts a child span of the span in ctx, or a new trace if there is none.
+// The span context is stored in ctx with metainfo.WithSpanContext so it is propagated by
+// the metainfo carriers. If the provider is nil or has no exporter, ctx is returned as is
+// with a nil span.
+func (p *Provider) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	if ctx == nil || !p.enabled() {
+		return ctx, nil
+	}
+
+	cfg := &startConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	parent, hasParent := metainfo.GetSpanContext(ctx)
+	hasParent = hasParent && parent.IsValid()
+	ctx, sc := metainfo.StartSpan(ctx)
+	if !hasParent && !p.sampler(sc.TraceID) {
+		sc.Flags &^= metainfo.FlagSampled
+		ctx = metainfo.WithSpanContext(ctx, sc)
+	}
+
+	s := &Span{
+		p: p,
+		data: SpanData{
+			Name:        name,
+			Service:     p.service,
+			SpanContext: sc,
+			Kind:        cfg.kind,
+			StartTime:   time.Now(),
+			Attributes:  mergeAttributes(nil, cfg.attrs),
+		},
+	}
+	if hasParent {
+		s.data.ParentSpanID = parent.SpanID
+	}
+	return context.WithValue(ctx, spanCtxKey, s), s
+}
+
+func (p *Provider) export(s SpanData) {
+	if !p.enabled() {
+		return
+	}
+	for _, e := range p.syncers {
+		if err := e.Export(context.Background(), []SpanData{s}); err != nil {
+			logError(err)
+		}
+	}
+	for _, b := range p.batchers {
+		b.enqueue(s)
+	}
+}
+
+// ForceFlush exports all spans waiting in the batches.
+func (p *Provider) ForceFlush(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	for _, b := range p.batchers {
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown flushes the batches and shuts the exporters down, spans ended afterwards are dropped.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil || !atomic.CompareAndSwapInt32(&p.shutdown, 0, 1) {
+		return nil
+	}
+
+	var errs []error
+	for _, b := range p.batchers {
+		if err := b.stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, e := range p.syncers {
+		if err := e.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,221 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+func TestStartDisabled(t *testing.T) {
+	ctx := context.Background()
+	c, s := (*Provider)(nil).Start(ctx, "noop")
+	assert.Equal(t, ctx, c)
+	assert.Nil(t, s)
+
+	// methods of a nil span are no-ops
+	s.SetAttributes(String("k", "v"))
+	s.RecordError(errors.New("x"))
+	s.End()
+	assert.False(t, s.IsRecording())
+
+	c, s = NewProvider().Start(ctx, "no exporter")
+	assert.Equal(t, ctx, c)
+	assert.Nil(t, s)
+}
+
+func TestSpanLifecycle(t *testing.T) {
+	me := NewMemoryExporter()
+	p := NewProvider(WithSyncer(me), WithServiceName("svc"))
+
+	ctx, root := p.Start(context.Background(), "root", WithKind(KindServer), WithAttributes(Int("a", 1)))
+	assert.True(t, root.IsRecording())
+	assert.Equal(t, root, FromContext(ctx))
+	assert.Equal(t, root.SpanContext().TraceID.String(), metainfo.TraceID(ctx))
+
+	cctx, child := p.Start(ctx, "child")
+	child.SetAttributes(String("k", "v1"), String("k", "v2"))
+	child.AddEvent("hello", Bool("b", true))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	assert.False(t, child.IsRecording())
+	assert.Equal(t, metainfo.SpanID(cctx), child.SpanContext().SpanID.String())
+
+	root.SetStatus(StatusOK, "")
+	root.SetStatus(StatusError, "ignored")
+	root.End()
+
+	spans := me.Spans()
+	assert.Len(t, spans, 2)
+	c, r := spans[0], spans[1]
+	assert.Equal(t, "child", c.Name)
+	assert.Equal(t, "svc", c.Service)
+	assert.Equal(t, r.SpanContext.TraceID, c.SpanContext.TraceID)
+	assert.Equal(t, r.SpanContext.SpanID, c.ParentSpanID)
+	assert.Equal(t, []Attribute{String("k", "v2")}, c.Attributes)
+	assert.Len(t, c.Events, 2)
+	assert.Equal(t, "exception", c.Events[1].Name)
+	assert.Equal(t, Status{Code: StatusError, Message: "boom"}, c.Status)
+	assert.False(t, c.EndTime.Before(c.StartTime))
+
+	assert.Equal(t, KindServer, r.Kind)
+	assert.False(t, r.ParentSpanID.IsValid())
+	assert.Equal(t, []Attribute{Int("a", 1)}, r.Attributes)
+	assert.Equal(t, StatusOK, r.Status.Code)
+}
+
+func TestSampler(t *testing.T) {
+	me := NewMemoryExporter()
+	p := NewProvider(WithSyncer(me), WithSampler(NeverSample()))
+
+	ctx, root := p.Start(context.Background(), "root")
+	assert.False(t, root.IsRecording())
+	_, child := p.Start(ctx, "child")
+	assert.False(t, child.IsRecording())
+	assert.Equal(t, root.SpanContext().TraceID, child.SpanContext().TraceID)
+	child.End()
+	root.End()
+	assert.Len(t, me.Spans(), 0)
+
+	// remote parent decides
+	parent := metainfo.SpanContext{TraceID: metainfo.NewTraceID(), SpanID: metainfo.NewSpanID(), Flags: metainfo.FlagSampled}
+	_, s := p.Start(metainfo.WithSpanContext(context.Background(), parent), "remote")
+	assert.True(t, s.IsRecording())
+	s.End()
+	assert.Len(t, me.Spans(), 1)
+
+	n := 0
+	sampler := RatioSample(0.5)
+	for i := 0; i < 10000; i++ {
+		if sampler(metainfo.NewTraceID()) {
+			n++
+		}
+	}
+	assert.InDelta(t, 5000, n, 500)
+}
+
+func TestBatchExporter(t *testing.T) {
+	me := NewMemoryExporter()
+	p := NewProvider(WithExporter(me, WithBatchSize(10), WithBatchInterval(time.Hour)))
+
+	for i := 0; i < 25; i++ {
+		_, s := p.Start(context.Background(), "span")
+		s.End()
+	}
+	assert.Eventually(t, func() bool { return len(me.Spans()) == 20 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, p.ForceFlush(context.Background()))
+	assert.Len(t, me.Spans(), 25)
+
+	_, s := p.Start(context.Background(), "last")
+	s.End()
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Len(t, me.Spans(), 26)
+
+	// spans are dropped after shutdown
+	c, s := p.Start(context.Background(), "dropped")
+	assert.Nil(t, s)
+	assert.Equal(t, context.Background(), c)
+}
+
+func TestStdoutExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	p := NewProvider(WithSyncer(NewStdoutExporter(buf)), WithServiceName("svc"))
+	ctx, root := p.Start(context.Background(), "root")
+	_, child := p.Start(ctx, "child", WithKind(KindClient), WithAttributes(String("db.system", "redis")))
+	child.End()
+
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "child", m["name"])
+	assert.Equal(t, "svc", m["service"])
+	assert.Equal(t, "client", m["kind"])
+	assert.Equal(t, root.SpanContext().SpanID.String(), m["parent_span_id"])
+	assert.Equal(t, map[string]interface{}{"db.system": "redis"}, m["attributes"])
+	assert.Equal(t, "unset", m["status"])
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var got otlpRequest
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		assert.Equal(t, otlpTracesPath, r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &got))
+	}))
+	defer srv.Close()
+
+	_, err := NewOTLPExporter("127.0.0.1:4318")
+	assert.Error(t, err)
+
+	e, err := NewOTLPExporter(srv.URL, WithOTLPHeaders(map[string]string{"Authorization": "token"}))
+	assert.NoError(t, err)
+	p := NewProvider(WithSyncer(e), WithServiceName("svc"))
+
+	ctx, root := p.Start(context.Background(), "root", WithKind(KindServer))
+	_, child := p.Start(ctx, "child", WithAttributes(Int("n", 3), Float64("f", 1.5), Bool("b", true)))
+	child.RecordError(errors.New("boom"))
+	child.End()
+
+	assert.Equal(t, "token", header.Get("Authorization"))
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Len(t, got.ResourceSpans, 1)
+	rs := got.ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal(t, "svc", *rs.Resource.Attributes[0].Value.StringValue)
+	sp := rs.ScopeSpans[0].Spans[0]
+	assert.Equal(t, child.SpanContext().TraceID.String(), sp.TraceID)
+	assert.Equal(t, root.SpanContext().SpanID.String(), sp.ParentSpanID)
+	assert.Equal(t, 1, sp.Kind)
+	assert.Equal(t, "3", *sp.Attributes[0].Value.IntValue)
+	assert.Equal(t, 1.5, *sp.Attributes[1].Value.DoubleValue)
+	assert.True(t, *sp.Attributes[2].Value.BoolValue)
+	assert.Equal(t, 2, sp.Status.Code)
+	assert.Equal(t, "exception", sp.Events[0].Name)
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failed.Close()
+	e, _ = NewOTLPExporter(failed.URL)
+	assert.Error(t, e.Export(context.Background(), []SpanData{{Name: "x"}}))
+}
+
+func TestStartChild(t *testing.T) {
+	me := NewMemoryExporter()
+	old := GetProvider()
+	SetProvider(NewProvider(WithSyncer(me)))
+	defer SetProvider(old)
+
+	// 没有父span时不创建
+	ctx, s := StartChild(context.Background(), "orphan")
+	assert.Nil(t, s)
+	assert.Equal(t, context.Background(), ctx)
+
+	ctx, root := Start(context.Background(), "root")
+	_, child := StartChild(ctx, "child", WithKind(KindClient))
+	child.End()
+	root.End()
+
+	spans := me.Spans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, root.SpanContext().SpanID, spans[0].ParentSpanID)
+
+	// 远端传入的span context也可以作为父span
+	parent := metainfo.SpanContext{TraceID: metainfo.NewTraceID(), SpanID: metainfo.NewSpanID(), Flags: metainfo.FlagSampled}
+	_, s = StartChild(metainfo.WithSpanContext(context.Background(), parent), "remote")
+	assert.NotNil(t, s)
+	s.End()
+}
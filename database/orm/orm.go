@@ -49,6 +49,10 @@ func Get(name string, conf ...*gorm.Config) *DB {
 			panic(err.Error())
 		}
 
+		if err = db.Use(&TracePlugin{}); err != nil {
+			panic(err.Error())
+		}
+
 		if config.DbMode == "debug" {
 			db = db.Debug()
 		}
@@ -0,0 +1,81 @@
+package orm
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+const traceSpanKey = "gopkg:trace_span"
+
+// TracePlugin 为每条sql创建一个client span，span的父节点取自 db.WithContext(ctx) 的ctx，ctx中没有span时不创建
+// Get 创建的实例已自动注册，其他 gorm.DB 可通过 db.Use(&orm.TracePlugin{}) 注册
+type TracePlugin struct{}
+
+// Name 实现 gorm.Plugin
+func (p *TracePlugin) Name() string {
+	return "gopkg:trace"
+}
+
+// Initialize 实现 gorm.Plugin
+func (p *TracePlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("gopkg:trace_before_"+h.name, startSpan("gorm."+h.name)); err != nil {
+			return err
+		}
+		if err := h.after("gopkg:trace_after_"+h.name, endSpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startSpan(name string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+		_, span := trace.StartChild(db.Statement.Context, name, trace.WithKind(trace.KindClient), trace.WithAttributes(
+			trace.String("db.system", db.Dialector.Name()),
+		))
+		if span != nil {
+			db.InstanceSet(traceSpanKey, span)
+		}
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(traceSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(*trace.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttributes(
+		trace.String("db.statement", db.Statement.SQL.String()),
+		trace.String("db.sql.table", db.Statement.Table),
+		trace.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+	}
+	span.End()
+}
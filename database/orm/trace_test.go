@@ -0,0 +1,62 @@
+package orm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+type order struct {
+	ID   int64
+	Name string
+}
+
+// newDryRunDB 只生成sql不连接数据库
+func newDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:1)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Use(&TracePlugin{}))
+	return db
+}
+
+func TestTracePlugin(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	db := newDryRunDB(t)
+
+	// 没有父span时不创建
+	db.WithContext(context.Background()).Where("id = ?", 1).Find(&[]order{})
+	assert.Empty(t, me.Spans())
+
+	ctx, root := trace.Start(context.Background(), "root")
+	db.WithContext(ctx).Where("id = ?", 1).Find(&[]order{})
+	db.WithContext(ctx).Create(&order{Name: "a"})
+	root.End()
+
+	spans := me.Spans()
+	assert.Len(t, spans, 3)
+	q, c := spans[0], spans[1]
+	assert.Equal(t, "gorm.query", q.Name)
+	assert.Equal(t, "gorm.create", c.Name)
+	for _, s := range spans[:2] {
+		assert.Equal(t, trace.KindClient, s.Kind)
+		assert.Equal(t, root.SpanContext().SpanID, s.ParentSpanID)
+	}
+
+	attrs := make(map[string]interface{})
+	for _, a := range q.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	assert.Equal(t, "mysql", attrs["db.system"])
+	assert.Equal(t, "orders", attrs["db.sql.table"])
+	assert.Equal(t, "SELECT * FROM `orders` WHERE id = ?", attrs["db.statement"])
+}
@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/circuitbreaker"
+)
+
+// BreakerHook 熔断hook，breaker打开时命令和pipeline直接返回circuitbreaker.ErrOpen，redis.Nil不算失败
+//
+//	b := circuitbreaker.NewBreaker(circuitbreaker.Options{Trip: circuitbreaker.ConsecutiveTrip(5)})
+//	c.AddHook(redis.NewBreakerHook(b))
+type BreakerHook struct {
+	breaker *circuitbreaker.Breaker
+}
+
+var _ gredis.Hook = (*BreakerHook)(nil)
+
+// NewBreakerHook 创建熔断hook
+func NewBreakerHook(b *circuitbreaker.Breaker) *BreakerHook {
+	return &BreakerHook{breaker: b}
+}
+
+func (h *BreakerHook) DialHook(next gredis.DialHook) gredis.DialHook {
+	return next
+}
+
+func (h *BreakerHook) ProcessHook(next gredis.ProcessHook) gredis.ProcessHook {
+	return func(ctx context.Context, cmd gredis.Cmder) error {
+		done, err := h.breaker.Allow()
+		if err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err = next(ctx, cmd)
+		done(breakerError(err))
+		return err
+	}
+}
+
+func (h *BreakerHook) ProcessPipelineHook(next gredis.ProcessPipelineHook) gredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []gredis.Cmder) error {
+		done, err := h.breaker.Allow()
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err = next(ctx, cmds)
+		done(breakerError(err))
+		return err
+	}
+}
+
+func breakerError(err error) error {
+	if err == gredis.Nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/circuitbreaker"
+)
+
+func TestBreakerHook(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+
+	b := circuitbreaker.NewBreaker(circuitbreaker.Options{
+		Trip:           circuitbreaker.ConsecutiveTrip(2),
+		CoolingTimeout: 50 * time.Millisecond,
+	})
+	c.AddHook(NewBreakerHook(b))
+
+	// redis.Nil不算失败
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, gredis.Nil, c.Get(ctx, "missing").Err())
+	}
+	assert.Equal(t, circuitbreaker.StateClosed, b.State())
+
+	s.SetError("boom")
+	assert.Error(t, c.Set(ctx, "k", "v", 0).Err())
+	_, err := c.Pipelined(ctx, func(p gredis.Pipeliner) error {
+		p.Incr(ctx, "n")
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, circuitbreaker.StateOpen, b.State())
+
+	// 打开后不再请求redis
+	s.SetError("")
+	cmd := c.Set(ctx, "k", "v", 0)
+	assert.True(t, errors.Is(cmd.Err(), circuitbreaker.ErrOpen))
+	cmds, err := c.Pipelined(ctx, func(p gredis.Pipeliner) error {
+		p.Incr(ctx, "n")
+		return nil
+	})
+	assert.True(t, errors.Is(err, circuitbreaker.ErrOpen))
+	assert.True(t, errors.Is(cmds[0].Err(), circuitbreaker.ErrOpen))
+	assert.False(t, s.Exists("k"))
+
+	// 冷却后恢复
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, c.Set(ctx, "k", "v", 0).Err())
+	assert.Equal(t, circuitbreaker.StateClosed, b.State())
+}
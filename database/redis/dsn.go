@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+)
+
+// Mode redis部署模式
+type Mode int
+
+const (
+	// ModeSingle 单节点
+	ModeSingle Mode = iota
+	// ModeSentinel 哨兵
+	ModeSentinel
+	// ModeCluster 集群
+	ModeCluster
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeSentinel:
+		return "sentinel"
+	case ModeCluster:
+		return "cluster"
+	default:
+		return "single"
+	}
+}
+
+const (
+	defaultPort         = "6379"
+	defaultSentinelPort = "26379"
+)
+
+// DSN 解析后的连接配置
+type DSN struct {
+	Mode    Mode
+	Options *gredis.UniversalOptions
+}
+
+// ParseDSN 解析redis连接串，cache/redis和database/redis共用
+//
+//	redis://[user:password@]host[:port][/db][?PoolSize=10&ReadTimeout=1s]
+//	rediss://host:6380/0                           TLS，InsecureSkipVerify=true跳过证书校验
+//	redis+sentinel://[:password@]h1,h2,h3/mymaster[/db][?SentinelPassword=xx]
+//	redis+cluster://[:password@]h1,h2,h3
+//	redis://h1:26379?MasterName=mymaster           同redis+sentinel
+//
+// 查询参数对应 redis.UniversalOptions 的字段名，支持时长、整数、布尔和字符串类型，
+// rediss+sentinel、rediss+cluster 同时开启TLS
+func ParseDSN(dsn string) (*DSN, error) {
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return nil, fmt.Errorf("redis: invalid dsn %q: missing scheme", dsn)
+	}
+
+	d := &DSN{Options: &gredis.UniversalOptions{}}
+	useTLS := false
+	switch scheme {
+	case "redis":
+	case "rediss":
+		useTLS = true
+	case "redis+sentinel":
+		d.Mode = ModeSentinel
+	case "rediss+sentinel":
+		d.Mode, useTLS = ModeSentinel, true
+	case "redis+cluster":
+		d.Mode = ModeCluster
+	case "rediss+cluster":
+		d.Mode, useTLS = ModeCluster, true
+	default:
+		return nil, fmt.Errorf("redis: invalid dsn %q: unknown scheme %q", dsn, scheme)
+	}
+
+	// 多个host不是合法的url host，先取出来再用url.Parse解析其余部分
+	authority, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		authority, tail = rest[:i], rest[i:]
+	}
+	userinfo, hosts := "", authority
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, hosts = authority[:i+1], authority[i+1:]
+	}
+	u, err := url.Parse("redis://" + userinfo + "localhost" + tail)
+	if err != nil {
+		return nil, fmt.Errorf("redis: invalid dsn %q: %w", dsn, err)
+	}
+
+	opts := d.Options
+	port := defaultPort
+	if d.Mode == ModeSentinel {
+		port = defaultSentinelPort
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		if h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, port)
+		}
+		opts.Addrs = append(opts.Addrs, h)
+	}
+	if len(opts.Addrs) == 0 {
+		return nil, fmt.Errorf("redis: invalid dsn %q: missing host", dsn)
+	}
+
+	opts.Username = u.User.Username()
+	opts.Password, _ = u.User.Password()
+
+	path := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if d.Mode == ModeSentinel {
+		if len(path) == 0 {
+			return nil, fmt.Errorf("redis: invalid dsn %q: missing master name", dsn)
+		}
+		opts.MasterName, path = path[0], path[1:]
+	}
+	switch len(path) {
+	case 0:
+	case 1:
+		if opts.DB, err = strconv.Atoi(path[0]); err != nil {
+			return nil, fmt.Errorf("redis: invalid dsn %q: invalid database number %q", dsn, path[0])
+		}
+		if d.Mode == ModeCluster && opts.DB != 0 {
+			return nil, fmt.Errorf("redis: invalid dsn %q: cluster only supports database 0", dsn)
+		}
+	default:
+		return nil, fmt.Errorf("redis: invalid dsn %q: invalid path %q", dsn, u.Path)
+	}
+
+	args := u.Query()
+	if err := setArgs(opts, args); err != nil {
+		return nil, fmt.Errorf("redis: invalid dsn %q: %w", dsn, err)
+	}
+	// 兼容redis://h1:26379?MasterName=mymaster，与redis+sentinel相同
+	if d.Mode == ModeSingle && opts.MasterName != "" {
+		d.Mode = ModeSentinel
+	}
+	if d.Mode == ModeSingle && len(opts.Addrs) > 1 {
+		return nil, fmt.Errorf("redis: invalid dsn %q: multiple hosts need redis+sentinel or redis+cluster", dsn)
+	}
+	if useTLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		// 哨兵和集群连接的节点不是dsn中的host，ServerName留空按连接地址校验
+		if d.Mode == ModeSingle {
+			opts.TLSConfig.ServerName, _, _ = net.SplitHostPort(opts.Addrs[0])
+		}
+		if v := args.Get("InsecureSkipVerify"); v != "" {
+			skip, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("redis: invalid dsn %q: InsecureSkipVerify=%s", dsn, v)
+			}
+			opts.TLSConfig.InsecureSkipVerify = skip
+		}
+	}
+	return d, nil
+}
+
+// setArgs 按字段名设置查询参数
+func setArgs(opts *gredis.UniversalOptions, args url.Values) error {
+	rv := reflect.ValueOf(opts).Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Field(i)
+		if !f.CanInterface() {
+			continue
+		}
+		name := rt.Field(i).Name
+		arg := args.Get(name)
+		if arg == "" {
+			continue
+		}
+		switch f.Interface().(type) {
+		case time.Duration:
+			v, err := time.ParseDuration(arg)
+			if err != nil {
+				return fmt.Errorf("%s=%s, err:%v", name, arg, err)
+			}
+			f.Set(reflect.ValueOf(v))
+		case int:
+			v, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("%s=%s, err:%v", name, arg, err)
+			}
+			f.SetInt(int64(v))
+		case bool:
+			v, err := strconv.ParseBool(arg)
+			if err != nil {
+				return fmt.Errorf("%s=%s, err:%v", name, arg, err)
+			}
+			f.SetBool(v)
+		case string:
+			f.SetString(arg)
+		}
+	}
+	return nil
+}
+
+// NewUniversalClient 按部署模式创建客户端，单个地址的集群也会使用集群客户端，
+// 设置了MasterName的单节点模式按哨兵创建
+func (d *DSN) NewUniversalClient() gredis.UniversalClient {
+	mode := d.Mode
+	if mode == ModeSingle && d.Options.MasterName != "" {
+		mode = ModeSentinel
+	}
+	switch mode {
+	case ModeSentinel:
+		return gredis.NewFailoverClient(d.Options.Failover())
+	case ModeCluster:
+		return gredis.NewClusterClient(d.Options.Cluster())
+	default:
+		return gredis.NewClient(d.Options.Simple())
+	}
+}
@@ -0,0 +1,359 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+var (
+	// ErrNotObtained 锁被其他持有者占用
+	ErrNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld 锁未持有或已过期
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+const (
+	defaultLockTTL     = 10 * time.Second
+	defaultLockTries   = 3
+	defaultLockBackoff = 50 * time.Millisecond
+	// clockDriftFactor Redlock时钟漂移系数
+	clockDriftFactor = 0.01
+)
+
+var (
+	// 加锁成功后递增fencing token计数
+	lockScript = gredis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`)
+
+	unlockScript = gredis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+	renewScript = gredis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// LockOptions 锁配置，零值使用默认值
+type LockOptions struct {
+	// TTL 锁的过期时间，默认10s
+	TTL time.Duration
+	// Tries TryLock的最大尝试次数，默认3次
+	Tries int
+	// Backoff 重试间隔，默认 retry.Exponential(50ms, TTL)
+	Backoff retry.Backoff
+	// Watchdog 持有期间每TTL/3自动续期，直到Unlock
+	Watchdog bool
+	// OnLost 续期失败（锁已过期或被其他持有者获取）时调用
+	OnLost func(key string)
+}
+
+func (o LockOptions) withDefaults() LockOptions {
+	if o.TTL <= 0 {
+		o.TTL = defaultLockTTL
+	}
+	if o.Tries <= 0 {
+		o.Tries = defaultLockTries
+	}
+	if o.Backoff == nil {
+		o.Backoff = retry.Exponential(defaultLockBackoff, o.TTL)
+	}
+	return o
+}
+
+// Lock 基于 SET NX PX 的分布式锁，Unlock 用 lua 脚本校验持有者。
+// 每次加锁成功从 key+":fencing" 计数器得到一个递增的fencing token，写下游时带上token，
+// 下游拒绝比已见过的更小的token，可以避免锁过期后旧持有者的写入。
+// 集群模式下key需要带hash tag（例如 "{order:1}"）使锁和计数器在同一个slot。
+//
+// 配置多个独立节点时使用Redlock：在多数节点上加锁成功且未超过有效期才算成功，
+// 此时token取各节点计数的最大值，不保证严格递增。
+//
+// Lock 不是可重入的，一个Lock同时只能被持有一次。
+type Lock struct {
+	clients []*Client
+	key     string
+	fence   string
+	opt     LockOptions
+
+	mu    sync.Mutex
+	value string
+	token int64
+	until time.Time
+	stop  chan struct{}
+	lost  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewLock 创建单节点锁
+//
+//	l := c.NewLock("lock:order:1", redis.LockOptions{TTL: 5 * time.Second, Watchdog: true})
+//	if err := l.TryLock(ctx); err != nil {
+//		return err
+//	}
+//	defer l.Unlock(ctx)
+//	db.Where("fencing_token < ?", l.Token()).Updates(...)
+func (c *Client) NewLock(key string, opt LockOptions) *Lock {
+	return NewRedlock([]*Client{c}, key, opt)
+}
+
+// NewRedlock 创建多节点（Redlock）锁，clients应该是相互独立的主节点，建议奇数个
+func NewRedlock(clients []*Client, key string, opt LockOptions) *Lock {
+	if len(clients) == 0 {
+		panic("redis: no client of lock")
+	}
+	return &Lock{
+		clients: clients,
+		key:     key,
+		fence:   key + ":fencing",
+		opt:     opt.withDefaults(),
+	}
+}
+
+// Key 锁的key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 当前持有的fencing token，未持有时为0
+func (l *Lock) Token() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// Done 开启Watchdog时，持有期间续期失败时关闭；未开启Watchdog或未持有时返回nil，
+// 此时需要自己调用Refresh检查
+func (l *Lock) Done() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// TryLock 加锁，被占用时按Backoff重试，最多Tries次，仍失败返回ErrNotObtained；
+// ctx结束时返回ctx的错误
+func (l *Lock) TryLock(ctx context.Context) error {
+	return l.lock(ctx, l.opt.Tries)
+}
+
+// Lock 加锁，被占用时一直重试，直到成功、ctx结束或下次重试会超过ctx的deadline
+func (l *Lock) Lock(ctx context.Context) error {
+	return l.lock(ctx, 0)
+}
+
+func (l *Lock) lock(ctx context.Context, tries int) error {
+	l.mu.Lock()
+	held := l.value != ""
+	l.mu.Unlock()
+	if held {
+		return ErrNotObtained
+	}
+
+	r := retry.New(
+		retry.WithMaxAttempts(tries),
+		retry.WithBackoff(l.opt.Backoff),
+		retry.WithRetryable(func(err error) bool { return err == ErrNotObtained }),
+	)
+	err := r.Do(ctx, l.acquire)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (l *Lock) acquire(ctx context.Context) error {
+	value, err := newLockValue()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	ttl := l.opt.TTL.Milliseconds()
+	var n, failed int
+	var token int64
+	var lastErr error
+	for _, c := range l.clients {
+		t, err := lockScript.Run(ctx, c, []string{l.key, l.fence}, value, ttl).Int64()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if t > 0 {
+			n++
+			if t > token {
+				token = t
+			}
+		}
+	}
+
+	validity := l.opt.TTL - time.Since(start) - time.Duration(float64(l.opt.TTL)*clockDriftFactor)
+	if n < l.quorum() || validity <= 0 {
+		l.release(context.Background(), value)
+		// 所有节点都出错时返回错误，不再重试
+		if failed == len(l.clients) {
+			return lastErr
+		}
+		return ErrNotObtained
+	}
+
+	l.mu.Lock()
+	l.value, l.token, l.until = value, token, start.Add(validity)
+	if l.opt.Watchdog {
+		l.lost = make(chan struct{})
+		l.stop = make(chan struct{})
+		l.wg.Add(1)
+		go l.watchdog(l.value, l.stop, l.lost)
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *Lock) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+// Refresh 续期到TTL，锁已过期或被其他持有者获取时返回ErrLockNotHeld
+func (l *Lock) Refresh(ctx context.Context) error {
+	l.mu.Lock()
+	value := l.value
+	l.mu.Unlock()
+	if value == "" {
+		return ErrLockNotHeld
+	}
+	return l.refresh(ctx, value)
+}
+
+func (l *Lock) refresh(ctx context.Context, value string) error {
+	start := time.Now()
+	var n, failed int
+	var lastErr error
+	for _, c := range l.clients {
+		ok, err := renewScript.Run(ctx, c, []string{l.key}, value, l.opt.TTL.Milliseconds()).Int64()
+		switch {
+		case err != nil:
+			failed++
+			lastErr = err
+		case ok == 1:
+			n++
+		}
+	}
+	if n < l.quorum() {
+		// 节点出错时无法确定锁是否已丢失
+		if n+failed >= l.quorum() {
+			return lastErr
+		}
+		return ErrLockNotHeld
+	}
+
+	l.mu.Lock()
+	if l.value == value {
+		l.until = start.Add(l.opt.TTL - time.Duration(float64(l.opt.TTL)*clockDriftFactor))
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// TTL 锁的剩余有效期，未持有时为0
+func (l *Lock) TTL() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.value == "" {
+		return 0
+	}
+	if d := time.Until(l.until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Unlock 释放锁，锁已过期或被其他持有者获取时返回ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	value, stop := l.value, l.stop
+	l.value, l.token, l.stop, l.lost = "", 0, nil, nil
+	l.mu.Unlock()
+	if value == "" {
+		return ErrLockNotHeld
+	}
+	if stop != nil {
+		close(stop)
+		l.wg.Wait()
+	}
+
+	if l.release(ctx, value) < l.quorum() {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// release 在所有节点上删除value对应的锁，返回删除成功的节点数
+func (l *Lock) release(ctx context.Context, value string) int {
+	n := 0
+	for _, c := range l.clients {
+		ok, err := unlockScript.Run(ctx, c, []string{l.key}, value).Int64()
+		if err == nil && ok == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+func (l *Lock) watchdog(value string, stop, lost chan struct{}) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.opt.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.opt.TTL/3)
+			err := l.refresh(ctx, value)
+			cancel()
+			if err == nil {
+				continue
+			}
+			// 续期失败但锁仍在有效期内时下次再试
+			if l.TTL() > 0 && err != ErrLockNotHeld {
+				continue
+			}
+			log.Warnf("redis: lock(%s) lost err(%v)", l.key, err)
+			l.mu.Lock()
+			if l.value == value {
+				l.value, l.token, l.stop = "", 0, nil
+			}
+			l.mu.Unlock()
+			close(lost)
+			if l.opt.OnLost != nil {
+				l.opt.OnLost(l.key)
+			}
+			return
+		}
+	}
+}
+
+func newLockValue() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+func TestLock(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+	opt := LockOptions{TTL: time.Second, Backoff: retry.Constant(10 * time.Millisecond)}
+
+	l1 := c.NewLock("lock", opt)
+	l2 := c.NewLock("lock", opt)
+	assert.NoError(t, l1.TryLock(ctx))
+	assert.Equal(t, int64(1), l1.Token())
+	assert.True(t, l1.TTL() > 900*time.Millisecond)
+	assert.Equal(t, ErrNotObtained, l1.TryLock(ctx))
+
+	start := time.Now()
+	assert.Equal(t, ErrNotObtained, l2.TryLock(ctx))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrNotObtained, l2.Lock(tctx))
+	cctx, cancel2 := context.WithCancel(ctx)
+	cancel2()
+	assert.Equal(t, context.Canceled, l2.Lock(cctx))
+
+	assert.NoError(t, l1.Refresh(ctx))
+	assert.NoError(t, l1.Unlock(ctx))
+	assert.Equal(t, ErrLockNotHeld, l1.Unlock(ctx))
+	assert.Equal(t, int64(0), l1.Token())
+
+	assert.NoError(t, l2.Lock(ctx))
+	assert.Equal(t, int64(2), l2.Token())
+
+	// expired and taken by another owner
+	s.FastForward(2 * time.Second)
+	assert.NoError(t, l1.TryLock(ctx))
+	assert.Equal(t, int64(3), l1.Token())
+	assert.Equal(t, ErrLockNotHeld, l2.Refresh(ctx))
+	assert.Equal(t, ErrLockNotHeld, l2.Unlock(ctx))
+	v, _ := s.Get("lock")
+	assert.NotEmpty(t, v)
+}
+
+func TestLockWatchdog(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+
+	var lost int32
+	l := c.NewLock("lock", LockOptions{
+		TTL:      300 * time.Millisecond,
+		Watchdog: true,
+		OnLost:   func(key string) { atomic.AddInt32(&lost, 1) },
+	})
+	assert.NoError(t, l.TryLock(ctx))
+
+	s.FastForward(250 * time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	assert.True(t, s.TTL("lock") > 100*time.Millisecond)
+
+	s.Del("lock")
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lock not lost")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lost))
+	assert.Equal(t, int64(0), l.Token())
+	assert.Equal(t, time.Duration(0), l.TTL())
+	assert.Equal(t, ErrLockNotHeld, l.Unlock(ctx))
+	assert.Nil(t, l.Done())
+
+	// the watchdog stops after Unlock
+	assert.NoError(t, l.TryLock(ctx))
+	assert.NoError(t, l.Unlock(ctx))
+	assert.Nil(t, l.Done())
+	time.Sleep(150 * time.Millisecond)
+	assert.False(t, s.Exists("lock"))
+
+	// a lost lock can be obtained again without Unlock
+	assert.NoError(t, l.TryLock(ctx))
+	s.Del("lock")
+	<-l.Done()
+	assert.NoError(t, l.TryLock(ctx))
+	assert.NoError(t, l.Unlock(ctx))
+
+	// Done is nil without the watchdog
+	l2 := c.NewLock("lock2", LockOptions{})
+	assert.NoError(t, l2.TryLock(ctx))
+	assert.Nil(t, l2.Done())
+	assert.NoError(t, l2.Unlock(ctx))
+}
+
+func TestRedlock(t *testing.T) {
+	ctx := context.Background()
+	var servers []*miniredis.Miniredis
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		s, c := newTestClient(t)
+		servers = append(servers, s)
+		clients = append(clients, c)
+	}
+	opt := LockOptions{TTL: time.Second, Tries: 1}
+
+	// a minority of nodes down
+	servers[2].Close()
+	l1 := NewRedlock(clients, "lock", opt)
+	assert.NoError(t, l1.TryLock(ctx))
+	assert.Equal(t, int64(1), l1.Token())
+
+	l2 := NewRedlock(clients, "lock", opt)
+	assert.Equal(t, ErrNotObtained, l2.TryLock(ctx))
+	assert.NoError(t, l1.Unlock(ctx))
+
+	// held by another owner on a majority of nodes
+	servers[0].Set("lock", "other")
+	servers[1].Set("lock", "other")
+	assert.Equal(t, ErrNotObtained, l2.TryLock(ctx))
+
+	servers[1].Del("lock")
+	servers[0].Del("lock")
+	assert.NoError(t, l2.TryLock(ctx))
+	// the acquisition failed above released the minority it got
+	assert.Equal(t, int64(2), l2.Token())
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+// TraceHook 为每条命令和pipeline创建一个client span，NewClient 创建的实例已自动添加。
+// 只在ctx中已有span时创建，后台任务等不在trace中的调用不会产生span
+type TraceHook struct{}
+
+var _ gredis.Hook = TraceHook{}
+
+func (TraceHook) DialHook(next gredis.DialHook) gredis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, span := trace.StartChild(ctx, "redis.dial", trace.WithKind(trace.KindClient), trace.WithAttributes(
+			trace.String("db.system", "redis"),
+			trace.String("net.peer.name", addr),
+		))
+		conn, err := next(ctx, network, addr)
+		span.RecordError(err)
+		span.End()
+		return conn, err
+	}
+}
+
+func (TraceHook) ProcessHook(next gredis.ProcessHook) gredis.ProcessHook {
+	return func(ctx context.Context, cmd gredis.Cmder) error {
+		ctx, span := trace.StartChild(ctx, "redis."+cmd.FullName(), trace.WithKind(trace.KindClient), trace.WithAttributes(
+			trace.String("db.system", "redis"),
+			trace.String("db.statement", cmdString(cmd)),
+		))
+		err := next(ctx, cmd)
+		if err != gredis.Nil {
+			span.RecordError(err)
+		}
+		span.End()
+		return err
+	}
+}
+
+func (TraceHook) ProcessPipelineHook(next gredis.ProcessPipelineHook) gredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []gredis.Cmder) error {
+		names := make([]string, 0, len(cmds))
+		for _, cmd := range cmds {
+			names = append(names, cmd.FullName())
+		}
+		ctx, span := trace.StartChild(ctx, "redis.pipeline", trace.WithKind(trace.KindClient), trace.WithAttributes(
+			trace.String("db.system", "redis"),
+			trace.String("db.statement", strings.Join(names, " ")),
+			trace.Int("db.redis.num_cmd", len(cmds)),
+		))
+		err := next(ctx, cmds)
+		if err != gredis.Nil {
+			span.RecordError(err)
+		}
+		span.End()
+		return err
+	}
+}
+
+// cmdString 只保留命令名和key，避免把value写进span
+func cmdString(cmd gredis.Cmder) string {
+	args := cmd.Args()
+	if len(args) > 2 {
+		args = args[:2]
+	}
+	s := make([]string, 0, len(args))
+	for _, a := range args {
+		if v, ok := a.(string); ok {
+			s = append(s, v)
+		}
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+func TestTraceHook(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	_, c := newTestClient(t)
+
+	// 没有父span时不创建，连接也不会产生span
+	assert.NoError(t, c.Set(context.Background(), "k", "secret", 0).Err())
+	assert.Empty(t, me.Spans())
+
+	ctx, root := trace.Start(context.Background(), "root")
+	assert.NoError(t, c.Set(ctx, "k", "secret", 0).Err())
+	assert.Error(t, c.Get(ctx, "missing").Err())
+	_, err := c.Pipelined(ctx, func(p gredis.Pipeliner) error {
+		p.Incr(ctx, "n")
+		p.Expire(ctx, "n", 0)
+		return nil
+	})
+	assert.NoError(t, err)
+	root.End()
+
+	spans := me.Spans()
+	assert.Len(t, spans, 4)
+	names := make([]string, 0, len(spans))
+	for _, s := range spans[:3] {
+		names = append(names, s.Name)
+		assert.Equal(t, trace.KindClient, s.Kind)
+		assert.Equal(t, root.SpanContext().SpanID, s.ParentSpanID)
+	}
+	assert.Equal(t, []string{"redis.set", "redis.get", "redis.pipeline"}, names)
+
+	attrs := func(s trace.SpanData) map[string]interface{} {
+		m := make(map[string]interface{})
+		for _, a := range s.Attributes {
+			m[a.Key] = a.Value
+		}
+		return m
+	}
+	// value不会写进span
+	assert.Equal(t, "set k", attrs(spans[0])["db.statement"])
+	// redis.Nil不算错误
+	assert.Equal(t, trace.StatusUnset, spans[1].Status.Code)
+	assert.Equal(t, "incr expire", attrs(spans[2])["db.statement"])
+	assert.Equal(t, int64(2), attrs(spans[2])["db.redis.num_cmd"])
+}
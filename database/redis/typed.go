@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// ErrNotFound key不存在
+var ErrNotFound = errors.New("redis: not found")
+
+// batchSize MGetAs、MSetAs每个pipeline的最大命令数
+const batchSize = 500
+
+var rememberGroup singleflight.Group
+
+// codecClient 带有编解码的UniversalClient，见WithCodec
+type codecClient struct {
+	gredis.UniversalClient
+	codec Codec
+}
+
+// WithCodec 返回使用codec编解码的client，与原client共用连接
+//
+//	pc := c.WithCodec(redis.Gzip(redis.MsgPack))
+//	redis.SetAs(ctx, pc, "user:1", u, time.Hour)
+func (c *Client) WithCodec(codec Codec) *Client {
+	return &Client{codecClient{UniversalClient: c.rdb(), codec: codec}}
+}
+
+// Codec 返回client的编解码，默认JSON
+func (c *Client) Codec() Codec {
+	if cc, ok := c.UniversalClient.(codecClient); ok && cc.codec != nil {
+		return cc.codec
+	}
+	return JSON
+}
+
+// rdb 返回底层的UniversalClient，WithCodec创建的client与原client相同
+func (c *Client) rdb() gredis.UniversalClient {
+	if cc, ok := c.UniversalClient.(codecClient); ok {
+		return cc.UniversalClient
+	}
+	return c.UniversalClient
+}
+
+// GetAs 获取key并解码为T，key不存在时返回ErrNotFound
+func GetAs[T any](ctx context.Context, c *Client, key string) (T, error) {
+	var v T
+	data, err := c.Get(ctx, key).Bytes()
+	if err == gredis.Nil {
+		return v, ErrNotFound
+	}
+	if err != nil {
+		return v, err
+	}
+	if err := c.Codec().Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("decode key(%s) err(%w)", key, err)
+	}
+	return v, nil
+}
+
+// SetAs 编码v并写入key，ttl为0时不过期
+func SetAs[T any](ctx context.Context, c *Client, key string, v T, ttl time.Duration) error {
+	data, err := c.Codec().Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode key(%s) err(%w)", key, err)
+	}
+	return c.Set(ctx, key, data, ttl).Err()
+}
+
+// MGetAs 批量获取keys，不存在或解码失败的key不在结果中。
+// 使用pipeline分批发送GET，集群模式下key可以在不同的slot
+func MGetAs[T any](ctx context.Context, c *Client, keys ...string) (map[string]T, error) {
+	res := make(map[string]T, len(keys))
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		cmds := make([]*gredis.StringCmd, len(batch))
+		_, err := c.Pipelined(ctx, func(p gredis.Pipeliner) error {
+			for i, key := range batch {
+				cmds[i] = p.Get(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && err != gredis.Nil {
+			return nil, err
+		}
+
+		for i, cmd := range cmds {
+			data, err := cmd.Bytes()
+			if err != nil {
+				continue
+			}
+			var v T
+			if err := c.Codec().Unmarshal(data, &v); err != nil {
+				log.Warnf("redis: decode key(%s) err(%v)", batch[i], err)
+				continue
+			}
+			res[batch[i]] = v
+		}
+	}
+	return res, nil
+}
+
+// MSetAs 批量写入，使用pipeline分批发送SET，ttl为0时不过期
+func MSetAs[T any](ctx context.Context, c *Client, values map[string]T, ttl time.Duration) error {
+	type kv struct {
+		key  string
+		data []byte
+	}
+	all := make([]kv, 0, len(values))
+	for k, v := range values {
+		data, err := c.Codec().Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encode key(%s) err(%w)", k, err)
+		}
+		all = append(all, kv{k, data})
+	}
+
+	for start := 0; start < len(all); start += batchSize {
+		end := start + batchSize
+		if end > len(all) {
+			end = len(all)
+		}
+		_, err := c.Pipelined(ctx, func(p gredis.Pipeliner) error {
+			for _, x := range all[start:end] {
+				p.Set(ctx, x.key, x.data, ttl)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remember 缓存旁路：key存在时直接返回，否则调用loader加载并写入key。
+// 同一连接相同key的并发加载合并为一次，写缓存失败只记录日志
+//
+//	u, err := redis.Remember(ctx, c, "user:1", time.Hour, func(ctx context.Context) (*User, error) {
+//		return dao.GetUser(ctx, 1)
+//	})
+func Remember[T any](ctx context.Context, c *Client, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	v, err := GetAs[T](ctx, c, key)
+	if err == nil {
+		return v, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		log.Warnf("redis: remember get key(%s) err(%v)", key, err)
+	}
+
+	// 连接不同或类型不同的调用不能共享结果，WithCodec创建的client与原client共享
+	sfKey := fmt.Sprintf("%p|%T|%s", c.rdb(), v, key)
+	res, err, _ := rememberGroup.Do(sfKey, func() (interface{}, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := SetAs(ctx, c, key, v, ttl); err != nil {
+			log.Warnf("redis: remember set key(%s) err(%v)", key, err)
+		}
+		return v, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return res.(T), nil
+}
@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	ID   int    `json:"id" msgpack:"id"`
+	Name string `json:"name" msgpack:"name"`
+}
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *Client) {
+	s := miniredis.RunT(t)
+	c := NewClient("redis://" + s.Addr())
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func TestGetSetAs(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := GetAs[user](ctx, c, "user:1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, c.GetStruct(ctx, "user:1", &user{}), ErrNotFound)
+
+	for _, codec := range []Codec{JSON, MsgPack, Gzip(JSON), Gzip(MsgPack)} {
+		pc := c.WithCodec(codec)
+		assert.NoError(t, SetAs(ctx, pc, "user:1", user{1, "foo"}, time.Minute))
+		u, err := GetAs[user](ctx, pc, "user:1")
+		assert.NoError(t, err)
+		assert.Equal(t, user{1, "foo"}, u)
+		assert.Equal(t, time.Minute, s.TTL("user:1"))
+	}
+
+	// encoded by another codec
+	_, err = GetAs[user](ctx, c, "user:1")
+	assert.Error(t, err)
+
+	pc := c.WithCodec(Proto)
+	assert.NoError(t, SetAs(ctx, pc, "pb", wrapperspb.String("bar"), 0))
+	m, err := GetAs[*wrapperspb.StringValue](ctx, pc, "pb")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", m.GetValue())
+	assert.Error(t, SetAs(ctx, pc, "pb", "bar", 0))
+}
+
+func TestMGetSetAs(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	values := map[string]user{}
+	keys := []string{"missing"}
+	for i := 0; i < 1200; i++ {
+		k := fmt.Sprintf("user:%d", i)
+		values[k] = user{i, k}
+		keys = append(keys, k)
+	}
+	assert.NoError(t, MSetAs(ctx, c, values, time.Minute))
+	c.Set(ctx, "bad", "{", 0)
+	keys = append(keys, "bad")
+
+	res, err := MGetAs[user](ctx, c, keys...)
+	assert.NoError(t, err)
+	assert.Equal(t, values, res)
+}
+
+func TestRemember(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	var loads int32
+	loader := func(ctx context.Context) (user, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(10 * time.Millisecond)
+		return user{1, "foo"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := Remember(ctx, c, "user:1", time.Minute, loader)
+			assert.NoError(t, err)
+			assert.Equal(t, "foo", u.Name)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	u, err := Remember(ctx, c, "user:1", time.Minute, loader)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", u.Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	boom := errors.New("boom")
+	_, err = Remember(ctx, c, "user:2", time.Minute, func(ctx context.Context) (user, error) {
+		return user{}, boom
+	})
+	assert.Equal(t, boom, err)
+	assert.Equal(t, int64(0), c.Exists(ctx, "user:2").Val())
+}
+
+func TestRememberPerClient(t *testing.T) {
+	_, c1 := newTestClient(t)
+	_, c2 := newTestClient(t)
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go Remember(ctx, c1, "user:1", time.Minute, func(ctx context.Context) (user, error) {
+		close(started)
+		<-release
+		return user{1, "c1"}, nil
+	})
+	<-started
+	defer close(release)
+
+	// a load of the same key on another client is not shared
+	done := make(chan user)
+	go func() {
+		u, _ := Remember(ctx, c2, "user:1", time.Minute, func(ctx context.Context) (user, error) {
+			return user{1, "c2"}, nil
+		})
+		done <- u
+	}()
+	select {
+	case u := <-done:
+		assert.Equal(t, "c2", u.Name)
+		assert.Equal(t, int64(1), c2.Exists(ctx, "user:1").Val())
+	case <-time.After(time.Second):
+		t.Fatal("Remember waited for another client")
+	}
+}
+
+func TestRememberWithCodec(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan user)
+	go func() {
+		u, _ := Remember(ctx, c, "user:1", time.Minute, func(ctx context.Context) (user, error) {
+			close(started)
+			<-release
+			return user{1, "c"}, nil
+		})
+		done <- u
+	}()
+	<-started
+
+	// clients created with WithCodec share the connection and the load
+	go func() {
+		u, _ := Remember(ctx, c.WithCodec(MsgPack), "user:1", time.Minute, func(ctx context.Context) (user, error) {
+			return user{1, "codec"}, nil
+		})
+		done <- u
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	assert.Equal(t, "c", (<-done).Name)
+	assert.Equal(t, "c", (<-done).Name)
+
+	// unkeyed literals still work
+	assert.Equal(t, JSON, (&Client{c.UniversalClient}).Codec())
+	assert.Equal(t, MsgPack, c.WithCodec(Gzip(JSON)).WithCodec(MsgPack).Codec())
+	assert.EqualError(t, ErrNotFound, "redis: not found")
+}
@@ -0,0 +1,258 @@
+// ecodegen generates ecode declarations and code tables from a json source file.
+//
+//	go run ./cmd/ecodegen -in codes.json -go ecode_gen.go -md CODES.md -json codes_table.json
+//
+// The source file looks like:
+//
+//	{
+//	  "package": "ecode",
+//	  "ranges": [
+//	    {
+//	      "var": "CommonRange", "name": "common", "owner": "platform",
+//	      "min": 1000001, "max": 1000999,
+//	      "codes": [
+//	        {"name": "InvalidParam", "code": 1000001, "message": "参数错误"}
+//	      ]
+//	    }
+//	  ]
+//	}
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type source struct {
+	Package string      `json:"package"`
+	Import  string      `json:"import"` // ecode import path when package is not ecode
+	Ranges  []codeRange `json:"ranges"`
+}
+
+type codeRange struct {
+	Var   string `json:"var"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Desc  string `json:"desc"`
+	Min   int    `json:"min"`
+	Max   int    `json:"max"`
+	Codes []code `json:"codes"`
+}
+
+type code struct {
+	Name    string `json:"name"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Comment string `json:"comment"`
+}
+
+type tableEntry struct {
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Range   string `json:"range"`
+	Owner   string `json:"owner"`
+}
+
+func main() {
+	var (
+		in      = flag.String("in", "codes.json", "source file")
+		goOut   = flag.String("go", "", "generated go file")
+		mdOut   = flag.String("md", "", "generated markdown table")
+		jsonOut = flag.String("json", "", "generated json table")
+	)
+	flag.Parse()
+
+	if err := run(*in, *goOut, *mdOut, *jsonOut); err != nil {
+		fmt.Fprintf(os.Stderr, "ecodegen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, goOut, mdOut, jsonOut string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	src := &source{}
+	if err := json.Unmarshal(data, src); err != nil {
+		return fmt.Errorf("parse %s err(%v)", in, err)
+	}
+	if src.Package == "" {
+		src.Package = "ecode"
+	}
+	if err := validate(src); err != nil {
+		return err
+	}
+
+	name := filepath.Base(in)
+	if goOut != "" {
+		b, err := genGo(src, name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(goOut, b, 0o644); err != nil {
+			return err
+		}
+	}
+	if mdOut != "" {
+		if err := os.WriteFile(mdOut, genMarkdown(src, name), 0o644); err != nil {
+			return err
+		}
+	}
+	if jsonOut != "" {
+		b, err := json.MarshalIndent(table(src), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(jsonOut, append(b, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks the same rules as ecode.NewRange and ecode.Register,
+// so a bad source file fails at generate time instead of init time.
+func validate(src *source) error {
+	names := map[string]bool{}
+	rangeNames := map[string]bool{}
+	codes := map[int]bool{}
+	for i, r := range src.Ranges {
+		if r.Var == "" || r.Name == "" {
+			return fmt.Errorf("range #%d: var and name are required", i)
+		}
+		if r.Min <= 0 || r.Max < r.Min {
+			return fmt.Errorf("range %s: invalid [%d-%d]", r.Name, r.Min, r.Max)
+		}
+		for _, o := range src.Ranges[:i] {
+			if r.Min <= o.Max && o.Min <= r.Max {
+				return fmt.Errorf("range %s overlaps %s", r.Name, o.Name)
+			}
+		}
+		if names[r.Var] {
+			return fmt.Errorf("duplicate identifier %s", r.Var)
+		}
+		names[r.Var] = true
+		if rangeNames[r.Name] {
+			return fmt.Errorf("duplicate range name %s", r.Name)
+		}
+		rangeNames[r.Name] = true
+
+		for _, c := range r.Codes {
+			if c.Name == "" {
+				return fmt.Errorf("range %s: code %d has no name", r.Name, c.Code)
+			}
+			if c.Code < r.Min || c.Code > r.Max {
+				return fmt.Errorf("code %s(%d) out of range %s [%d-%d]", c.Name, c.Code, r.Name, r.Min, r.Max)
+			}
+			if codes[c.Code] {
+				return fmt.Errorf("duplicate code %d", c.Code)
+			}
+			if names[c.Name] {
+				return fmt.Errorf("duplicate identifier %s", c.Name)
+			}
+			codes[c.Code] = true
+			names[c.Name] = true
+		}
+	}
+	return nil
+}
+
+func genGo(src *source, name string) ([]byte, error) {
+	qual := ""
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by ecodegen from %s. DO NOT EDIT.\n\n", name)
+	fmt.Fprintf(buf, "package %s\n\n", src.Package)
+	if src.Package != "ecode" {
+		if src.Import == "" {
+			src.Import = "github.com/aaabigfish/gopkg/ecode"
+		}
+		fmt.Fprintf(buf, "import %q\n\n", src.Import)
+		qual = "ecode."
+	}
+
+	for _, r := range src.Ranges {
+		desc := r.Desc
+		if desc == "" {
+			desc = r.Name
+		}
+		fmt.Fprintf(buf, "// %s %s [%d-%d] owner: %s\n", r.Var, desc, r.Min, r.Max, r.Owner)
+		fmt.Fprintf(buf, "var %s = %sNewRange(%q, %q, %d, %d)\n\n", r.Var, qual, r.Name, r.Owner, r.Min, r.Max)
+		if len(r.Codes) == 0 {
+			continue
+		}
+		buf.WriteString("var (\n")
+		for _, c := range sortedCodes(r.Codes) {
+			comment := c.Comment
+			if comment == "" {
+				comment = c.Message
+			}
+			fmt.Fprintf(buf, "\t%s = %sRegister(%s, %d, %q)", c.Name, qual, r.Var, c.Code, c.Message)
+			if comment != "" {
+				fmt.Fprintf(buf, " // %s", comment)
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(")\n\n")
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+func genMarkdown(src *source, name string) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<!-- Code generated by ecodegen from %s. DO NOT EDIT. -->\n\n", name)
+	buf.WriteString("# ecode\n")
+	for _, r := range src.Ranges {
+		fmt.Fprintf(buf, "\n## %s [%d-%d]\n\n", r.Name, r.Min, r.Max)
+		if r.Owner != "" {
+			fmt.Fprintf(buf, "owner: %s\n\n", r.Owner)
+		}
+		if r.Desc != "" {
+			fmt.Fprintf(buf, "%s\n\n", r.Desc)
+		}
+		buf.WriteString("| code | name | message |\n")
+		buf.WriteString("| ---- | ---- | ------- |\n")
+		for _, c := range sortedCodes(r.Codes) {
+			fmt.Fprintf(buf, "| %d | %s | %s |\n", c.Code, c.Name, escapeCell(c.Message))
+		}
+	}
+	return buf.Bytes()
+}
+
+func table(src *source) []tableEntry {
+	entries := []tableEntry{}
+	for _, r := range src.Ranges {
+		for _, c := range sortedCodes(r.Codes) {
+			entries = append(entries, tableEntry{
+				Code:    c.Code,
+				Name:    c.Name,
+				Message: c.Message,
+				Range:   r.Name,
+				Owner:   r.Owner,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	return entries
+}
+
+func sortedCodes(codes []code) []code {
+	cs := make([]code, len(codes))
+	copy(cs, codes)
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Code < cs[j].Code })
+	return cs
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	ok := func() codeRange {
+		return codeRange{Var: "ARange", Name: "a", Min: 100, Max: 199, Codes: []code{{Name: "A1", Code: 100}}}
+	}
+	tests := []struct {
+		name   string
+		ranges func() []codeRange
+		err    string
+	}{
+		{"ok", func() []codeRange {
+			b := codeRange{Var: "BRange", Name: "b", Min: 200, Max: 299, Codes: []code{{Name: "B1", Code: 299}}}
+			return []codeRange{ok(), b}
+		}, ""},
+		{"no var", func() []codeRange {
+			r := ok()
+			r.Var = ""
+			return []codeRange{r}
+		}, "var and name are required"},
+		{"invalid range", func() []codeRange {
+			r := ok()
+			r.Min, r.Max = 199, 100
+			return []codeRange{r}
+		}, "invalid [199-100]"},
+		{"zero min", func() []codeRange {
+			r := ok()
+			r.Min = 0
+			return []codeRange{r}
+		}, "invalid [0-199]"},
+		{"overlap", func() []codeRange {
+			b := codeRange{Var: "BRange", Name: "b", Min: 199, Max: 299}
+			return []codeRange{ok(), b}
+		}, "range b overlaps a"},
+		{"duplicate range var", func() []codeRange {
+			b := codeRange{Var: "ARange", Name: "b", Min: 200, Max: 299}
+			return []codeRange{ok(), b}
+		}, "duplicate identifier ARange"},
+		{"duplicate range name", func() []codeRange {
+			b := codeRange{Var: "BRange", Name: "a", Min: 200, Max: 299}
+			return []codeRange{ok(), b}
+		}, "duplicate range name a"},
+		{"code without name", func() []codeRange {
+			r := ok()
+			r.Codes = append(r.Codes, code{Code: 101})
+			return []codeRange{r}
+		}, "code 101 has no name"},
+		{"code out of range", func() []codeRange {
+			r := ok()
+			r.Codes = append(r.Codes, code{Name: "A2", Code: 200})
+			return []codeRange{r}
+		}, "code A2(200) out of range a [100-199]"},
+		{"duplicate code", func() []codeRange {
+			r := ok()
+			r.Codes = append(r.Codes, code{Name: "A2", Code: 100})
+			return []codeRange{r}
+		}, "duplicate code 100"},
+		{"duplicate code name", func() []codeRange {
+			r := ok()
+			r.Codes = append(r.Codes, code{Name: "A1", Code: 101})
+			return []codeRange{r}
+		}, "duplicate identifier A1"},
+		{"code name same as range var", func() []codeRange {
+			r := ok()
+			r.Codes = append(r.Codes, code{Name: "ARange", Code: 101})
+			return []codeRange{r}
+		}, "duplicate identifier ARange"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&source{Package: "ecode", Ranges: tt.ranges()})
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+// TestGenerated 检查提交的生成文件和codes.json一致
+func TestGenerated(t *testing.T) {
+	dir := t.TempDir()
+	goOut, mdOut, jsonOut := filepath.Join(dir, "ecode_gen.go"), filepath.Join(dir, "CODES.md"), filepath.Join(dir, "codes_table.json")
+	assert.NoError(t, run("../../codes.json", goOut, mdOut, jsonOut))
+
+	for out, want := range map[string]string{goOut: "../../ecode_gen.go", mdOut: "../../CODES.md", jsonOut: "../../codes_table.json"} {
+		got, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		exp, err := os.ReadFile(want)
+		assert.NoError(t, err)
+		assert.Equal(t, string(exp), string(got), "%s is out of date, run go generate", want)
+	}
+}
+
+func TestGenGoOtherPackage(t *testing.T) {
+	src := &source{Package: "errs", Ranges: []codeRange{
+		{Var: "ARange", Name: "a", Owner: "o", Min: 100, Max: 199, Codes: []code{{Name: "A2", Code: 101, Message: "b"}, {Name: "A1", Code: 100, Message: "a", Comment: "first"}}},
+	}}
+	b, err := genGo(src, "x.json")
+	assert.NoError(t, err)
+
+	s := string(b)
+	assert.Contains(t, s, `import "github.com/aaabigfish/gopkg/ecode"`)
+	assert.Contains(t, s, `var ARange = ecode.NewRange("a", "o", 100, 199)`)
+	// 按code排序
+	assert.True(t, strings.Index(s, "A1 = ") < strings.Index(s, "A2 = "))
+	assert.Contains(t, s, `ecode.Register(ARange, 100, "a") // first`)
+}
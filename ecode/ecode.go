@@ -7,7 +7,7 @@ import (
 )
 
 var (
-	_codes = map[string]struct{}{}
+	_codes = map[string]*Range{}
 )
 
 type ECode string
@@ -25,7 +25,7 @@ func add(e string) ECode {
 	if _, ok := _codes[e]; ok {
 		panic(fmt.Sprintf("ecode: %s already exist", e))
 	}
-	_codes[e] = struct{}{}
+	_codes[e] = nil
 	return Code(e)
 }
 
@@ -1,12 +1,8 @@
 package ecode
 
-// All common ecode [1000001-1000999]
+//go:generate go run ./cmd/ecodegen -in codes.json -go ecode_gen.go -md CODES.md -json codes_table.json
+
+// EcodeOk belongs to no range, ranged ecodes are declared in codes.json
 var (
 	EcodeOk = New(200) // 成功
-
-	InvalidParam = New(1000001) // 参数错误
-	NotLogin     = New(1000002) // 没有登录
-	SignCheckErr = New(1000003) // 检查签名错误
-	NotFound     = New(1000004) // 没有找到
-	Forbidden    = New(1000005) // 没有权限
 )
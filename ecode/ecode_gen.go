@@ -0,0 +1,26 @@
+// Code generated by ecodegen from codes.json. DO NOT EDIT.
+
+package ecode
+
+// CommonRange 公共错误码 [1000001-1000999] owner: platform
+var CommonRange = NewRange("common", "platform", 1000001, 1000999)
+
+var (
+	InvalidParam    = Register(CommonRange, 1000001, "参数错误")   // 参数错误
+	NotLogin        = Register(CommonRange, 1000002, "没有登录")   // 没有登录
+	SignCheckErr    = Register(CommonRange, 1000003, "签名错误")   // 检查签名错误
+	NotFound        = Register(CommonRange, 1000004, "没有找到")   // 没有找到
+	Forbidden       = Register(CommonRange, 1000005, "非法操作")   // 没有权限
+	TooManyRequests = Register(CommonRange, 1000006, "请求过于频繁") // 触发限流
+)
+
+// NotifyRange 通知错误码 [2001001-2001999] owner: notify
+var NotifyRange = NewRange("notify", "notify", 2001001, 2001999)
+
+var (
+	NotifySubmitFail   = Register(NotifyRange, 2001001, "提交失败")         // 提交失败
+	NotifyMegTooLong   = Register(NotifyRange, 2001002, "通知消息长度超过限制")   // 通知消息长度超过限制
+	NotifyTargetUrlErr = Register(NotifyRange, 2001003, "通知消息url错误")    // 通知消息url错误
+	NotifyMethodErr    = Register(NotifyRange, 2001004, "通知消息method错误") // 通知消息method错误
+	NotifyTitleErr     = Register(NotifyRange, 2001005, "通知消息title错误")  // 通知消息title错误
+)
@@ -1,16 +1,6 @@
 package ecode
 
+// messages of ecodes created by New, ecodes created by Register carry their own message
 var messages = map[int]string{
-	200:     "ok",
-	1000001: "参数错误",
-	1000002: "没有登录",
-	1000003: "签名错误",
-	1000004: "没有找到",
-	1000005: "非法操作",
-
-	2001001: "提交失败",
-	2001002: "通知消息长度超过限制",
-	2001003: "通知消息url错误",
-	2001004: "通知消息method错误",
-	2001005: "通知消息title错误",
+	200: "ok",
 }
@@ -0,0 +1,90 @@
+package ecode
+
+import (
+	"fmt"
+	"sort"
+)
+
+var (
+	_ranges []*Range
+)
+
+// Range is a block of ecodes owned by one module, e.g. common [1000001-1000999]
+type Range struct {
+	Name  string
+	Owner string
+	Min   int
+	Max   int
+}
+
+// Info describes a registered ecode
+type Info struct {
+	Code    ECode
+	Message string
+	Range   *Range // nil if the ecode is created by New
+}
+
+// NewRange declare a ecode range, it panics if the range overlaps an existing one
+func NewRange(name, owner string, min, max int) *Range {
+	if min <= 0 || max < min {
+		panic(fmt.Sprintf("ecode: invalid range %s [%d-%d]", name, min, max))
+	}
+
+	r := &Range{Name: name, Owner: owner, Min: min, Max: max}
+	for _, o := range _ranges {
+		if o.Name == name {
+			panic(fmt.Sprintf("ecode: range %s already exist", name))
+		}
+		if r.Min <= o.Max && o.Min <= r.Max {
+			panic(fmt.Sprintf("ecode: range %s overlaps %s", r, o))
+		}
+	}
+	_ranges = append(_ranges, r)
+	return r
+}
+
+// Contains reports whether the code belongs to the range
+func (r *Range) Contains(code int) bool {
+	return r.Min <= code && code <= r.Max
+}
+
+func (r *Range) String() string {
+	return fmt.Sprintf("%s(%s)[%d-%d]", r.Name, r.Owner, r.Min, r.Max)
+}
+
+// Register create a ecode inside the range with its message,
+// it panics if the code is out of range or already exist.
+func Register(r *Range, code int, msg string) ECode {
+	if r == nil {
+		panic("ecode: range must not be nil")
+	}
+	if !r.Contains(code) {
+		panic(fmt.Sprintf("ecode: %d out of range %s", code, r))
+	}
+
+	e := New(code)
+	_codes[e.String()] = r
+	if msg != "" {
+		messages[code] = msg
+	}
+	return e
+}
+
+// Ranges return all declared ranges ordered by Min
+func Ranges() []*Range {
+	rs := make([]*Range, len(_ranges))
+	copy(rs, _ranges)
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Min < rs[j].Min })
+	return rs
+}
+
+// All return all registered ecodes ordered by code
+func All() []Info {
+	infos := make([]Info, 0, len(_codes))
+	for c, r := range _codes {
+		e := Code(c)
+		infos = append(infos, Info{Code: e, Message: e.Message(), Range: r})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Code.Int() < infos[j].Code.Int() })
+	return infos
+}
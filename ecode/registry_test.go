@@ -0,0 +1,92 @@
+package ecode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRange(t *testing.T) {
+	r := NewRange("test", "tester", 9000001, 9000999)
+	assert.Equal(t, "test(tester)[9000001-9000999]", r.String())
+	assert.True(t, r.Contains(9000001))
+	assert.True(t, r.Contains(9000999))
+	assert.False(t, r.Contains(9001000))
+
+	tests := []struct {
+		name     string
+		min, max int
+	}{
+		{"test", 9100001, 9100999},         // 名字重复
+		{"zero", 0, 10},                    // 小于等于0
+		{"reverse", 9200999, 9200001},      // max < min
+		{"overlap-head", 8999990, 9000001}, // 和test重叠
+		{"overlap-tail", 9000999, 9001999},
+		{"inside", 9000100, 9000200},
+		{"outside", 8000000, 9999999},
+		{"common", 1000500, 1000600}, // 和生成的CommonRange重叠
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Panics(t, func() { NewRange(tt.name, "", tt.min, tt.max) })
+		})
+	}
+
+	// 相邻的范围不算重叠
+	next := NewRange("test-next", "tester", 9001000, 9001999)
+	assert.Contains(t, Ranges(), next)
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRange("register", "tester", 9300001, 9300999)
+
+	e := Register(r, 9300001, "测试错误")
+	assert.Equal(t, "9300001", e.String())
+	assert.Equal(t, "测试错误", e.Message())
+
+	// 没有message时使用code
+	e2 := Register(r, 9300002, "")
+	assert.Equal(t, "9300002", e2.Message())
+
+	tests := []struct {
+		name string
+		r    *Range
+		code int
+	}{
+		{"nil range", nil, 9300003},
+		{"below min", r, 9300000},
+		{"above max", r, 9301000},
+		{"duplicate", r, 9300001},
+		{"duplicate of New", r, 9300999},
+	}
+	New(9300999)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Panics(t, func() { Register(tt.r, tt.code, "x") })
+		})
+	}
+	// 和Register重复的New也会panic
+	assert.Panics(t, func() { New(9300002) })
+}
+
+func TestRangesAndAll(t *testing.T) {
+	rs := Ranges()
+	for i := 1; i < len(rs); i++ {
+		assert.True(t, rs[i-1].Min < rs[i].Min)
+	}
+
+	infos := All()
+	for i := 1; i < len(infos); i++ {
+		assert.True(t, infos[i-1].Code.Int() < infos[i].Code.Int())
+	}
+
+	var found bool
+	for _, info := range infos {
+		if info.Code == InvalidParam {
+			found = true
+			assert.Equal(t, CommonRange, info.Range)
+			assert.Equal(t, "参数错误", info.Message)
+		}
+	}
+	assert.True(t, found)
+}
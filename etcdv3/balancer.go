@@ -0,0 +1,199 @@
+package etcdv3
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aaabigfish/gopkg/config"
+)
+
+// ErrNoEndpoint is returned by balancers without endpoints.
+var ErrNoEndpoint = errors.New("no endpoint available")
+
+// Balancer picks an endpoint for each request.
+type Balancer interface {
+	// Update replaces the endpoints, it is usually called by Resolver.
+	Update(endpoints []*Endpoint)
+	// Pick returns an endpoint, key is only used by hash based balancers.
+	Pick(key string) (*Endpoint, error)
+}
+
+type roundRobin struct {
+	endpoints atomic.Value // []*Endpoint
+	next      uint64
+}
+
+// NewRoundRobin returns a balancer picking the endpoints in turn.
+func NewRoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Update(endpoints []*Endpoint) {
+	b.endpoints.Store(endpoints)
+}
+
+func (b *roundRobin) Pick(string) (*Endpoint, error) {
+	endpoints, _ := b.endpoints.Load().([]*Endpoint)
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	n := atomic.AddUint64(&b.next, 1)
+	return endpoints[(n-1)%uint64(len(endpoints))], nil
+}
+
+type weightedEndpoint struct {
+	*Endpoint
+	current int
+}
+
+type weighted struct {
+	mu        sync.Mutex
+	endpoints []*weightedEndpoint
+	total     int
+}
+
+// NewWeighted returns a smooth weighted round-robin balancer, an endpoint of
+// weight 200 is picked twice as often as one of weight 100 and the picks are
+// interleaved.
+func NewWeighted() Balancer {
+	return &weighted{}
+}
+
+func (b *weighted) Update(endpoints []*Endpoint) {
+	ws := make([]*weightedEndpoint, len(endpoints))
+	total := 0
+	for i, e := range endpoints {
+		ws[i] = &weightedEndpoint{Endpoint: e}
+		total += e.Weight
+	}
+
+	b.mu.Lock()
+	b.endpoints = ws
+	b.total = total
+	b.mu.Unlock()
+}
+
+func (b *weighted) Pick(string) (*Endpoint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *weightedEndpoint
+	for _, e := range b.endpoints {
+		e.current += e.Weight
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	if best == nil {
+		return nil, ErrNoEndpoint
+	}
+	best.current -= b.total
+	return best.Endpoint, nil
+}
+
+type zoneAware struct {
+	zone  string
+	local Balancer
+	all   Balancer
+	// hasLocal is 1 if there is any endpoint in the local zone
+	hasLocal int32
+}
+
+// NewZoneAware returns a balancer preferring the endpoints in zone, it falls
+// back to all endpoints if there is none in zone. newFn creates the underlying
+// balancer, e.g. NewWeighted. zone is config.Zone if empty.
+func NewZoneAware(zone string, newFn func() Balancer) Balancer {
+	if zone == "" {
+		zone = config.Zone
+	}
+	return &zoneAware{
+		zone:  zone,
+		local: newFn(),
+		all:   newFn(),
+	}
+}
+
+func (b *zoneAware) Update(endpoints []*Endpoint) {
+	local := make([]*Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.Zone == b.zone {
+			local = append(local, e)
+		}
+	}
+	b.local.Update(local)
+	b.all.Update(endpoints)
+	if len(local) > 0 {
+		atomic.StoreInt32(&b.hasLocal, 1)
+	} else {
+		atomic.StoreInt32(&b.hasLocal, 0)
+	}
+}
+
+func (b *zoneAware) Pick(key string) (*Endpoint, error) {
+	if atomic.LoadInt32(&b.hasLocal) == 1 {
+		return b.local.Pick(key)
+	}
+	return b.all.Pick(key)
+}
+
+const defaultReplicas = 160
+
+type hashRing struct {
+	hashes    []uint32
+	endpoints []*Endpoint
+}
+
+type consistentHash struct {
+	replicas int
+	ring     atomic.Value // *hashRing
+}
+
+// NewConsistentHash returns a balancer mapping the same key to the same
+// endpoint, only the keys of the changed endpoints move when endpoints change.
+// Each endpoint has replicas*weight/100 virtual nodes, replicas is 160 if <= 0.
+func NewConsistentHash(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &consistentHash{replicas: replicas}
+}
+
+func (b *consistentHash) Update(endpoints []*Endpoint) {
+	ring := &hashRing{}
+	for _, e := range endpoints {
+		n := b.replicas * e.Weight / defaultWeight
+		if n < 1 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			ring.hashes = append(ring.hashes, crc32.ChecksumIEEE([]byte(e.Key+"#"+strconv.Itoa(i))))
+			ring.endpoints = append(ring.endpoints, e)
+		}
+	}
+	sort.Sort(ring)
+	b.ring.Store(ring)
+}
+
+func (b *consistentHash) Pick(key string) (*Endpoint, error) {
+	ring, _ := b.ring.Load().(*hashRing)
+	if ring == nil || len(ring.hashes) == 0 {
+		return nil, ErrNoEndpoint
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= h })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.endpoints[i], nil
+}
+
+func (r *hashRing) Len() int           { return len(r.hashes) }
+func (r *hashRing) Less(i, j int) bool { return r.hashes[i] < r.hashes[j] }
+func (r *hashRing) Swap(i, j int) {
+	r.hashes[i], r.hashes[j] = r.hashes[j], r.hashes[i]
+	r.endpoints[i], r.endpoints[j] = r.endpoints[j], r.endpoints[i]
+}
@@ -14,10 +14,8 @@ func (c *Cache) UpdateByKvPair(kv []*KvEntry) {
 	c.Instances = nil
 	c.Instances = make([]*KvEntry, len(kv))
 	for i, v := range kv {
-		c.Instances[i] = &KvEntry{
-			Key:   v.Key,
-			Value: v.Value,
-		}
+		e := *v
+		c.Instances[i] = &e
 	}
 }
 
@@ -26,15 +24,22 @@ func (c *Cache) UpdateByWatchEvent(wev []*WatchEvent) {
 	defer c.mtx.Unlock()
 
 	for _, e := range wev {
-		if e.OpType == 0 {
+		if e.OpType == OpResync {
+			c.Instances = nil
+			continue
+		}
+		if e.OpType == OpPut {
 			kv, _ := c.GetKvEntry(e)
 			if kv == nil {
 				c.Instances = append(c.Instances, e.Kv)
-			} else {
-				kv.Value = e.Kv.Value
+			} else if kv.ModRevision <= e.Kv.ModRevision {
+				*kv = *e.Kv
 			}
 		} else {
 			_, i := c.GetKvEntry(e)
+			if i < 0 {
+				continue
+			}
 			if i == 0 && len(c.Instances) == 1 {
 				c.Instances = nil
 			} else {
@@ -52,3 +57,16 @@ func (c *Cache) GetKvEntry(ev *WatchEvent) (*KvEntry, int) {
 	}
 	return nil, -1
 }
+
+// Entries returns a copy of the cached instances.
+func (c *Cache) Entries() []*KvEntry {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entries := make([]*KvEntry, len(c.Instances))
+	for i, v := range c.Instances {
+		e := *v
+		entries[i] = &e
+	}
+	return entries
+}
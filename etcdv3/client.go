@@ -8,11 +8,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
 )
 
 var (
@@ -26,15 +33,35 @@ var (
 	ErrNotfound = errors.New("not found")
 )
 
-// KvEntry
+// KvEntry is a key-value pair with its revisions.
 type KvEntry struct {
 	Key   string
 	Value string
+	// CreateRevision is the revision of the last creation of the key.
+	CreateRevision int64
+	// ModRevision is the revision of the last modification of the key.
+	ModRevision int64
+	// Version is the number of modifications since the creation, reset to 0 on deletion.
+	Version int64
 }
 
+const (
+	// OpPut is the OpType of a put event.
+	OpPut int32 = int32(mvccpb.PUT)
+	// OpDelete is the OpType of a delete event.
+	OpDelete int32 = int32(mvccpb.DELETE)
+	// OpResync is the OpType of the first event of a full resync batch, Kv is nil.
+	// The following events of the batch are puts of all the current keys, the
+	// keys not in the batch were deleted.
+	OpResync int32 = -1
+)
+
+// WatchEvent is a change of a key.
 type WatchEvent struct {
 	OpType int32
 	Kv     *KvEntry
+	// Revision is the revision of the change, for OpResync it is the revision of the read.
+	Revision int64
 }
 
 // Client is a wrapper around the etcd client.
@@ -47,6 +74,10 @@ type Client interface {
 	// prefix.
 	GetEntries(prefix string) ([]*KvEntry, error)
 
+	// GetEntriesWithRevision is like GetEntries and also returns the revision
+	// of the read, watch from revision+1 to get the changes after it.
+	GetEntriesWithRevision(prefix string) ([]*KvEntry, int64, error)
+
 	// Put save data
 	Put(key, val string) (int64, int64, error)
 
@@ -56,6 +87,25 @@ type Client interface {
 	// Get query data
 	Get(key string) ([]string, error)
 
+	// GetEntry returns the entry of key with its revisions, ErrNotfound if not exists.
+	GetEntry(key string) (*KvEntry, error)
+
+	// CompareAndSwap puts val if the mod revision of key is rev, rev 0 means key
+	// must not exist. It returns false if the comparison failed.
+	CompareAndSwap(key string, rev int64, val string) (bool, error)
+
+	// CompareValueAndSwap puts val if the value of key is old.
+	CompareValueAndSwap(key, old, val string) (bool, error)
+
+	// CompareAndDelete deletes key if its mod revision is rev.
+	CompareAndDelete(key string, rev int64) (bool, error)
+
+	// PutIfAbsent puts val if key does not exist, it returns false if it exists.
+	PutIfAbsent(key, val string) (bool, error)
+
+	// Txn returns a builder of a multi-key transaction.
+	Txn() *Txn
+
 	Delete(key string, opts ...clientv3.OpOption) (int64, error)
 
 	BatchDelete(keys []string, opts ...clientv3.OpOption) error
@@ -69,14 +119,33 @@ type Client interface {
 	// context passed to the NewClient constructor is terminated.
 	WatchPrefix(prefix string, ev chan []*WatchEvent)
 
-	// Register a service with etcd.
-	Register(s Service, servCheckChan chan struct{}) error
+	// WatchPrefixFrom watches the given prefix from revision rev, 0 means the
+	// current revision. If the watch is interrupted it resumes from the last
+	// seen revision, if that revision was compacted the prefix is read again
+	// and sent as an OpResync batch. It blocks until ctx is done or the client
+	// is closed.
+	WatchPrefixFrom(ctx context.Context, prefix string, rev int64, ev chan []*WatchEvent) error
 
-	// Deregister a service with etcd.
+	// Register a service with etcd. The key is put with a lease which is kept
+	// alive, if the lease is lost (e.g. etcd restarted or the network was down
+	// longer than the TTL) a new lease is granted and the key is put again.
+	// A client can register many services, registering an existing key replaces it.
+	Register(s Service) error
+
+	// Deregister a service with etcd, the key is deleted and the lease revoked.
 	Deregister(s Service) error
 
-	// LeaseID returns the lease id created for this service instance
+	// Registration returns the registration state of the service key.
+	Registration(key string) (Registration, bool)
+
+	// Registrations returns the registration states of all services.
+	Registrations() []Registration
+
+	// LeaseID returns the lease id of the last registered service.
 	LeaseID() int64
+
+	// Close deregisters all services, stops watching and closes the etcd client.
+	Close() error
 }
 
 const minHeartBeatTime = 500 * time.Millisecond
@@ -127,19 +196,20 @@ type client struct {
 
 	kv clientv3.KV
 
-	// Watcher interface instance, used to leverage Watcher.Close()
-	watcher clientv3.Watcher
-	// watcher context
+	// watcher context, canceled on Close
 	wctx context.Context
 	// watcher cancel func
 	wcf context.CancelFunc
 
-	// leaseID will be 0 (clientv3.NoLease) if a lease was not created
+	// leaseID is the lease of the last registered service
 	leaseID clientv3.LeaseID
 
-	hbch <-chan *clientv3.LeaseKeepAliveResponse
-	// Lease interface instance, used to leverage Lease.Close()
-	leaser clientv3.Lease
+	// regop serializes Register and Deregister
+	regop         sync.Mutex
+	regmtx        sync.Mutex
+	registrations map[string]*registration
+
+	retrier *retry.Retrier
 }
 
 // ClientOptions defines options for the etcd client. All values are optional.
@@ -158,6 +228,10 @@ type ClientOptions struct {
 
 	Username string
 	Password string
+
+	// Retrier retries Put, Get, GetEntries and Delete on errors, no retry if nil.
+	// Use retry.WithRetryable(IsRetryable) to retry only transient errors.
+	Retrier *retry.Retrier
 }
 
 // NewClient returns Client with a connection to the named machines. It will
@@ -199,23 +273,51 @@ func NewClient(ctx context.Context, machines []string, options ClientOptions) (C
 		return nil, err
 	}
 
-	return &client{
-		cli: cli,
-		ctx: ctx,
-		kv:  clientv3.NewKV(cli),
-	}, nil
+	c := &client{
+		cli:           cli,
+		ctx:           ctx,
+		kv:            clientv3.NewKV(cli),
+		registrations: make(map[string]*registration),
+		retrier:       options.Retrier,
+	}
+	c.wctx, c.wcf = context.WithCancel(ctx)
+	return c, nil
+}
+
+// IsRetryable reports whether err is a transient error of etcd, such as no
+// leader or an unavailable endpoint.
+func IsRetryable(err error) bool {
+	code := status.Code(err)
+	var ee rpctypes.EtcdError
+	if errors.As(err, &ee) {
+		code = ee.Code()
+	}
+	switch code {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return retry.IsNetError(err)
+}
+
+// do calls fn with the retrier if any.
+func (c *client) do(fn func(ctx context.Context) error) error {
+	if c.retrier == nil {
+		return fn(c.ctx)
+	}
+	return c.retrier.Do(c.ctx, fn)
 }
 
 func (c *client) GetEtcdClient() *clientv3.Client { return c.cli }
 
 func (c *client) GetEtcdKV() clientv3.KV { return c.kv }
 
-// LeaseID implements the etcd Client interface.
-func (c *client) LeaseID() int64 { return int64(c.leaseID) }
-
 // Put implements the etcd Client interface.
 func (c *client) Put(key, val string) (int64, int64, error) {
-	resp, err := c.kv.Put(c.ctx, key, val, clientv3.WithPrevKV())
+	var resp *clientv3.PutResponse
+	err := c.do(func(ctx context.Context) (err error) {
+		resp, err = c.kv.Put(ctx, key, val, clientv3.WithPrevKV())
+		return err
+	})
 	if err != nil {
 		return 0, 0, err
 	}
@@ -239,7 +341,11 @@ func (c *client) Delete(key string, opts ...clientv3.OpOption) (int64, error) {
 		return 0, ErrNoKey
 	}
 
-	resp, err := c.cli.Delete(c.ctx, key, opts...)
+	var resp *clientv3.DeleteResponse
+	err := c.do(func(ctx context.Context) (err error) {
+		resp, err = c.cli.Delete(ctx, key, opts...)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -257,7 +363,11 @@ func (c *client) BatchDelete(keys []string, opts ...clientv3.OpOption) error {
 
 // Get implements the etcd Client interface.
 func (c *client) Get(key string) ([]string, error) {
-	resp, err := c.kv.Get(c.ctx, key)
+	var resp *clientv3.GetResponse
+	err := c.do(func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, key)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -270,138 +380,46 @@ func (c *client) Get(key string) ([]string, error) {
 
 // GetEntries implements the etcd Client interface.
 func (c *client) GetEntries(key string) ([]*KvEntry, error) {
-	resp, err := c.kv.Get(c.ctx, key, clientv3.WithPrefix())
-	if err != nil {
-		return nil, err
-	}
-
-	entries := make([]*KvEntry, len(resp.Kvs))
-	for i, kv := range resp.Kvs {
-		entry := &KvEntry{
-			Key:   string(kv.Key),
-			Value: string(kv.Value),
-		}
-		entries[i] = entry
-	}
-	return entries, nil
+	entries, _, err := c.GetEntriesWithRevision(key)
+	return entries, err
 }
 
-// WatchPrefix implements the etcd Client interface.
-func (c *client) WatchPrefix(prefix string, ch chan []*WatchEvent) {
-	c.wctx, c.wcf = context.WithCancel(c.ctx)
-	c.watcher = clientv3.NewWatcher(c.cli)
-
-	wch := c.watcher.Watch(c.wctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(0))
-
-	for wr := range wch {
-		if wr.Canceled {
-			return
-		}
-		evSlice := []*WatchEvent{}
-		for _, ev := range wr.Events {
-			wev := &WatchEvent{
-				OpType: int32(ev.Type),
-				Kv: &KvEntry{
-					Key:   string(ev.Kv.Key),
-					Value: string(ev.Kv.Value),
-				},
-			}
-			evSlice = append(evSlice, wev)
-		}
-		ch <- evSlice
-	}
-}
-
-func (c *client) Register(s Service, servCheckChan chan struct{}) error {
-	if s.Key == "" {
-		return ErrNoKey
-	}
-	if s.Value == "" {
-		return ErrNoValue
-	}
-
-	if c.leaser != nil {
-		c.leaser.Close()
-	}
-	c.leaser = clientv3.NewLease(c.cli)
-
-	if c.watcher != nil {
-		c.watcher.Close()
-	}
-	c.watcher = clientv3.NewWatcher(c.cli)
-	if c.kv == nil {
-		c.kv = clientv3.NewKV(c.cli)
-	}
-
-	if s.TTL == nil {
-		s.TTL = NewTTLOption(time.Second*3, time.Second*10)
-	}
-
-	grantResp, err := c.leaser.Grant(c.ctx, int64(s.TTL.ttl.Seconds()))
-	if err != nil {
+// GetEntriesWithRevision implements the etcd Client interface.
+func (c *client) GetEntriesWithRevision(key string) ([]*KvEntry, int64, error) {
+	var resp *clientv3.GetResponse
+	err := c.do(func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, key, clientv3.WithPrefix())
 		return err
-	}
-	c.leaseID = grantResp.ID
-
-	_, err = c.kv.Put(
-		c.ctx,
-		s.Key,
-		s.Value,
-		clientv3.WithLease(c.leaseID),
-	)
+	})
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
-	// this will keep the key alive 'forever' or until we revoke it or
-	// the context is canceled
-	c.hbch, err = c.leaser.KeepAlive(c.ctx, c.leaseID)
-	if err != nil {
-		return err
+	entries := make([]*KvEntry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		entries[i] = newKvEntry(kv)
 	}
-
-	// discard the keepalive response, make etcd library not to complain
-	// fix bug #799
-	go func() {
-		for {
-			select {
-			case r := <-c.hbch:
-				// avoid dead loop when channel was closed
-				if r == nil {
-					servCheckChan <- struct{}{}
-					return
-				}
-			case <-c.ctx.Done():
-				return
-			}
-		}
-	}()
-	return nil
+	return entries, resp.Header.Revision, nil
 }
 
-func (c *client) Deregister(s Service) error {
-	defer c.close()
-
-	if s.Key == "" {
-		return ErrNoKey
-	}
-	if _, err := c.cli.Delete(c.ctx, s.Key, clientv3.WithIgnoreLease()); err != nil {
-		return err
+func newKvEntry(kv *mvccpb.KeyValue) *KvEntry {
+	return &KvEntry{
+		Key:            string(kv.Key),
+		Value:          string(kv.Value),
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
 	}
+}
 
-	return nil
+// WatchPrefix implements the etcd Client interface.
+func (c *client) WatchPrefix(prefix string, ch chan []*WatchEvent) {
+	c.WatchPrefixFrom(c.wctx, prefix, 0, ch)
 }
 
-// close will close any open clients and call
-// the watcher cancel func
-func (c *client) close() {
-	if c.leaser != nil {
-		c.leaser.Close()
-	}
-	if c.watcher != nil {
-		c.watcher.Close()
-	}
-	if c.wcf != nil {
-		c.wcf()
-	}
+// Close implements the etcd Client interface.
+func (c *client) Close() error {
+	c.deregisterAll()
+	c.wcf()
+	return c.cli.Close()
 }
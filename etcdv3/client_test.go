@@ -0,0 +1,38 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("x"), false},
+		{context.Canceled, false},
+		{status.Error(codes.Unavailable, "unavailable"), true},
+		{status.Error(codes.ResourceExhausted, "too many"), true},
+		{status.Error(codes.InvalidArgument, "bad"), false},
+		{rpctypes.ErrNoLeader, true},
+		{rpctypes.ErrTooManyRequests, true},
+		{rpctypes.ErrKeyNotFound, false},
+		// 包装过的etcd错误
+		{fmt.Errorf("put: %w", rpctypes.ErrNoLeader), true},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package etcdv3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// ErrNoLeader is returned by Leader when there is no leader.
+var ErrNoLeader = concurrency.ErrElectionNoLeader
+
+// Election is a leader election on a prefix, the leader holds a lease which is
+// kept alive while it leads. If the leader dies, a new one is elected after ttl.
+type Election struct {
+	client Client
+	prefix string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	session  *concurrency.Session
+	e        *concurrency.Election
+	isLeader bool
+}
+
+// NewElection creates an election on prefix, ttl is 10s if <= 0.
+func NewElection(c Client, prefix string, ttl time.Duration) *Election {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &Election{client: c, prefix: prefix, ttl: ttl}
+}
+
+// election returns the underlying election, a new session is created if the
+// old one is lost.
+func (e *Election) election() (*concurrency.Election, *concurrency.Session, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session != nil {
+		select {
+		case <-e.session.Done():
+			e.session.Close()
+			e.session, e.e, e.isLeader = nil, nil, false
+		default:
+			return e.e, e.session, nil
+		}
+	}
+
+	session, err := newSession(context.Background(), e.client, e.ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.session, e.e = session, concurrency.NewElection(session, e.prefix)
+	return e.e, e.session, nil
+}
+
+// Campaign blocks until this instance is elected or ctx is done, val is
+// published as the value of the leader.
+func (e *Election) Campaign(ctx context.Context, val string) error {
+	ce, _, err := e.election()
+	if err != nil {
+		return err
+	}
+	if err := ce.Campaign(ctx, val); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.isLeader = e.e == ce
+	e.mu.Unlock()
+	return nil
+}
+
+// Proclaim updates the value of the leader without an election.
+func (e *Election) Proclaim(ctx context.Context, val string) error {
+	ce, _, err := e.election()
+	if err != nil {
+		return err
+	}
+	return ce.Proclaim(ctx, val)
+}
+
+// Resign gives up the leadership, another instance may be elected then.
+func (e *Election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	ce := e.e
+	e.isLeader = false
+	e.mu.Unlock()
+
+	if ce == nil {
+		return nil
+	}
+	return ce.Resign(ctx)
+}
+
+// IsLeader reports whether this instance is the leader.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.isLeader {
+		return false
+	}
+	select {
+	case <-e.session.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// Leader returns the value of the current leader, ErrNoLeader if there is none.
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	ce, _, err := e.election()
+	if err != nil {
+		return "", err
+	}
+	resp, err := ce.Leader(ctx)
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Observe returns a channel receiving the value of each new leader, it is
+// closed when ctx is done.
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string)
+	ce, _, err := e.election()
+	if err != nil {
+		log.Errorf("Election observe prefix(%s) err(%v)", e.prefix, err)
+		close(ch)
+		return ch
+	}
+
+	go func() {
+		defer close(ch)
+		for resp := range ce.Observe(ctx) {
+			if len(resp.Kvs) == 0 {
+				continue
+			}
+			select {
+			case ch <- string(resp.Kvs[0].Value):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Done returns a channel closed when the lease is lost, the leadership is lost then.
+// It returns nil before Campaign.
+func (e *Election) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.session == nil {
+		return nil
+	}
+	return e.session.Done()
+}
+
+// Close resigns and releases the lease.
+func (e *Election) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.ttl)
+	defer cancel()
+	err := e.Resign(ctx)
+
+	e.mu.Lock()
+	if e.session != nil {
+		e.session.Close()
+		e.session, e.e = nil, nil
+	}
+	e.mu.Unlock()
+	return err
+}
+
+// RunAsLeader campaigns on prefix and runs fn while this instance is the leader,
+// e.g. for singleton cron jobs. The ctx of fn is canceled when the leadership is
+// lost, then it campaigns again. It returns when ctx is done, or fn returns while
+// still leading, the leadership is resigned then.
+func RunAsLeader(ctx context.Context, c Client, prefix, val string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	e := NewElection(c, prefix, ttl)
+	defer e.Close()
+
+	for {
+		if err := e.Campaign(ctx, val); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Errorf("RunAsLeader campaign prefix(%s) err(%v)", prefix, err)
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		lost := e.Done()
+		lctx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-lctx.Done():
+			}
+		}()
+		err := fn(lctx)
+		cancel()
+
+		select {
+		case <-lost:
+			log.Warnf("RunAsLeader prefix(%s) leadership lost", prefix)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		default:
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+}
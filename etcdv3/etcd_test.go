@@ -0,0 +1,109 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/namespace"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// testEndpoint is the client url of the embedded etcd server started by TestMain.
+var testEndpoint string
+
+// testPrefixes records the key prefix of the clients returned by newTestClient.
+var testPrefixes sync.Map
+
+func TestMain(m *testing.M) {
+	os.Exit(runEtcd(m))
+}
+
+// runEtcd starts an embedded etcd server in a temp dir and runs the tests against it.
+func runEtcd(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "etcdv3-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(), freeURL()
+	if clientURL == nil || peerURL == nil {
+		fmt.Fprintln(os.Stderr, "no free port for etcd")
+		return 1
+	}
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.Name + "=" + peerURL.String()
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer e.Close()
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		fmt.Fprintln(os.Stderr, "etcd server start timeout")
+		return 1
+	}
+
+	testEndpoint = clientURL.String()
+	return m.Run()
+}
+
+func freeURL() *url.URL {
+	l, err := netListen()
+	if err != nil {
+		return nil
+	}
+	defer l.Close()
+	return &url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// newTestClient returns a client connected to the embedded etcd server, with
+// its keys under a prefix unique to the test.
+func newTestClient(t *testing.T) Client {
+	t.Helper()
+	return newPrefixedClient(t, fmt.Sprintf("/gopkg-test/%s/%d", t.Name(), time.Now().UnixNano()))
+}
+
+// newClientOf returns another client connected to the same server as c, with
+// the same key prefix.
+func newClientOf(t *testing.T, c Client) Client {
+	t.Helper()
+	prefix, _ := testPrefixes.Load(c)
+	return newPrefixedClient(t, prefix.(string))
+}
+
+func newPrefixedClient(t *testing.T, prefix string) Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, err := NewClient(ctx, []string{testEndpoint}, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	cli := c.GetEtcdClient()
+	cli.KV = namespace.NewKV(cli.KV, prefix)
+	cli.Watcher = namespace.NewWatcher(cli.Watcher, prefix)
+	cli.Lease = namespace.NewLease(cli.Lease, prefix)
+	c.(*client).kv = namespace.NewKV(c.(*client).kv, prefix)
+	testPrefixes.Store(c, prefix)
+	return c
+}
+
+func netListen() (net.Listener, error) {
+	return net.Listen("tcp", "127.0.0.1:0")
+}
@@ -0,0 +1,88 @@
+package etcdv3
+
+import (
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// GRPCScheme is the scheme of the gRPC resolver, the target is etcd:///<prefix>,
+// e.g. etcd:///service/foobar/
+const GRPCScheme = "etcd"
+
+type endpointKey struct{}
+
+// EndpointFromAddress returns the endpoint of an address resolved by the gRPC
+// resolver, it can be used by custom gRPC balancers to get weight and zone.
+func EndpointFromAddress(addr resolver.Address) (*Endpoint, bool) {
+	e, ok := addr.BalancerAttributes.Value(endpointKey{}).(*Endpoint)
+	return e, ok
+}
+
+type grpcBuilder struct {
+	client Client
+}
+
+// NewGRPCBuilder returns a gRPC resolver builder resolving etcd:///<prefix>
+// with the instances under prefix.
+//
+//	conn, err := grpc.Dial("etcd:///service/foobar/",
+//		grpc.WithResolvers(etcdv3.NewGRPCBuilder(client)),
+//		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+//	)
+func NewGRPCBuilder(c Client) resolver.Builder {
+	return &grpcBuilder{client: c}
+}
+
+func (b *grpcBuilder) Scheme() string {
+	return GRPCScheme
+}
+
+func (b *grpcBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	prefix := target.URL.Path
+	if prefix == "" {
+		prefix = target.URL.Opaque
+	}
+	if prefix == "" {
+		return nil, ErrNoKey
+	}
+
+	r, err := NewResolver(b.client, prefix)
+	if err != nil {
+		return nil, err
+	}
+	r.Watch(func(endpoints []*Endpoint) {
+		addrs := make([]resolver.Address, 0, len(endpoints))
+		for _, e := range endpoints {
+			addrs = append(addrs, resolver.Address{
+				Addr:               grpcAddr(e.Addr),
+				BalancerAttributes: attributes.New(endpointKey{}, e),
+			})
+		}
+		cc.UpdateState(resolver.State{Addresses: addrs})
+	})
+	return &grpcResolver{r: r}, nil
+}
+
+// grpcAddr strips the scheme of addresses such as grpc://10.0.0.1:8080
+func grpcAddr(addr string) string {
+	if !strings.Contains(addr, "://") {
+		return addr
+	}
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return addr
+}
+
+type grpcResolver struct {
+	r *Resolver
+}
+
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *grpcResolver) Close() {
+	r.r.Stop()
+}
@@ -1,6 +1,9 @@
 package etcdv3
 
 import (
+	"context"
+	"sync"
+
 	"github.com/aaabigfish/gopkg/log"
 )
 
@@ -10,7 +13,11 @@ type Instancer struct {
 	cache    *Cache
 	client   Client
 	prefix   string
+	rev      int64
+	ctx      context.Context
+	cancel   context.CancelFunc
 	quitc    chan struct{}
+	mu       sync.RWMutex
 	callback func([]*WatchEvent) error
 }
 
@@ -24,8 +31,11 @@ func NewInstancer(c Client, prefix string) (*Instancer, error) {
 		quitc:  make(chan struct{}),
 	}
 
-	instances, err := s.client.GetEntries(s.prefix)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	instances, rev, err := s.client.GetEntriesWithRevision(s.prefix)
 	if err == nil {
+		s.rev = rev
 		log.Info("NewInstancer prefix(%+v) instancesLen(%v)", s.prefix, len(instances))
 	} else {
 		log.Errorf("NewInstancer prefix(%+v) err(%v)", s.prefix, err)
@@ -39,14 +49,22 @@ func NewInstancer(c Client, prefix string) (*Instancer, error) {
 
 func (s *Instancer) loop() {
 	ch := make(chan []*WatchEvent)
-	go s.client.WatchPrefix(s.prefix, ch)
+	// watch the changes after the initial read, so none is missed
+	var from int64
+	if s.rev > 0 {
+		from = s.rev + 1
+	}
+	go s.client.WatchPrefixFrom(s.ctx, s.prefix, from, ch)
 
 	for {
 		select {
 		case wev := <-ch:
 			s.cache.UpdateByWatchEvent(wev)
-			if s.callback != nil {
-				s.callback(wev)
+			s.mu.RLock()
+			callback := s.callback
+			s.mu.RUnlock()
+			if callback != nil {
+				callback(wev)
 			}
 		case <-s.quitc:
 			return
@@ -56,7 +74,9 @@ func (s *Instancer) loop() {
 
 // Subscribe if watch event will notice caller.
 func (s *Instancer) Subscribe(callback func([]*WatchEvent) error) {
+	s.mu.Lock()
 	s.callback = callback
+	s.mu.Unlock()
 }
 
 func (s *Instancer) Cached() *Cache {
@@ -65,5 +85,6 @@ func (s *Instancer) Cached() *Cache {
 
 // Stop terminates the Instancer.
 func (s *Instancer) Stop() {
+	s.cancel()
 	close(s.quitc)
 }
@@ -0,0 +1,120 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// ErrLocked is returned by TryLock when the mutex is held by another session.
+var ErrLocked = concurrency.ErrLocked
+
+// ErrNotLocked is returned by Unlock when the mutex is not held.
+var ErrNotLocked = errors.New("mutex is not locked")
+
+const defaultLockTTL = 10 * time.Second
+
+// newSession creates a session whose lease is kept alive until it is closed,
+// the lease expires ttl after the process dies.
+func newSession(ctx context.Context, c Client, ttl time.Duration) (*concurrency.Session, error) {
+	seconds := int(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return concurrency.NewSession(c.GetEtcdClient(), concurrency.WithTTL(seconds), concurrency.WithContext(ctx))
+}
+
+// Mutex is a distributed lock, it is held by a lease which is kept alive while
+// locked. If the process dies, the lock is released after ttl.
+type Mutex struct {
+	client Client
+	key    string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	session *concurrency.Session
+	m       *concurrency.Mutex
+}
+
+// NewMutex creates a mutex on key, ttl is 10s if <= 0.
+func NewMutex(c Client, key string, ttl time.Duration) *Mutex {
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	return &Mutex{client: c, key: key, ttl: ttl}
+}
+
+// Lock blocks until the lock is acquired or ctx is done.
+func (m *Mutex) Lock(ctx context.Context) error {
+	return m.lock(ctx, func(cm *concurrency.Mutex) error {
+		return cm.Lock(ctx)
+	})
+}
+
+// TryLock acquires the lock without waiting, it returns ErrLocked if the lock is held by others.
+func (m *Mutex) TryLock(ctx context.Context) error {
+	return m.lock(ctx, func(cm *concurrency.Mutex) error {
+		return cm.TryLock(ctx)
+	})
+}
+
+func (m *Mutex) lock(ctx context.Context, fn func(cm *concurrency.Mutex) error) error {
+	session, err := newSession(context.Background(), m.client, m.ttl)
+	if err != nil {
+		return err
+	}
+	cm := concurrency.NewMutex(session, m.key)
+	if err := fn(cm); err != nil {
+		session.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.session != nil {
+		m.session.Close()
+	}
+	m.session, m.m = session, cm
+	return nil
+}
+
+// Unlock releases the lock.
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.m == nil {
+		return ErrNotLocked
+	}
+	err := m.m.Unlock(ctx)
+	m.session.Close()
+	m.session, m.m = nil, nil
+	return err
+}
+
+// Done returns a channel closed when the lease of the lock is lost, e.g. the
+// connection to etcd was lost longer than ttl, the lock may be held by others then.
+// It returns nil if the mutex is not locked.
+func (m *Mutex) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.session == nil {
+		return nil
+	}
+	return m.session.Done()
+}
+
+// Key returns the etcd key of the lock owner, empty if not locked.
+func (m *Mutex) Key() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.m == nil {
+		return ""
+	}
+	return m.m.Key()
+}
@@ -0,0 +1,119 @@
+package etcdv3
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutex(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	m1 := NewMutex(c, "/lock/job", time.Second)
+	m2 := NewMutex(c, "/lock/job", time.Second)
+	assert.Equal(t, ErrNotLocked, m1.Unlock(ctx))
+	assert.Nil(t, m1.Done())
+
+	assert.NoError(t, m1.Lock(ctx))
+	assert.NotEmpty(t, m1.Key())
+	assert.Equal(t, ErrLocked, m2.TryLock(ctx))
+
+	// canceled while waiting
+	wctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m2.Lock(wctx), context.DeadlineExceeded)
+
+	locked := make(chan struct{})
+	go func() {
+		assert.NoError(t, m2.Lock(ctx))
+		close(locked)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, m1.Unlock(ctx))
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after unlock")
+	}
+	assert.NoError(t, m2.Unlock(ctx))
+	assert.NoError(t, m1.TryLock(ctx))
+	assert.NoError(t, m1.Unlock(ctx))
+}
+
+func TestElection(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	e1 := NewElection(c, "/election/job", time.Second)
+	e2 := NewElection(c, "/election/job", time.Second)
+	defer e1.Close()
+	defer e2.Close()
+
+	_, err := e1.Leader(ctx)
+	assert.Equal(t, ErrNoLeader, err)
+
+	octx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	leaders := e2.Observe(octx)
+
+	assert.NoError(t, e1.Campaign(ctx, "n1"))
+	assert.True(t, e1.IsLeader())
+	assert.Equal(t, "n1", <-leaders)
+	v, err := e2.Leader(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "n1", v)
+
+	elected := make(chan struct{})
+	go func() {
+		assert.NoError(t, e2.Campaign(ctx, "n2"))
+		close(elected)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, e2.IsLeader())
+
+	assert.NoError(t, e1.Resign(ctx))
+	assert.False(t, e1.IsLeader())
+	<-elected
+	assert.True(t, e2.IsLeader())
+	assert.Equal(t, "n2", <-leaders)
+
+	assert.NoError(t, e2.Proclaim(ctx, "n2-1"))
+	assert.Equal(t, "n2-1", <-leaders)
+}
+
+func TestRunAsLeader(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var running int32
+	run := func(ctx context.Context) error {
+		if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+			t.Error("more than one leader running")
+		}
+		<-ctx.Done()
+		atomic.StoreInt32(&running, 0)
+		return ctx.Err()
+	}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- RunAsLeader(ctx, c, "/election/cron", "n", time.Second, run)
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, <-errs, context.Canceled)
+	}
+
+	// fn returning while leading ends the loop and resigns
+	done := RunAsLeader(context.Background(), c, "/election/once", "n", time.Second, func(context.Context) error { return nil })
+	assert.NoError(t, done)
+	_, err := NewElection(c, "/election/once", time.Second).Leader(context.Background())
+	assert.Equal(t, ErrNoLeader, err)
+}
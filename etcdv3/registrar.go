@@ -1,9 +1,6 @@
 package etcdv3
 
 import (
-	"sync"
-	"time"
-
 	"github.com/aaabigfish/gopkg/log"
 )
 
@@ -11,50 +8,34 @@ import (
 type Registrar struct {
 	client  Client
 	service Service
-
-	quitmtx   sync.Mutex
-	checkServ chan struct{}
-	quit      chan struct{}
 }
 
 // NewRegistrar returns a etcd Registrar acting on the provided catalog
 // registration (service).
 func NewRegistrar(client Client, service Service) *Registrar {
 	return &Registrar{
-		client:    client,
-		service:   service,
-		checkServ: make(chan struct{}, 1),
+		client:  client,
+		service: service,
 	}
 }
 
 // Register implements the sd.Registrar interface. Call it when you want your
-// service to be registered in etcd, typically at startup.
+// service to be registered in etcd, typically at startup. The registration is
+// recovered by the client automatically if the lease is lost.
 func (r *Registrar) Register() error {
-	if err := r.client.Register(r.service, r.checkServ); err != nil {
-		log.Errorf("Register(%+v) err(%v)", r, err)
+	if err := r.client.Register(r.service); err != nil {
+		log.Errorf("Register(%+v) err(%v)", r.service, err)
 		return err
 	}
-	if r.service.TTL != nil {
-		log.Warnf("Register action lease(%+v)", r.client.LeaseID())
+	if st, ok := r.client.Registration(r.service.Key); ok {
+		log.Infof("Register key(%s) lease(%x)", r.service.Key, st.LeaseID)
 	}
-
-	go r.AutoCheckService()
 	return nil
 }
 
-func (r *Registrar) AutoCheckService() {
-	for {
-		select {
-		case <-r.checkServ:
-			log.Warn("AutoCheckService repeat register")
-			err := r.Register()
-			if err != nil {
-				time.AfterFunc(3*time.Second, func() {
-					r.checkServ <- struct{}{}
-				})
-			}
-		}
-	}
+// State returns the registration state of the service.
+func (r *Registrar) State() (Registration, bool) {
+	return r.client.Registration(r.service.Key)
 }
 
 // Deregister implements the sd.Registrar interface. Call it when you want your
@@ -65,11 +46,4 @@ func (r *Registrar) Deregister() {
 	} else {
 		log.Info("action deregister")
 	}
-
-	r.quitmtx.Lock()
-	defer r.quitmtx.Unlock()
-	if r.quit != nil {
-		close(r.quit)
-		r.quit = nil
-	}
 }
@@ -0,0 +1,148 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestRegister(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	ttl := NewTTLOption(time.Second, 2*time.Second)
+
+	s1 := Service{Key: "/svc/reg/1", Value: "v1", TTL: ttl}
+	s2 := Service{Key: "/svc/reg/2", Value: "v2", TTL: ttl}
+	assert.Equal(t, ErrNoKey, c.Register(Service{Value: "v"}))
+	assert.Equal(t, ErrNoValue, c.Register(Service{Key: "k"}))
+
+	r1 := NewRegistrar(c, s1)
+	assert.NoError(t, r1.Register())
+	assert.NoError(t, c.Register(s2))
+	assert.Len(t, c.Registrations(), 2)
+
+	st, ok := r1.State()
+	assert.True(t, ok)
+	assert.Equal(t, RegStateRegistered, st.State)
+	assert.NotZero(t, st.LeaseID)
+	entries, err := c.GetEntries("/svc/reg/")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// the key is put again with a new lease after the lease is lost
+	_, err = c.GetEtcdClient().Revoke(ctx, clientv3.LeaseID(st.LeaseID))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		s, _ := r1.State()
+		return s.State == RegStateRegistered && s.LeaseID != st.LeaseID
+	}, 5*time.Second, 10*time.Millisecond)
+	st, _ = r1.State()
+	assert.Equal(t, 1, st.Recoveries)
+	v, err := c.Get(s1.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1"}, v)
+
+	// the lease is kept alive longer than the ttl
+	time.Sleep(3 * time.Second)
+	v, _ = c.Get(s2.Key)
+	assert.Equal(t, []string{"v2"}, v)
+
+	r1.Deregister()
+	_, ok = r1.State()
+	assert.False(t, ok)
+	v, _ = c.Get(s1.Key)
+	assert.Empty(t, v)
+	// the lease is revoked
+	ttlResp, err := c.GetEtcdClient().TimeToLive(ctx, clientv3.LeaseID(st.LeaseID))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), ttlResp.TTL)
+
+	// re-registering replaces the old registration
+	s2.Value = "v2-1"
+	assert.NoError(t, c.Register(s2))
+	v, _ = c.Get(s2.Key)
+	assert.Equal(t, []string{"v2-1"}, v)
+	assert.Len(t, c.Registrations(), 1)
+}
+
+func TestCloseDeregisters(t *testing.T) {
+	c := newTestClient(t)
+	other := newClientOf(t, c)
+
+	assert.NoError(t, c.Register(Service{Key: "/svc/close/1", Value: "v1"}))
+	assert.NoError(t, c.Register(Service{Key: "/svc/close/2", Value: "v2"}))
+	assert.NoError(t, c.Close())
+
+	entries, err := other.GetEntries("/svc/close/")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+	leases, err := c.GetEtcdClient().Leases(ctx)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Register(Service{Key: "/svc/concurrent/1", Value: fmt.Sprint(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	// only the last registration keeps a lease
+	st, ok := c.Registration("/svc/concurrent/1")
+	assert.True(t, ok)
+	assert.Equal(t, RegStateRegistered, st.State)
+	resp, err := c.GetEtcdClient().Leases(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, resp.Leases, len(leases.Leases)+1)
+	kv, err := c.GetEtcdClient().Get(ctx, "/svc/concurrent/1")
+	assert.NoError(t, err)
+	assert.Len(t, kv.Kvs, 1)
+	assert.Equal(t, st.LeaseID, kv.Kvs[0].Lease)
+}
+
+func TestRegisterReplaceKeepsKey(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := Service{Key: "/svc/replace/1", Value: "v1"}
+	assert.NoError(t, c.Register(s))
+	old, _ := c.Registration(s.Key)
+
+	resp, err := c.GetEtcdClient().Get(ctx, s.Key)
+	assert.NoError(t, err)
+	wch := c.GetEtcdClient().Watch(ctx, s.Key, clientv3.WithRev(resp.Header.Revision+1))
+	s.Value = "v2"
+	assert.NoError(t, c.Register(s))
+
+	// the key is put again with the new lease and never deleted
+	ev := (<-wch).Events[0]
+	assert.Equal(t, clientv3.EventTypePut, ev.Type)
+	assert.Equal(t, "v2", string(ev.Kv.Value))
+	st, _ := c.Registration(s.Key)
+	assert.Equal(t, st.LeaseID, ev.Kv.Lease)
+	select {
+	case wr := <-wch:
+		t.Fatalf("unexpected events %v", wr.Events)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the old lease is revoked
+	ttlResp, err := c.GetEtcdClient().TimeToLive(ctx, clientv3.LeaseID(old.LeaseID))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), ttlResp.TTL)
+	v, _ := c.Get(s.Key)
+	assert.Equal(t, []string{"v2"}, v)
+}
@@ -0,0 +1,287 @@
+package etcdv3
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// RegState is the state of a service registration.
+type RegState int32
+
+const (
+	// RegStateRegistered means the key is put and its lease is kept alive.
+	RegStateRegistered RegState = iota + 1
+	// RegStateRecovering means the lease was lost and the registration is being retried.
+	RegStateRecovering
+	// RegStateDeregistered means the service was deregistered.
+	RegStateDeregistered
+)
+
+func (s RegState) String() string {
+	switch s {
+	case RegStateRegistered:
+		return "registered"
+	case RegStateRecovering:
+		return "recovering"
+	case RegStateDeregistered:
+		return "deregistered"
+	default:
+		return "unknown"
+	}
+}
+
+// Registration is the state of a registered service.
+type Registration struct {
+	Key     string
+	State   RegState
+	LeaseID int64
+	// Since is the time the state was entered.
+	Since time.Time
+	// Recoveries is the number of times the registration was recovered.
+	Recoveries int
+	// Err is the last error while recovering.
+	Err error
+}
+
+type registration struct {
+	c       *client
+	service Service
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu    sync.Mutex
+	state Registration
+}
+
+// grant grants a lease and puts the key with it.
+func (r *registration) grant(ctx context.Context) (clientv3.LeaseID, error) {
+	resp, err := r.c.cli.Grant(ctx, int64(r.service.TTL.ttl.Seconds()))
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	if _, err = r.c.cli.Put(ctx, r.service.Key, r.service.Value, clientv3.WithLease(resp.ID)); err != nil {
+		r.c.cli.Revoke(context.Background(), resp.ID)
+		return clientv3.NoLease, err
+	}
+	return resp.ID, nil
+}
+
+func (r *registration) setState(state RegState, id clientv3.LeaseID, err error) {
+	r.mu.Lock()
+	if state == RegStateRegistered && r.state.State == RegStateRecovering {
+		r.state.Recoveries++
+	}
+	r.state.State = state
+	r.state.LeaseID = int64(id)
+	r.state.Since = time.Now()
+	r.state.Err = err
+	r.mu.Unlock()
+}
+
+func (r *registration) getState() Registration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+// run keeps the lease alive, and grants a new one when it is lost.
+func (r *registration) run(id clientv3.LeaseID) {
+	defer close(r.done)
+
+	recovery := retry.New(
+		retry.WithMaxAttempts(0),
+		retry.WithBackoff(retry.Exponential(500*time.Millisecond, r.service.TTL.heartbeat*2)),
+		retry.WithOnRetry(func(attempt int, err error, delay time.Duration) {
+			r.setState(RegStateRecovering, clientv3.NoLease, err)
+			log.Errorf("Register recover key(%s) attempt(%d) err(%v)", r.service.Key, attempt, err)
+		}),
+	)
+
+	for {
+		ch, err := r.c.cli.KeepAlive(r.ctx, id)
+		if err == nil {
+			// the channel is closed when the lease expired or ctx is done
+			for range ch {
+			}
+		}
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		log.Warnf("Register key(%s) lease(%x) lost, recovering", r.service.Key, id)
+		r.setState(RegStateRecovering, clientv3.NoLease, err)
+		err = recovery.Do(r.ctx, func(ctx context.Context) (err error) {
+			id, err = r.grant(ctx)
+			return err
+		})
+		if err != nil {
+			return
+		}
+		r.setState(RegStateRegistered, id, nil)
+		log.Infof("Register key(%s) recovered with lease(%x)", r.service.Key, id)
+	}
+}
+
+// stop stops keeping alive, deletes the key and revokes the lease.
+func (r *registration) stop() error {
+	r.cancel()
+	<-r.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.service.TTL.ttl)
+	defer cancel()
+	_, err := r.c.cli.Delete(ctx, r.service.Key, clientv3.WithIgnoreLease())
+	if id := clientv3.LeaseID(r.getState().LeaseID); id != clientv3.NoLease {
+		r.c.cli.Revoke(ctx, id)
+	}
+	r.setState(RegStateDeregistered, clientv3.NoLease, err)
+	return err
+}
+
+// handover stops keeping alive and revokes the lease without deleting the key,
+// which next has put with its own lease. before is the state of r before next
+// put the key.
+func (r *registration) handover(before Registration, next *registration, id clientv3.LeaseID) {
+	r.cancel()
+	<-r.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.service.TTL.ttl)
+	defer cancel()
+	after := r.getState()
+	if before.State != RegStateRegistered || after.LeaseID != before.LeaseID {
+		// r recovered meanwhile and may have put the key after next did
+		if _, err := r.c.cli.Put(ctx, next.service.Key, next.service.Value, clientv3.WithLease(id)); err != nil {
+			log.Errorf("Register key(%s) err(%v)", next.service.Key, err)
+		}
+	}
+	if lid := clientv3.LeaseID(after.LeaseID); lid != clientv3.NoLease {
+		r.c.cli.Revoke(ctx, lid)
+	}
+	r.setState(RegStateDeregistered, clientv3.NoLease, nil)
+}
+
+// Register implements the etcd Client interface.
+func (c *client) Register(s Service) error {
+	if s.Key == "" {
+		return ErrNoKey
+	}
+	if s.Value == "" {
+		return ErrNoValue
+	}
+	if s.TTL == nil {
+		s.TTL = NewTTLOption(time.Second*3, time.Second*10)
+	}
+
+	r := &registration{
+		c:       c,
+		service: s,
+		done:    make(chan struct{}),
+		state:   Registration{Key: s.Key},
+	}
+	r.ctx, r.cancel = context.WithCancel(c.ctx)
+
+	c.regop.Lock()
+	defer c.regop.Unlock()
+
+	c.regmtx.Lock()
+	old := c.registrations[s.Key]
+	c.regmtx.Unlock()
+	var before Registration
+	if old != nil {
+		before = old.getState()
+	}
+
+	// put the key with a new lease before stopping the old registration,
+	// so the key is not missing while it is replaced
+	id, err := r.grant(c.ctx)
+	if err != nil {
+		r.cancel()
+		return err
+	}
+	r.setState(RegStateRegistered, id, nil)
+
+	c.regmtx.Lock()
+	c.registrations[s.Key] = r
+	c.leaseID = id
+	c.regmtx.Unlock()
+
+	if old != nil {
+		old.handover(before, r, id)
+	}
+	go r.run(id)
+	return nil
+}
+
+// Deregister implements the etcd Client interface.
+func (c *client) Deregister(s Service) error {
+	if s.Key == "" {
+		return ErrNoKey
+	}
+
+	c.regop.Lock()
+	defer c.regop.Unlock()
+
+	c.regmtx.Lock()
+	r := c.registrations[s.Key]
+	delete(c.registrations, s.Key)
+	c.regmtx.Unlock()
+
+	if r == nil {
+		// not registered by this client, delete the key anyway
+		_, err := c.cli.Delete(c.ctx, s.Key, clientv3.WithIgnoreLease())
+		return err
+	}
+	return r.stop()
+}
+
+func (c *client) deregisterAll() {
+	c.regop.Lock()
+	defer c.regop.Unlock()
+
+	c.regmtx.Lock()
+	rs := c.registrations
+	c.registrations = make(map[string]*registration)
+	c.regmtx.Unlock()
+
+	for _, r := range rs {
+		if err := r.stop(); err != nil {
+			log.Errorf("Deregister key(%s) err(%v)", r.service.Key, err)
+		}
+	}
+}
+
+// Registration implements the etcd Client interface.
+func (c *client) Registration(key string) (Registration, bool) {
+	c.regmtx.Lock()
+	r, ok := c.registrations[key]
+	c.regmtx.Unlock()
+	if !ok {
+		return Registration{}, false
+	}
+	return r.getState(), true
+}
+
+// Registrations implements the etcd Client interface.
+func (c *client) Registrations() []Registration {
+	c.regmtx.Lock()
+	defer c.regmtx.Unlock()
+
+	res := make([]Registration, 0, len(c.registrations))
+	for _, r := range c.registrations {
+		res = append(res, r.getState())
+	}
+	return res
+}
+
+// LeaseID implements the etcd Client interface.
+func (c *client) LeaseID() int64 {
+	c.regmtx.Lock()
+	defer c.regmtx.Unlock()
+	return int64(c.leaseID)
+}
@@ -0,0 +1,155 @@
+package etcdv3
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+const defaultWeight = 100
+
+// Endpoint is a service instance parsed from an instance key registered by
+// Registrar. The value is a json object such as
+//
+//	{"addr":"10.0.0.1:8080","weight":100,"zone":"sh001","version":"v1.2.0"}
+//
+// A value which is not a json object is used as the address, e.g. "10.0.0.1:8080".
+type Endpoint struct {
+	Key      string            `json:"-"`
+	Addr     string            `json:"addr"`
+	Weight   int               `json:"weight,omitempty"`
+	Zone     string            `json:"zone,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ParseEndpoint parses the key and value of an instance, weight is 100 if not set.
+func ParseEndpoint(key, value string) (*Endpoint, error) {
+	e := &Endpoint{}
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		if err := json.Unmarshal([]byte(value), e); err != nil {
+			return nil, err
+		}
+	} else {
+		e.Addr = value
+	}
+	if e.Addr == "" {
+		return nil, ErrNoValue
+	}
+	if e.Weight <= 0 {
+		e.Weight = defaultWeight
+	}
+	e.Key = key
+	return e, nil
+}
+
+// Equal reports whether o is an *Endpoint with the same fields, it makes
+// endpoints comparable in gRPC address attributes.
+func (e *Endpoint) Equal(o interface{}) bool {
+	oe, ok := o.(*Endpoint)
+	if !ok || e.Key != oe.Key || e.Addr != oe.Addr || e.Weight != oe.Weight ||
+		e.Zone != oe.Zone || e.Version != oe.Version || len(e.Metadata) != len(oe.Metadata) {
+		return false
+	}
+	for k, v := range e.Metadata {
+		if ov, ok := oe.Metadata[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver turns the instances under a prefix into a live endpoint set.
+type Resolver struct {
+	instancer *Instancer
+
+	// deliver serializes updates and the delivery to watchers, so a watcher
+	// never receives stale endpoints after newer ones
+	deliver sync.Mutex
+
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	watchers  []func([]*Endpoint)
+}
+
+// NewResolver watches prefix with an Instancer and keeps the endpoints up to date.
+func NewResolver(c Client, prefix string) (*Resolver, error) {
+	instancer, err := NewInstancer(c, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Resolver{instancer: instancer}
+	instancer.Subscribe(func([]*WatchEvent) error {
+		r.update()
+		return nil
+	})
+	r.update()
+	return r, nil
+}
+
+func (r *Resolver) update() {
+	r.deliver.Lock()
+	defer r.deliver.Unlock()
+
+	entries := r.instancer.Cached().Entries()
+	endpoints := make([]*Endpoint, 0, len(entries))
+	for _, kv := range entries {
+		e, err := ParseEndpoint(kv.Key, kv.Value)
+		if err != nil {
+			log.Errorf("Resolver parse endpoint key(%s) value(%s) err(%v)", kv.Key, kv.Value, err)
+			continue
+		}
+		endpoints = append(endpoints, e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Key < endpoints[j].Key
+	})
+
+	r.mu.Lock()
+	r.endpoints = endpoints
+	watchers := r.watchers
+	r.mu.Unlock()
+
+	for _, w := range watchers {
+		w(endpoints)
+	}
+}
+
+// Endpoints returns the current endpoints sorted by key, it must not be modified.
+func (r *Resolver) Endpoints() []*Endpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.endpoints
+}
+
+// Watch calls f with the current endpoints and again on every change.
+// The calls are serialized, f must not modify the endpoints or call Watch.
+func (r *Resolver) Watch(f func([]*Endpoint)) {
+	r.deliver.Lock()
+	defer r.deliver.Unlock()
+
+	r.mu.Lock()
+	r.watchers = append(r.watchers, f)
+	endpoints := r.endpoints
+	r.mu.Unlock()
+
+	f(endpoints)
+}
+
+// Balancer keeps b updated with the endpoints and returns it.
+//
+//	b := r.Balancer(etcdv3.NewRoundRobin())
+//	e, err := b.Pick("")
+func (r *Resolver) Balancer(b Balancer) Balancer {
+	r.Watch(b.Update)
+	return b
+}
+
+// Stop stops watching.
+func (r *Resolver) Stop() {
+	r.instancer.Stop()
+}
@@ -0,0 +1,192 @@
+package etcdv3
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	e, err := ParseEndpoint("/svc/1", `{"addr":"10.0.0.1:80","weight":200,"zone":"z1","version":"v1","metadata":{"a":"b"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, &Endpoint{Key: "/svc/1", Addr: "10.0.0.1:80", Weight: 200, Zone: "z1", Version: "v1", Metadata: map[string]string{"a": "b"}}, e)
+
+	e, err = ParseEndpoint("/svc/2", "http://10.0.0.2:80")
+	assert.NoError(t, err)
+	assert.Equal(t, &Endpoint{Key: "/svc/2", Addr: "http://10.0.0.2:80", Weight: defaultWeight}, e)
+
+	_, err = ParseEndpoint("/svc/3", `{"addr":`)
+	assert.Error(t, err)
+	_, err = ParseEndpoint("/svc/3", `{"zone":"z1"}`)
+	assert.Error(t, err)
+}
+
+func TestResolverOrder(t *testing.T) {
+	cache := &Cache{}
+	r := &Resolver{instancer: &Instancer{cache: cache}}
+
+	// every watcher must see the endpoints grow, never an older set after a newer one
+	var wg sync.WaitGroup
+	check := func() func([]*Endpoint) {
+		last := -1
+		return func(endpoints []*Endpoint) {
+			runtime.Gosched()
+			assert.GreaterOrEqual(t, len(endpoints), last)
+			last = len(endpoints)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Watch(check())
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.UpdateByWatchEvent([]*WatchEvent{{OpType: OpPut, Kv: &KvEntry{Key: fmt.Sprintf("/svc/%d/%d", i, j), Value: "10.0.0.1:80"}}})
+				r.update()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, r.Endpoints(), 400)
+}
+
+func TestBalancers(t *testing.T) {
+	endpoints := []*Endpoint{
+		{Key: "a", Addr: "a", Weight: 100, Zone: "z1"},
+		{Key: "b", Addr: "b", Weight: 200, Zone: "z2"},
+		{Key: "c", Addr: "c", Weight: 100, Zone: "z2"},
+	}
+	pick := func(b Balancer, n int, key string) map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			e, err := b.Pick(key)
+			assert.NoError(t, err)
+			counts[e.Addr]++
+		}
+		return counts
+	}
+
+	for _, b := range []Balancer{NewRoundRobin(), NewWeighted(), NewZoneAware("z1", NewRoundRobin), NewConsistentHash(0)} {
+		_, err := b.Pick("k")
+		assert.Equal(t, ErrNoEndpoint, err)
+	}
+
+	rr := NewRoundRobin()
+	rr.Update(endpoints)
+	assert.Equal(t, map[string]int{"a": 3, "b": 3, "c": 3}, pick(rr, 9, ""))
+
+	w := NewWeighted()
+	w.Update(endpoints)
+	assert.Equal(t, map[string]int{"a": 25, "b": 50, "c": 25}, pick(w, 100, ""))
+	// smooth: the heaviest endpoint is not picked twice in a row at first
+	var seq []string
+	for i := 0; i < 4; i++ {
+		e, _ := w.Pick("")
+		seq = append(seq, e.Addr)
+	}
+	assert.Equal(t, []string{"b", "a", "c", "b"}, seq)
+
+	z := NewZoneAware("z2", NewWeighted)
+	z.Update(endpoints)
+	assert.Equal(t, map[string]int{"b": 2, "c": 1}, pick(z, 3, ""))
+	z = NewZoneAware("z3", NewRoundRobin)
+	z.Update(endpoints)
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, pick(z, 3, ""))
+
+	ch := NewConsistentHash(0)
+	ch.Update(endpoints)
+	owners := map[string]string{}
+	for i := 0; i < 1000; i++ {
+		key := "key" + string(rune('a'+i%26)) + string(rune(i))
+		e, _ := ch.Pick(key)
+		owners[key] = e.Addr
+		e2, _ := ch.Pick(key)
+		assert.Equal(t, e.Addr, e2.Addr)
+	}
+	// removing c only moves the keys of c
+	ch.Update(endpoints[:2])
+	for key, owner := range owners {
+		e, _ := ch.Pick(key)
+		if owner != "c" {
+			assert.Equal(t, owner, e.Addr)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	c := newTestClient(t)
+	c.Put("/svc/foo/1", `{"addr":"10.0.0.1:80","zone":"z1"}`)
+
+	r, err := NewResolver(c, "/svc/foo/")
+	assert.NoError(t, err)
+	defer r.Stop()
+	assert.Len(t, r.Endpoints(), 1)
+
+	ch := make(chan []*Endpoint, 10)
+	r.Watch(func(endpoints []*Endpoint) { ch <- endpoints })
+	assert.Len(t, <-ch, 1)
+
+	c.Put("/svc/foo/2", `{"addr":"10.0.0.2:80","zone":"z2","weight":50}`)
+	endpoints := <-ch
+	assert.Len(t, endpoints, 2)
+	assert.Equal(t, "10.0.0.2:80", endpoints[1].Addr)
+	assert.Equal(t, 50, endpoints[1].Weight)
+
+	// invalid values are skipped
+	c.Put("/svc/foo/3", `{"addr":`)
+	assert.Len(t, <-ch, 2)
+
+	c.Delete("/svc/foo/1")
+	endpoints = <-ch
+	assert.Len(t, endpoints, 1)
+	assert.Equal(t, "/svc/foo/2", endpoints[0].Key)
+
+	b := r.Balancer(NewRoundRobin())
+	e, err := b.Pick("")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:80", e.Addr)
+}
+
+func TestGRPCResolver(t *testing.T) {
+	c := newTestClient(t)
+
+	lis, srv := startHealthServer(t)
+	defer srv.Stop()
+	c.Put("/svc/grpc/1", `{"addr":"grpc://`+lis+`"}`)
+
+	conn, err := grpc.Dial(GRPCScheme+":///svc/grpc/",
+		grpc.WithResolvers(NewGRPCBuilder(c)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	assert.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+}
+
+func startHealthServer(t *testing.T) (string, *grpc.Server) {
+	lis, err := netListen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv
+}
@@ -0,0 +1,242 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrConflict is returned by Update when the key is modified concurrently too many times.
+var ErrConflict = errors.New("too many conflicts")
+
+const maxUpdateAttempts = 10
+
+// Txn builds a transaction: if all the comparisons succeed the Then operations
+// are applied, otherwise the Else operations. Transactions are not retried by
+// ClientOptions.Retrier since a lost response can not be told from a failure.
+//
+//	res, err := client.Txn().
+//		IfModRevision("/flags/a", rev).
+//		IfNotExists("/flags/lock").
+//		Put("/flags/a", "on").
+//		Put("/flags/b", "off").
+//		ElseGet("/flags/a").
+//		Commit()
+type Txn struct {
+	c     *client
+	cmps  []clientv3.Cmp
+	thens []clientv3.Op
+	elses []clientv3.Op
+}
+
+// TxnResult is the result of a transaction.
+type TxnResult struct {
+	// Succeeded reports whether the comparisons succeeded and the Then operations were applied.
+	Succeeded bool
+	// Revision is the revision after the transaction.
+	Revision int64
+	// Entries are the entries read by the Get operations of the applied branch.
+	Entries []*KvEntry
+}
+
+// Txn implements the etcd Client interface.
+func (c *client) Txn() *Txn {
+	return &Txn{c: c}
+}
+
+// IfModRevision requires the mod revision of key to be rev, 0 means key must not exist.
+func (t *Txn) IfModRevision(key string, rev int64) *Txn {
+	t.cmps = append(t.cmps, clientv3.Compare(clientv3.ModRevision(key), "=", rev))
+	return t
+}
+
+// IfValue requires the value of key to be val.
+func (t *Txn) IfValue(key, val string) *Txn {
+	t.cmps = append(t.cmps, clientv3.Compare(clientv3.Value(key), "=", val))
+	return t
+}
+
+// IfExists requires key to exist.
+func (t *Txn) IfExists(key string) *Txn {
+	t.cmps = append(t.cmps, clientv3.Compare(clientv3.CreateRevision(key), ">", 0))
+	return t
+}
+
+// IfNotExists requires key not to exist.
+func (t *Txn) IfNotExists(key string) *Txn {
+	t.cmps = append(t.cmps, clientv3.Compare(clientv3.CreateRevision(key), "=", 0))
+	return t
+}
+
+// Put puts key if the comparisons succeed.
+func (t *Txn) Put(key, val string, opts ...clientv3.OpOption) *Txn {
+	t.thens = append(t.thens, clientv3.OpPut(key, val, opts...))
+	return t
+}
+
+// Delete deletes key if the comparisons succeed.
+func (t *Txn) Delete(key string, opts ...clientv3.OpOption) *Txn {
+	t.thens = append(t.thens, clientv3.OpDelete(key, opts...))
+	return t
+}
+
+// Get reads key if the comparisons succeed.
+func (t *Txn) Get(key string, opts ...clientv3.OpOption) *Txn {
+	t.thens = append(t.thens, clientv3.OpGet(key, opts...))
+	return t
+}
+
+// ElsePut puts key if the comparisons fail.
+func (t *Txn) ElsePut(key, val string, opts ...clientv3.OpOption) *Txn {
+	t.elses = append(t.elses, clientv3.OpPut(key, val, opts...))
+	return t
+}
+
+// ElseDelete deletes key if the comparisons fail.
+func (t *Txn) ElseDelete(key string, opts ...clientv3.OpOption) *Txn {
+	t.elses = append(t.elses, clientv3.OpDelete(key, opts...))
+	return t
+}
+
+// ElseGet reads key if the comparisons fail.
+func (t *Txn) ElseGet(key string, opts ...clientv3.OpOption) *Txn {
+	t.elses = append(t.elses, clientv3.OpGet(key, opts...))
+	return t
+}
+
+// Commit executes the transaction.
+func (t *Txn) Commit() (*TxnResult, error) {
+	resp, err := t.c.kv.Txn(t.c.ctx).If(t.cmps...).Then(t.thens...).Else(t.elses...).Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TxnResult{
+		Succeeded: resp.Succeeded,
+		Revision:  resp.Header.Revision,
+	}
+	for _, r := range resp.Responses {
+		if rr := r.GetResponseRange(); rr != nil {
+			for _, kv := range rr.Kvs {
+				res.Entries = append(res.Entries, newKvEntry(kv))
+			}
+		}
+	}
+	return res, nil
+}
+
+// GetEntry implements the etcd Client interface.
+func (c *client) GetEntry(key string) (*KvEntry, error) {
+	if key == "" {
+		return nil, ErrNoKey
+	}
+
+	var resp *clientv3.GetResponse
+	err := c.do(func(ctx context.Context) (err error) {
+		resp, err = c.kv.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotfound
+	}
+	return newKvEntry(resp.Kvs[0]), nil
+}
+
+// CompareAndSwap implements the etcd Client interface.
+func (c *client) CompareAndSwap(key string, rev int64, val string) (bool, error) {
+	if key == "" {
+		return false, ErrNoKey
+	}
+	res, err := c.Txn().IfModRevision(key, rev).Put(key, val).Commit()
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// CompareValueAndSwap implements the etcd Client interface.
+func (c *client) CompareValueAndSwap(key, old, val string) (bool, error) {
+	if key == "" {
+		return false, ErrNoKey
+	}
+	res, err := c.Txn().IfValue(key, old).Put(key, val).Commit()
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// CompareAndDelete implements the etcd Client interface.
+func (c *client) CompareAndDelete(key string, rev int64) (bool, error) {
+	if key == "" {
+		return false, ErrNoKey
+	}
+	res, err := c.Txn().IfModRevision(key, rev).Delete(key).Commit()
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// PutIfAbsent implements the etcd Client interface.
+func (c *client) PutIfAbsent(key, val string) (bool, error) {
+	if key == "" {
+		return false, ErrNoKey
+	}
+	res, err := c.Txn().IfNotExists(key).Put(key, val).Commit()
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// Update reads the json value of key, calls fn with it and writes the result
+// back if key was not modified meanwhile, otherwise it tries again. fn gets the
+// zero value if key does not exist, it may be called more than once. If fn
+// returns an error nothing is written. It returns ErrConflict after 10 conflicts.
+//
+//	flags, err := etcdv3.Update(client, "/flags", func(old Flags) (Flags, error) {
+//		old.NewCheckout = true
+//		return old, nil
+//	})
+func Update[T any](c Client, key string, fn func(old T) (T, error)) (T, error) {
+	var zero T
+	for i := 0; i < maxUpdateAttempts; i++ {
+		var old T
+		var rev int64
+		e, err := c.GetEntry(key)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal([]byte(e.Value), &old); err != nil {
+				return zero, fmt.Errorf("decode key(%s) err(%w)", key, err)
+			}
+			rev = e.ModRevision
+		case errors.Is(err, ErrNotfound):
+		default:
+			return zero, err
+		}
+
+		val, err := fn(old)
+		if err != nil {
+			return zero, err
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return zero, err
+		}
+		ok, err := c.CompareAndSwap(key, rev, string(b))
+		if err != nil {
+			return zero, err
+		}
+		if ok {
+			return val, nil
+		}
+	}
+	return zero, ErrConflict
+}
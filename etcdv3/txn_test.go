@@ -0,0 +1,113 @@
+package etcdv3
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	c := newTestClient(t)
+
+	ok, err := c.PutIfAbsent("/cas/a", "1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = c.PutIfAbsent("/cas/a", "2")
+	assert.False(t, ok)
+
+	e, err := c.GetEntry("/cas/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", e.Value)
+
+	ok, _ = c.CompareAndSwap("/cas/a", e.ModRevision-1, "2")
+	assert.False(t, ok)
+	ok, _ = c.CompareAndSwap("/cas/a", e.ModRevision, "2")
+	assert.True(t, ok)
+
+	ok, _ = c.CompareValueAndSwap("/cas/a", "1", "3")
+	assert.False(t, ok)
+	ok, _ = c.CompareValueAndSwap("/cas/a", "2", "3")
+	assert.True(t, ok)
+
+	e, _ = c.GetEntry("/cas/a")
+	ok, _ = c.CompareAndDelete("/cas/a", e.ModRevision)
+	assert.True(t, ok)
+	_, err = c.GetEntry("/cas/a")
+	assert.Equal(t, ErrNotfound, err)
+
+	// rev 0 means the key must not exist
+	ok, _ = c.CompareAndSwap("/cas/a", 0, "4")
+	assert.True(t, ok)
+}
+
+func TestTxn(t *testing.T) {
+	c := newTestClient(t)
+	c.Put("/txn/a", "1")
+
+	res, err := c.Txn().IfValue("/txn/a", "1").IfNotExists("/txn/b").
+		Put("/txn/a", "2").Put("/txn/b", "2").Get("/txn/a").
+		ElseGet("/txn/b").Commit()
+	assert.NoError(t, err)
+	assert.True(t, res.Succeeded)
+	assert.Len(t, res.Entries, 1)
+	assert.Equal(t, "2", res.Entries[0].Value)
+	assert.Equal(t, res.Revision, res.Entries[0].ModRevision)
+
+	res, err = c.Txn().IfNotExists("/txn/b").Delete("/txn/a").ElseGet("/txn/b").Commit()
+	assert.NoError(t, err)
+	assert.False(t, res.Succeeded)
+	assert.Equal(t, "/txn/b", res.Entries[0].Key)
+	v, _ := c.Get("/txn/a")
+	assert.Equal(t, []string{"2"}, v)
+}
+
+type flags struct {
+	Counter int             `json:"counter"`
+	On      map[string]bool `json:"on"`
+}
+
+func TestUpdate(t *testing.T) {
+	c := newTestClient(t)
+	other := newClientOf(t, c)
+
+	f, err := Update(c, "/flags", func(old flags) (flags, error) {
+		old.On = map[string]bool{"a": true}
+		return old, nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, f.On["a"])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(cli Client) {
+			defer wg.Done()
+			_, err := Update(cli, "/flags", func(old flags) (flags, error) {
+				old.Counter++
+				return old, nil
+			})
+			assert.NoError(t, err)
+		}([]Client{c, other}[i%2])
+	}
+	wg.Wait()
+
+	f, _ = Update(c, "/flags", func(old flags) (flags, error) { return old, nil })
+	assert.Equal(t, 5, f.Counter)
+	assert.True(t, f.On["a"])
+
+	// an error of fn writes nothing
+	boom := errors.New("boom")
+	_, err = Update(c, "/flags", func(old flags) (flags, error) {
+		old.Counter = 100
+		return old, boom
+	})
+	assert.Equal(t, boom, err)
+	e, _ := c.GetEntry("/flags")
+	assert.JSONEq(t, `{"counter":5,"on":{"a":true}}`, e.Value)
+
+	c.Put("/flags/bad", "{")
+	_, err = Update(c, "/flags/bad", func(old flags) (flags, error) { return old, nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package etcdv3
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+const watchRetryInterval = time.Second
+
+// WatchPrefixFrom implements the etcd Client interface.
+func (c *client) WatchPrefixFrom(ctx context.Context, prefix string, rev int64, ch chan []*WatchEvent) error {
+	// stop when either ctx or the client is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.wctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	send := func(evs []*WatchEvent) bool {
+		select {
+		case ch <- evs:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithProgressNotify()}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+
+		// fail the watch if the member lost its leader, so it resumes on another member
+		wctx, wcancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		var err error
+		for wr := range c.cli.Watch(wctx, prefix, opts...) {
+			if err = wr.Err(); err != nil {
+				break
+			}
+			rev = nextRevision(rev, wr)
+			if len(wr.Events) == 0 {
+				continue
+			}
+			evs := make([]*WatchEvent, 0, len(wr.Events))
+			for _, ev := range wr.Events {
+				evs = append(evs, &WatchEvent{
+					OpType:   int32(ev.Type),
+					Kv:       newKvEntry(ev.Kv),
+					Revision: ev.Kv.ModRevision,
+				})
+			}
+			if !send(evs) {
+				break
+			}
+		}
+		wcancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err == rpctypes.ErrCompacted {
+			log.Warnf("WatchPrefix prefix(%s) revision(%d) compacted, resync", prefix, rev)
+			entries, r, err := c.GetEntriesWithRevision(prefix)
+			if err == nil {
+				evs := make([]*WatchEvent, 0, len(entries)+1)
+				evs = append(evs, &WatchEvent{OpType: OpResync, Revision: r})
+				for _, e := range entries {
+					evs = append(evs, &WatchEvent{OpType: OpPut, Kv: e, Revision: e.ModRevision})
+				}
+				if !send(evs) {
+					return ctx.Err()
+				}
+				rev = r + 1
+				continue
+			}
+			log.Errorf("WatchPrefix prefix(%s) resync err(%v)", prefix, err)
+		} else {
+			log.Warnf("WatchPrefix prefix(%s) interrupted at revision(%d) err(%v), resume", prefix, rev, err)
+		}
+
+		select {
+		case <-time.After(watchRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// nextRevision returns the revision to resume a watch from after wr. A progress
+// notification means all the changes up to its header revision were sent, so
+// an idle watch resumes after it and is not compacted. The header revision of
+// a response with events can be ahead of the events not sent yet, the watch
+// resumes after the last event then.
+func nextRevision(rev int64, wr clientv3.WatchResponse) int64 {
+	if n := len(wr.Events); n > 0 {
+		rev = wr.Events[n-1].Kv.ModRevision + 1
+	} else if wr.IsProgressNotify() && wr.Header.Revision >= rev {
+		rev = wr.Header.Revision + 1
+	}
+	return rev
+}
+
+// Event is a change of a json value watched by Watch.
+type Event[T any] struct {
+	// OpType is OpPut, OpDelete or OpResync, see WatchEvent.
+	OpType   int32
+	Key      string
+	Value    T
+	Revision int64
+	// Err is the error decoding the value of a put, Value is the zero value then.
+	Err error
+}
+
+// Watch watches the json values under prefix and decodes them into T. The first
+// batch is an OpResync batch of the current values, the following ones are
+// the changes, a compaction causes another OpResync batch. The channel is
+// closed when ctx or the client is done.
+//
+//	ch, err := etcdv3.Watch[Config](ctx, client, "/config/")
+//	for evs := range ch {
+//		for _, ev := range evs {
+//			...
+//		}
+//	}
+func Watch[T any](ctx context.Context, c Client, prefix string) (<-chan []Event[T], error) {
+	entries, rev, err := c.GetEntriesWithRevision(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	first := make([]Event[T], 0, len(entries)+1)
+	first = append(first, Event[T]{OpType: OpResync, Revision: rev})
+	for _, e := range entries {
+		first = append(first, decodeEvent[T](&WatchEvent{OpType: OpPut, Kv: e, Revision: e.ModRevision}))
+	}
+
+	out := make(chan []Event[T], 1)
+	out <- first
+
+	in := make(chan []*WatchEvent)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.WatchPrefixFrom(ctx, prefix, rev+1, in)
+	}()
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case wevs := <-in:
+				evs := make([]Event[T], 0, len(wevs))
+				for _, wev := range wevs {
+					evs = append(evs, decodeEvent[T](wev))
+				}
+				select {
+				case out <- evs:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func decodeEvent[T any](wev *WatchEvent) Event[T] {
+	ev := Event[T]{OpType: wev.OpType, Revision: wev.Revision}
+	if wev.Kv == nil {
+		return ev
+	}
+	ev.Key = wev.Kv.Key
+	if wev.OpType == OpPut {
+		ev.Err = json.Unmarshal([]byte(wev.Kv.Value), &ev.Value)
+	}
+	return ev
+}
@@ -0,0 +1,166 @@
+package etcdv3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestNextRevision(t *testing.T) {
+	header := etcdserverpb.ResponseHeader{Revision: 20}
+	events := []*clientv3.Event{{Kv: &mvccpb.KeyValue{ModRevision: 5}}, {Kv: &mvccpb.KeyValue{ModRevision: 7}}}
+
+	// resume after the last event, more events may follow up to the header revision
+	assert.Equal(t, int64(8), nextRevision(3, clientv3.WatchResponse{Header: header, Events: events}))
+	// a progress notification advances an idle watch
+	assert.Equal(t, int64(21), nextRevision(8, clientv3.WatchResponse{Header: header}))
+	assert.Equal(t, int64(30), nextRevision(30, clientv3.WatchResponse{Header: header}))
+	// the created response does not, the events before it are not sent yet
+	assert.Equal(t, int64(3), nextRevision(3, clientv3.WatchResponse{Header: header, Created: true}))
+}
+
+func recvEvents(t *testing.T, ch chan []*WatchEvent) []*WatchEvent {
+	t.Helper()
+	select {
+	case evs := <-ch:
+		return evs
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event")
+		return nil
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	c := newTestClient(t)
+	c.Put("/rev/a", "1")
+	c.Put("/rev/a", "2")
+
+	entries, rev, err := c.GetEntriesWithRevision("/rev/")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, rev, entries[0].ModRevision)
+	assert.Equal(t, rev-1, entries[0].CreateRevision)
+	assert.Equal(t, int64(2), entries[0].Version)
+}
+
+func TestWatchPrefixFrom(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.Put("/watch/a", "1")
+	_, rev, _ := c.GetEntriesWithRevision("/watch/")
+	c.Put("/watch/b", "2")
+	c.Delete("/watch/a")
+
+	// resume from a past revision gets the changes after it
+	ch := make(chan []*WatchEvent)
+	done := make(chan error)
+	go func() { done <- c.WatchPrefixFrom(ctx, "/watch/", rev+1, ch) }()
+
+	var evs []*WatchEvent
+	for len(evs) < 2 {
+		evs = append(evs, recvEvents(t, ch)...)
+	}
+	assert.Equal(t, OpPut, evs[0].OpType)
+	assert.Equal(t, "/watch/b", evs[0].Kv.Key)
+	assert.Equal(t, rev+1, evs[0].Revision)
+	assert.Equal(t, OpDelete, evs[1].OpType)
+	assert.Equal(t, "/watch/a", evs[1].Kv.Key)
+	assert.Equal(t, rev+2, evs[1].Revision)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestWatchCompacted(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.Put("/compact/a", "1")
+	_, rev, _ := c.GetEntriesWithRevision("/compact/")
+	c.Put("/compact/b", "2")
+	c.Delete("/compact/a")
+	_, last, _ := c.GetEntriesWithRevision("/compact/")
+	_, err := c.GetEtcdClient().Compact(ctx, last)
+	assert.NoError(t, err)
+
+	ch := make(chan []*WatchEvent)
+	go c.WatchPrefixFrom(ctx, "/compact/", rev, ch)
+
+	evs := recvEvents(t, ch)
+	assert.Len(t, evs, 2)
+	assert.Equal(t, OpResync, evs[0].OpType)
+	assert.Equal(t, last, evs[0].Revision)
+	assert.Equal(t, "/compact/b", evs[1].Kv.Key)
+
+	// a cache applying the resync only keeps the current keys
+	cache := &Cache{}
+	cache.UpdateByKvPair([]*KvEntry{{Key: "/compact/a", Value: "1"}})
+	cache.UpdateByWatchEvent(evs)
+	assert.Equal(t, []*KvEntry{evs[1].Kv}, cache.Entries())
+
+	// then the watch continues
+	c.Put("/compact/c", "3")
+	evs = recvEvents(t, ch)
+	assert.Equal(t, "/compact/c", evs[0].Kv.Key)
+}
+
+type testConfig struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+func TestWatchTyped(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.PutJSON("/typed/a", testConfig{Name: "a", Size: 1})
+	ch, err := Watch[testConfig](ctx, c, "/typed/")
+	assert.NoError(t, err)
+
+	evs := <-ch
+	assert.Len(t, evs, 2)
+	assert.Equal(t, OpResync, evs[0].OpType)
+	assert.Equal(t, Event[testConfig]{OpType: OpPut, Key: "/typed/a", Value: testConfig{Name: "a", Size: 1}, Revision: evs[1].Revision}, evs[1])
+
+	c.PutJSON("/typed/b", testConfig{Name: "b", Size: 2})
+	evs = <-ch
+	assert.Equal(t, testConfig{Name: "b", Size: 2}, evs[0].Value)
+
+	c.Put("/typed/c", "not json")
+	evs = <-ch
+	assert.Error(t, evs[0].Err)
+	assert.Equal(t, testConfig{}, evs[0].Value)
+
+	c.Delete("/typed/a")
+	evs = <-ch
+	assert.Equal(t, OpDelete, evs[0].OpType)
+	assert.Equal(t, "/typed/a", evs[0].Key)
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchTypedClientClose(t *testing.T) {
+	c := newTestClient(t)
+	ch, err := Watch[testConfig](context.Background(), c, "/typed/")
+	assert.NoError(t, err)
+	<-ch
+
+	// the channel is closed with the client
+	c.Close()
+	select {
+	case _, ok := <-ch:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed")
+	}
+}
@@ -0,0 +1,55 @@
+package ginx
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aaabigfish/gopkg/cloud/ratelimit"
+	"github.com/aaabigfish/gopkg/ecode"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// ClientIP 以客户端ip作为限流key
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RateLimit 限流中间件，key 为 nil 时所有请求共用同一个key，被限流时返回 429 和 ecode.TooManyRequests。
+// 限流器出错（例如redis不可用）时放行请求
+func RateLimit(l ratelimit.Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var k string
+		if key != nil {
+			k = key(c)
+		}
+		ok, err := l.Allow(c.Request.Context(), k)
+		if err != nil {
+			log.Errorf("ginx: ratelimit key(%s) err(%v)", k, err)
+			ok = true
+		}
+		if !ok {
+			abortTooManyRequests(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Shedding 自适应过载保护中间件，cpu过高且并发超过处理能力时返回 429 和 ecode.TooManyRequests
+func Shedding(b *ratelimit.BBR) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done, err := b.Allow()
+		if err != nil {
+			abortTooManyRequests(c)
+			return
+		}
+		defer done()
+		c.Next()
+	}
+}
+
+func abortTooManyRequests(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusTooManyRequests,
+		NewFailMsg(ecode.TooManyRequests.Message(), ecode.TooManyRequests.String()))
+}
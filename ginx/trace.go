@@ -0,0 +1,47 @@
+package ginx
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+// TraceContext returns a middleware that reads metainfo, W3C traceparent/tracestate
+// and baggage from the request headers, and starts a span for each request.
+// The span is exported if a cloud/trace provider is set.
+// Use metainfo.TraceID(c.Request.Context()) to get the trace id in handlers.
+func TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := metainfo.HTTPHeader(c.Request.Header)
+		ctx := metainfo.FromHTTPHeader(c.Request.Context(), h)
+		ctx = metainfo.FromBaggageHeader(ctx, h)
+		ctx = metainfo.FromTraceHeader(ctx, h)
+		ctx = metainfo.TransferForward(ctx)
+
+		route := c.FullPath()
+		ctx, span := trace.Start(ctx, c.Request.Method+" "+route, trace.WithKind(trace.KindServer), trace.WithAttributes(
+			trace.String("http.method", c.Request.Method),
+			trace.String("http.route", route),
+			trace.String("http.target", c.Request.URL.Path),
+		))
+		if span == nil {
+			ctx, _ = metainfo.StartSpan(ctx)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(trace.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(trace.StatusError, http.StatusText(status))
+		}
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err.Err)
+		}
+		span.End()
+	}
+}
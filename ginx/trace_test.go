@@ -0,0 +1,95 @@
+package ginx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func serveTrace(t *testing.T, req *http.Request, h gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(TraceContext())
+	r.GET("/orders/:id", h)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTraceContext(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set("traceparent", traceParent)
+	req.Header.Set("baggage", "user_id=42")
+	req.Header.Set(metainfo.HTTPPrefixTransient+"tk", "tv")
+
+	var called bool
+	serveTrace(t, req, func(c *gin.Context) {
+		called = true
+		ctx := c.Request.Context()
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", metainfo.TraceID(ctx))
+		// 新的span
+		assert.NotEqual(t, "00f067aa0ba902b7", metainfo.SpanID(ctx))
+		assert.NotEmpty(t, metainfo.SpanID(ctx))
+
+		v, ok := metainfo.GetPersistentValue(ctx, "user_id")
+		assert.True(t, ok && v == "42", v)
+		v, ok = metainfo.GetValue(ctx, "TK")
+		assert.True(t, ok && v == "tv", v)
+	})
+	assert.True(t, called)
+}
+
+func TestTraceContextNewTrace(t *testing.T) {
+	var traceID string
+	serveTrace(t, httptest.NewRequest(http.MethodGet, "/orders/1", nil), func(c *gin.Context) {
+		traceID = metainfo.TraceID(c.Request.Context())
+	})
+	assert.Len(t, traceID, 32)
+
+	// 非法的traceparent开始新的trace
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	serveTrace(t, req, func(c *gin.Context) {
+		id := metainfo.TraceID(c.Request.Context())
+		assert.Len(t, id, 32)
+		assert.NotEqual(t, "00000000000000000000000000000000", id)
+	})
+}
+
+func TestTraceContextSpan(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set("traceparent", traceParent)
+	var spanID string
+	w := serveTrace(t, req, func(c *gin.Context) {
+		spanID = metainfo.SpanID(c.Request.Context())
+		c.Status(http.StatusBadGateway)
+	})
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	spans := me.Spans()
+	assert.Len(t, spans, 1)
+	s := spans[0]
+	assert.Equal(t, "GET /orders/:id", s.Name)
+	assert.Equal(t, trace.KindServer, s.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", s.ParentSpanID.String())
+	assert.Equal(t, spanID, s.SpanContext.SpanID.String())
+	assert.Equal(t, trace.StatusError, s.Status.Code)
+	assert.Contains(t, s.Attributes, trace.Int("http.status_code", http.StatusBadGateway))
+	assert.Contains(t, s.Attributes, trace.String("http.route", "/orders/:id"))
+}
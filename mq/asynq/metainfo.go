@@ -0,0 +1,112 @@
+package asynq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+// envelope 携带metainfo的任务payload
+type envelope struct {
+	MetaInfo map[string]string `json:"_metainfo"`
+	Payload  json.RawMessage   `json:"_payload,omitempty"`
+
+	// 以下字段由mq.Publisher写入，payload不是合法的json时写入Body
+	Body []byte `json:"_body,omitempty"`
+	Key  []byte `json:"_key,omitempty"`
+	Time int64  `json:"_time,omitempty"`
+}
+
+var envelopePrefix = []byte(`{"_metainfo":`)
+
+func decodeEnvelope(m *Message) (*envelope, bool) {
+	if m == nil || !bytes.HasPrefix(m.Payload(), envelopePrefix) {
+		return nil, false
+	}
+	e := &envelope{}
+	if err := json.Unmarshal(m.Payload(), e); err != nil {
+		return nil, false
+	}
+	return e, true
+}
+
+func (e *envelope) payload() []byte {
+	if e.Payload != nil {
+		return e.Payload
+	}
+	return e.Body
+}
+
+// wrapPayload 将ctx中的metainfo（transient和persistent）、trace context和payload打包，都没有时原样返回
+func wrapPayload(ctx context.Context, payload []byte) ([]byte, error) {
+	m := make(map[string]string)
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	if len(m) == 0 {
+		return payload, nil
+	}
+	return json.Marshal(&envelope{MetaInfo: m, Payload: payload})
+}
+
+// marshal 将ctx中的metainfo和trace context合并到消息头后编码，ctx中的优先
+func (e *envelope) marshal(ctx context.Context) ([]byte, error) {
+	m := make(map[string]string, len(e.MetaInfo))
+	for k, v := range e.MetaInfo {
+		m[k] = v
+	}
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	pe := *e
+	pe.MetaInfo = m
+	return json.Marshal(&pe)
+}
+
+type payloadKey struct{}
+
+type unwrapped struct {
+	task    *Message
+	payload []byte
+}
+
+// ExtractMetaInfo 从SendContext写入的任务中恢复metainfo和trace context到ctx，原始payload使用Payload读取。
+// 不是SendContext写入的任务原样返回ctx。
+func ExtractMetaInfo(ctx context.Context, m *Message) context.Context {
+	e, ok := decodeEnvelope(m)
+	if !ok {
+		return ctx
+	}
+	ctx = metainfo.SetMetaInfoFromMap(ctx, e.MetaInfo)
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.MapHeader(e.MetaInfo))
+	ctx = context.WithValue(ctx, payloadKey{}, &unwrapped{task: m, payload: e.payload()})
+	return metainfo.TransferForward(ctx)
+}
+
+// Payload 返回任务的原始payload，SendContext写入的任务去掉metainfo，其他任务等同于m.Payload()
+func Payload(ctx context.Context, m *Message) []byte {
+	if u, ok := ctx.Value(payloadKey{}).(*unwrapped); ok && u.task == m {
+		return u.payload
+	}
+	if e, ok := decodeEnvelope(m); ok {
+		return e.payload()
+	}
+	return m.Payload()
+}
+
+// WithMetaInfo 包装HandlerFunc，处理前恢复metainfo并创建消费span，处理SendContext写入的任务时使用。
+// 处理函数收到的是原始的任务（ResultWriter等可用），payload使用Payload(ctx, m)读取
+func WithMetaInfo(h HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, m *Message) error {
+		ctx = ExtractMetaInfo(ctx, m)
+		ctx, span := trace.Start(ctx, "asynq.receive", trace.WithKind(trace.KindConsumer), trace.WithAttributes(
+			trace.String("messaging.system", "asynq"),
+			trace.String("messaging.destination", m.Type()),
+		))
+		err := h(ctx, m)
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package asynq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+func TestMetaInfoPropagation(t *testing.T) {
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+	ctx = metainfo.WithValue(ctx, "tk", "tv")
+	ctx, _ = metainfo.StartSpan(ctx)
+
+	payload, err := wrapPayload(ctx, []byte(`{"id":1}`))
+	assert.NoError(t, err)
+	task := asynq.NewTask("orders", payload)
+
+	var called bool
+	h := WithMetaInfo(func(hctx context.Context, m *Message) error {
+		called = true
+		// 原始任务，ResultWriter等不会丢失
+		assert.True(t, m == task)
+		assert.Equal(t, []byte(`{"id":1}`), Payload(hctx, m))
+
+		v, ok := metainfo.GetPersistentValue(hctx, "trace_id")
+		assert.True(t, ok && v == "t1", v)
+		v, ok = metainfo.GetValue(hctx, "tk")
+		assert.True(t, ok && v == "tv", v)
+		assert.Equal(t, metainfo.TraceID(ctx), metainfo.TraceID(hctx))
+		return nil
+	})
+	assert.NoError(t, h(context.Background(), task))
+	assert.True(t, called)
+
+	// 没有经过WithMetaInfo时也能解析
+	assert.Equal(t, []byte(`{"id":1}`), Payload(context.Background(), task))
+}
+
+func TestPayloadWithoutMetaInfo(t *testing.T) {
+	// ctx中没有metainfo时payload原样写入
+	payload, err := wrapPayload(context.Background(), []byte(`{"id":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"id":1}`), payload)
+
+	task := asynq.NewTask("orders", payload)
+	ctx := ExtractMetaInfo(context.Background(), task)
+	assert.Equal(t, context.Background(), ctx)
+	assert.Equal(t, payload, Payload(ctx, task))
+
+	// 其他任务的ctx不会影响
+	other, _ := wrapPayload(metainfo.WithPersistentValue(context.Background(), "k", "v"), []byte(`2`))
+	ctx = ExtractMetaInfo(context.Background(), asynq.NewTask("other", other))
+	assert.Equal(t, payload, Payload(ctx, task))
+}
+
+func TestConsumerSpan(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	ctx, producer := trace.Start(context.Background(), "asynq.send", trace.WithKind(trace.KindProducer))
+	payload, _ := wrapPayload(ctx, []byte(`1`))
+	producer.End()
+
+	h := WithMetaInfo(func(ctx context.Context, m *Message) error { return errors.New("boom") })
+	assert.Error(t, h(context.Background(), asynq.NewTask("orders", payload)))
+
+	spans := me.Spans()
+	assert.Len(t, spans, 2)
+	s := spans[1]
+	assert.Equal(t, "asynq.receive", s.Name)
+	assert.Equal(t, trace.KindConsumer, s.Kind)
+	assert.Equal(t, producer.SpanContext().TraceID, s.SpanContext.TraceID)
+	assert.Equal(t, producer.SpanContext().SpanID, s.ParentSpanID)
+	assert.Equal(t, trace.StatusError, s.Status.Code)
+	assert.Contains(t, s.Attributes, trace.String("messaging.destination", "orders"))
+}
@@ -0,0 +1,132 @@
+package asynq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+type publisher struct {
+	w    Writer
+	opts []asynq.Option
+}
+
+// NewPublisher 将Writer适配为mq.Publisher，消息的topic作为任务类型，为空时使用Writer的topic。
+// key、消息头和时间随payload一起用Writer.SendContext写入，opts是入队选项
+func NewPublisher(w Writer, opts ...asynq.Option) mq.Publisher {
+	return &publisher{w: w, opts: opts}
+}
+
+func (p *publisher) Publish(ctx context.Context, msgs ...*mq.Message) error {
+	for _, m := range msgs {
+		topic := m.Topic
+		if topic == "" {
+			topic = p.w.Topic()
+		}
+		if topic == "" {
+			return errors.New("topic is empty")
+		}
+
+		e := &envelope{MetaInfo: m.Headers, Key: m.Key, Time: m.Time.UnixNano()}
+		if m.Time.IsZero() {
+			e.Time = time.Now().UnixNano()
+		}
+		if json.Valid(m.Body) {
+			e.Payload = m.Body
+		} else {
+			e.Body = m.Body
+		}
+		if _, err := p.w.SendContext(ctx, topic, e, p.opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *publisher) Close() error {
+	return p.w.Close()
+}
+
+type subscriber struct {
+	r         Reader
+	topics    []string
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewSubscriber 将Reader适配为mq.Subscriber，topics是处理的任务类型（前缀匹配）。
+// handler失败的任务按asynq的重试策略重试
+func NewSubscriber(r Reader, topics ...string) mq.Subscriber {
+	if len(topics) == 0 {
+		panic("topics should not be empty")
+	}
+	return &subscriber{r: r, topics: topics, closed: make(chan struct{})}
+}
+
+func (s *subscriber) Subscribe(ctx context.Context, h mq.Handler) error {
+	mux := asynq.NewServeMux()
+	for _, topic := range s.topics {
+		mux.HandleFunc(topic, Handle(h))
+	}
+
+	srv := s.r.GetReader()
+	if err := srv.Start(mux); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-s.closed:
+	}
+	srv.Shutdown()
+	return nil
+}
+
+// Handle 将mq.Handler转换成HandlerFunc，可以配合mq.Middleware使用，也可以用于reader.AddHook
+//
+//	r.AddHook("orders", asynq.Handle(mq.Chain(mq.Recovery(), mq.Logging())(handler)))
+func Handle(h mq.Handler) HandlerFunc {
+	return func(ctx context.Context, t *Message) error {
+		msg := decodeMessage(t)
+		ctx, span := trace.Start(mq.ExtractMetaInfo(ctx, msg), "asynq.receive",
+			trace.WithKind(trace.KindConsumer), trace.WithAttributes(
+				trace.String("messaging.system", "asynq"),
+				trace.String("messaging.destination", msg.Topic),
+			))
+		err := h(ctx, msg)
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+}
+
+// decodeMessage 解析任务，不是mq.Publisher写入的任务只有topic和body
+func decodeMessage(t *Message) *mq.Message {
+	msg := &mq.Message{Topic: t.Type()}
+	e, ok := decodeEnvelope(t)
+	if !ok {
+		msg.Body = t.Payload()
+		return msg
+	}
+	msg.Key = e.Key
+	msg.Headers = e.MetaInfo
+	msg.Body = e.payload()
+	if e.Time > 0 {
+		msg.Time = time.Unix(0, e.Time)
+	}
+	return msg
+}
+
+// Close 停止Subscribe
+func (s *subscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
@@ -0,0 +1,44 @@
+package asynq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+type retryWriter struct {
+	Writer
+	r *retry.Retrier
+}
+
+// WithRetry 返回入队失败时按r重试的Writer，任务重复（ErrDuplicateTask、ErrTaskIDConflict）不会重试
+func WithRetry(w Writer, r *retry.Retrier) Writer {
+	return &retryWriter{Writer: w, r: r}
+}
+
+func (w *retryWriter) Send(key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
+	return w.SendContext(context.Background(), key, val, opts...)
+}
+
+func (w *retryWriter) SendContext(ctx context.Context, key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
+	var lastErr error
+	info, _ := retry.DoValue(ctx, w.r, func(ctx context.Context) (*TaskInfo, error) {
+		info, err := w.Writer.SendContext(ctx, key, val, opts...)
+		lastErr = err
+		if errors.Is(err, asynq.ErrDuplicateTask) || errors.Is(err, asynq.ErrTaskIDConflict) {
+			err = retry.Unrecoverable(err)
+		}
+		return info, err
+	})
+	return info, lastErr
+}
+
+func (w *retryWriter) Push(val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
+	if topic := w.Topic(); topic != "" {
+		return w.Send(topic, val, opts...)
+	}
+	return w.Writer.Push(val, opts...)
+}
@@ -0,0 +1,98 @@
+package asynq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+// failWriter 依次返回errs中的错误，之后成功，记录最后一次的任务
+type failWriter struct {
+	Writer
+	topic string
+	errs  []error
+	calls int
+	key   string
+	val   interface{}
+}
+
+func (w *failWriter) Topic() string {
+	return w.topic
+}
+
+func (w *failWriter) SendContext(ctx context.Context, key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
+	w.calls++
+	w.key, w.val = key, val
+	if w.calls <= len(w.errs) {
+		return nil, w.errs[w.calls-1]
+	}
+	return &TaskInfo{Type: key}, nil
+}
+
+func TestWithRetry(t *testing.T) {
+	r := retry.New(retry.WithMaxAttempts(3), retry.WithBackoff(retry.Constant(time.Millisecond)))
+	errDown := errors.New("redis down")
+
+	fw := &failWriter{errs: []error{errDown, errDown}}
+	info, err := WithRetry(fw, r).Send("orders", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", info.Type)
+	assert.Equal(t, 3, fw.calls)
+
+	// 返回最后一次的错误
+	fw = &failWriter{errs: []error{errDown, errDown, errDown}}
+	_, err = WithRetry(fw, r).SendContext(context.Background(), "orders", 1)
+	assert.Equal(t, errDown, err)
+	assert.Equal(t, 3, fw.calls)
+
+	// 任务重复不重试
+	for _, dup := range []error{asynq.ErrDuplicateTask, asynq.ErrTaskIDConflict} {
+		fw = &failWriter{errs: []error{dup}}
+		_, err = WithRetry(fw, r).Send("orders", 1)
+		assert.Equal(t, dup, err)
+		assert.Equal(t, 1, fw.calls)
+	}
+
+	// Push使用Writer的topic
+	fw = &failWriter{topic: "orders", errs: []error{errDown}}
+	info, err = WithRetry(fw, r).Push(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", info.Type)
+	assert.Equal(t, 2, fw.calls)
+}
+
+func TestPublisherWithRetry(t *testing.T) {
+	r := retry.New(retry.WithMaxAttempts(3), retry.WithBackoff(retry.Constant(time.Millisecond)))
+	fw := &failWriter{topic: "orders", errs: []error{errors.New("redis down")}}
+	p := NewPublisher(WithRetry(fw, r))
+
+	// 没有topic的消息使用Writer的topic，经过Writer写入所以会重试
+	ctx := metainfo.WithPersistentValue(context.Background(), "k1", "v1")
+	err := p.Publish(ctx, &mq.Message{Key: []byte("k"), Body: []byte("raw"), Headers: map[string]string{"h": "v"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fw.calls)
+	assert.Equal(t, "orders", fw.key)
+
+	e, ok := fw.val.(*envelope)
+	assert.True(t, ok)
+	payload, err := e.marshal(ctx)
+	assert.NoError(t, err)
+	msg := decodeMessage(asynq.NewTask(fw.key, payload))
+	assert.Equal(t, "orders", msg.Topic)
+	assert.Equal(t, []byte("k"), msg.Key)
+	assert.Equal(t, []byte("raw"), msg.Body)
+	assert.Equal(t, "v", msg.Headers["h"])
+	assert.False(t, msg.Time.IsZero())
+	v, _ := metainfo.GetPersistentValue(mq.ExtractMetaInfo(context.Background(), msg), "k1")
+	assert.Equal(t, "v1", v)
+
+	assert.Error(t, NewPublisher(&failWriter{}).Publish(ctx, &mq.Message{Body: []byte("x")}))
+}
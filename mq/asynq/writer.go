@@ -1,11 +1,14 @@
 package asynq
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"sync"
 
 	"github.com/hibiken/asynq"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
 )
 
 var (
@@ -18,8 +21,11 @@ type TaskInfo = asynq.TaskInfo
 
 type Writer interface {
 	Send(key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error)
+	SendContext(ctx context.Context, key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error)
 	Push(val interface{}, opts ...asynq.Option) (*TaskInfo, error)
 	GetWriter() *asynq.Client
+	// Topic 返回Push使用的任务类型，没有时为空
+	Topic() string
 	Close() error
 }
 
@@ -63,6 +69,49 @@ func (w *writer) Send(key string, val interface{}, opts ...asynq.Option) (*TaskI
 	return w.client.Enqueue(task)
 }
 
+// SendContext 发送任务，ctx中的metainfo和trace context会随payload一起写入，消费者需要使用WithMetaInfo包装处理函数
+func (w *writer) SendContext(ctx context.Context, key string, val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
+	if w.client == nil {
+		return nil, errors.New("connection is closed")
+	}
+
+	// mq.Publisher写入的消息已经打包，只需要加上ctx中的metainfo
+	e, packed := val.(*envelope)
+	var payload []byte
+	if !packed {
+		var err error
+		if payload, err = json.Marshal(val); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, span := trace.Start(ctx, "asynq.send", trace.WithKind(trace.KindProducer), trace.WithAttributes(
+		trace.String("messaging.system", "asynq"),
+		trace.String("messaging.destination", key),
+	))
+	defer span.End()
+
+	var err error
+	if packed {
+		payload, err = e.marshal(ctx)
+	} else {
+		payload, err = wrapPayload(ctx, payload)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	task := asynq.NewTask(key, payload, opts...)
+
+	info, err := w.client.EnqueueContext(ctx, task)
+	span.RecordError(err)
+	return info, err
+}
+
+func (w *writer) Topic() string {
+	return w.topic
+}
+
 func (w *writer) Push(val interface{}, opts ...asynq.Option) (*TaskInfo, error) {
 	if w.topic == "" {
 		return nil, errors.New("topic is empty")
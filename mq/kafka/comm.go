@@ -1,9 +1,14 @@
 package kafka
 
 import (
+	"context"
+
 	kf "github.com/segmentio/kafka-go"
 )
 
 type Message = kf.Message
 type ReaderFunc func(partition int, offset int64, key []byte, val []byte) error
+
+// HandlerFunc 处理消息，ctx中带有生产者写入消息头的metainfo和消费span
+type HandlerFunc func(ctx context.Context, m Message) error
 type WriterFunc func(string, string) Writer
@@ -0,0 +1,328 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	kf "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"github.com/aaabigfish/gopkg/config"
+)
+
+// Config 配置文件中 [kafka_<name>] 段的配置，模版如下：
+//
+//	[kafka_order]
+//	Brokers = ["127.0.0.1:9092"]
+//	Topic = "order"
+//	GroupID = "order-service"
+//	ClientID = ""
+//	DialTimeout = "10s"
+//	# SASL认证：PLAIN、SCRAM-SHA-256、SCRAM-SHA-512
+//	SASLMechanism = "SCRAM-SHA-512"
+//	Username = ""
+//	Password = ""
+//	TLS = true
+//	TLSCAFile = ""
+//	TLSCertFile = ""
+//	TLSKeyFile = ""
+//	TLSInsecureSkipVerify = false
+//	# 消费者：first、last
+//	StartOffset = "first"
+//	MinBytes = 10000
+//	MaxBytes = 10000000
+//	CommitInterval = "0s"
+//	# 生产者：hash、round_robin、least_bytes、crc32、murmur2
+//	Balancer = "hash"
+//	# none、gzip、snappy、lz4、zstd
+//	Compression = "snappy"
+//	# all、one、none
+//	RequiredAcks = "all"
+//	Async = true
+//	BatchSize = 100
+//	BatchTimeout = "1s"
+//
+// 没有配置的项使用Option的默认值
+type Config struct {
+	Brokers     []string
+	Topic       string
+	GroupID     string
+	ClientID    string
+	DialTimeout time.Duration
+
+	SASLMechanism string
+	Username      string
+	Password      string
+
+	TLS                   bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+
+	StartOffset    string
+	MinBytes       int
+	MaxBytes       int
+	CommitInterval time.Duration
+
+	Balancer     string
+	Compression  string
+	RequiredAcks string
+	// Async 为空时使用默认值（异步）
+	Async        *bool
+	BatchSize    int
+	BatchTimeout time.Duration
+}
+
+// LoadConfig 读取默认配置文件中 [kafka_<name>] 段的配置
+func LoadConfig(name string) (*Config, error) {
+	if config.Get == nil {
+		return nil, errors.New("kafka: config file not found")
+	}
+
+	key := "kafka_" + name + "."
+	c := &Config{
+		Brokers:               config.GetStringSlice(key + "brokers"),
+		Topic:                 config.GetString(key + "topic"),
+		GroupID:               config.GetString(key + "groupid"),
+		ClientID:              config.GetString(key + "clientid"),
+		DialTimeout:           config.GetDuration(key + "dialtimeout"),
+		SASLMechanism:         config.GetString(key + "saslmechanism"),
+		Username:              config.GetString(key + "username"),
+		Password:              config.GetString(key + "password"),
+		TLS:                   config.GetBool(key + "tls"),
+		TLSCAFile:             config.GetString(key + "tlscafile"),
+		TLSCertFile:           config.GetString(key + "tlscertfile"),
+		TLSKeyFile:            config.GetString(key + "tlskeyfile"),
+		TLSInsecureSkipVerify: config.GetBool(key + "tlsinsecureskipverify"),
+		StartOffset:           config.GetString(key + "startoffset"),
+		MinBytes:              config.GetInt(key + "minbytes"),
+		MaxBytes:              config.GetInt(key + "maxbytes"),
+		CommitInterval:        config.GetDuration(key + "commitinterval"),
+		Balancer:              config.GetString(key + "balancer"),
+		Compression:           config.GetString(key + "compression"),
+		RequiredAcks:          config.GetString(key + "requiredacks"),
+		BatchSize:             config.GetInt(key + "batchsize"),
+		BatchTimeout:          config.GetDuration(key + "batchtimeout"),
+	}
+	if config.GetString(key+"async") != "" {
+		async := config.GetBool(key + "async")
+		c.Async = &async
+	}
+	if len(c.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka: %sbrokers is empty", key)
+	}
+	return c, nil
+}
+
+// Options 将配置转换成Option
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+	if c.ClientID != "" {
+		opts = append(opts, WithClientID(c.ClientID))
+	}
+	if c.DialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(c.DialTimeout))
+	}
+
+	switch strings.ToUpper(c.SASLMechanism) {
+	case "":
+	case "PLAIN":
+		opts = append(opts, WithSASLPlain(c.Username, c.Password))
+	case "SCRAM-SHA-256", "SCRAM-SHA-512":
+		algo := scram.SHA256
+		if strings.HasSuffix(strings.ToUpper(c.SASLMechanism), "512") {
+			algo = scram.SHA512
+		}
+		opts = append(opts, WithSASLScram(algo, c.Username, c.Password))
+	default:
+		return nil, fmt.Errorf("kafka: unknown sasl mechanism %q", c.SASLMechanism)
+	}
+
+	if c.TLS {
+		t, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLS(t))
+	}
+
+	switch strings.ToLower(c.StartOffset) {
+	case "":
+	case "first":
+		opts = append(opts, WithStartOffset(kf.FirstOffset))
+	case "last":
+		opts = append(opts, WithStartOffset(kf.LastOffset))
+	default:
+		return nil, fmt.Errorf("kafka: unknown start offset %q", c.StartOffset)
+	}
+	if c.MinBytes > 0 || c.MaxBytes > 0 {
+		o := newOptions(nil)
+		min, max := o.minBytes, o.maxBytes
+		if c.MinBytes > 0 {
+			min = c.MinBytes
+		}
+		if c.MaxBytes > 0 {
+			max = c.MaxBytes
+		}
+		opts = append(opts, WithFetchBytes(min, max))
+	}
+	if c.CommitInterval > 0 {
+		opts = append(opts, WithCommitInterval(c.CommitInterval))
+	}
+
+	if c.Balancer != "" {
+		b, err := parseBalancer(c.Balancer)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithBalancer(b))
+	}
+	if c.Compression != "" {
+		comp, err := parseCompression(c.Compression)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithCompression(comp))
+	}
+	if c.RequiredAcks != "" {
+		acks, err := parseRequiredAcks(c.RequiredAcks)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithRequiredAcks(acks))
+	}
+	if c.Async != nil {
+		opts = append(opts, WithAsync(*c.Async))
+	}
+	if c.BatchSize > 0 || c.BatchTimeout > 0 {
+		opts = append(opts, WithBatch(c.BatchSize, c.BatchTimeout))
+	}
+	return opts, nil
+}
+
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	t := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if c.TLSCAFile != "" {
+		ca, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		t.RootCAs = x509.NewCertPool()
+		if !t.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("kafka: no certificate found in %s", c.TLSCAFile)
+		}
+	}
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
+
+func parseBalancer(s string) (kf.Balancer, error) {
+	switch strings.ToLower(s) {
+	case "hash":
+		return &kf.Hash{}, nil
+	case "round_robin", "roundrobin":
+		return &kf.RoundRobin{}, nil
+	case "least_bytes", "leastbytes":
+		return &kf.LeastBytes{}, nil
+	case "crc32":
+		return &kf.CRC32Balancer{}, nil
+	case "murmur2":
+		return &kf.Murmur2Balancer{}, nil
+	}
+	return nil, fmt.Errorf("kafka: unknown balancer %q", s)
+}
+
+func parseCompression(s string) (kf.Compression, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return 0, nil
+	case "gzip":
+		return kf.Gzip, nil
+	case "snappy":
+		return kf.Snappy, nil
+	case "lz4":
+		return kf.Lz4, nil
+	case "zstd":
+		return kf.Zstd, nil
+	}
+	return 0, fmt.Errorf("kafka: unknown compression %q", s)
+}
+
+func parseRequiredAcks(s string) (kf.RequiredAcks, error) {
+	switch strings.ToLower(s) {
+	case "all":
+		return kf.RequireAll, nil
+	case "one":
+		return kf.RequireOne, nil
+	case "none":
+		return kf.RequireNone, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= -1 && n <= 1 {
+		return kf.RequiredAcks(n), nil
+	}
+	return 0, fmt.Errorf("kafka: unknown required acks %q", s)
+}
+
+// NewReaderFromConfig 按 [kafka_<name>] 的配置创建消费者，opts会覆盖配置，配置错误时panic
+func NewReaderFromConfig(name string, opts ...Option) Reader {
+	r, err := OpenReaderFromConfig(name, opts...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// NewWriterFromConfig 按 [kafka_<name>] 的配置创建生产者，opts会覆盖配置，配置错误时panic
+func NewWriterFromConfig(name string, opts ...Option) Writer {
+	w, err := OpenWriterFromConfig(name, opts...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return w
+}
+
+// OpenReaderFromConfig 按 [kafka_<name>] 的配置创建消费者，opts会覆盖配置，配置错误时返回错误
+func OpenReaderFromConfig(name string, opts ...Option) (Reader, error) {
+	c, o, err := load(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return OpenReader(c.Brokers, c.Topic, c.GroupID, o...)
+}
+
+// OpenWriterFromConfig 按 [kafka_<name>] 的配置创建生产者，opts会覆盖配置，配置错误时返回错误
+func OpenWriterFromConfig(name string, opts ...Option) (Writer, error) {
+	c, o, err := load(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWriter(c.Brokers, c.Topic, o...)
+}
+
+func load(name string, opts []Option) (*Config, []Option, error) {
+	c, err := LoadConfig(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	o, err := c.Options()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, append(o, opts...), nil
+}
@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	kf "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigOptions(t *testing.T) {
+	async := false
+	c := &Config{
+		Brokers:               []string{"127.0.0.1:9092"},
+		Topic:                 "orders",
+		ClientID:              "svc",
+		DialTimeout:           3 * time.Second,
+		SASLMechanism:         "scram-sha-512",
+		Username:              "u",
+		Password:              "p",
+		TLS:                   true,
+		TLSInsecureSkipVerify: true,
+		StartOffset:           "last",
+		MaxBytes:              1 << 20,
+		Balancer:              "round_robin",
+		Compression:           "zstd",
+		RequiredAcks:          "one",
+		Async:                 &async,
+		BatchSize:             10,
+		BatchTimeout:          50 * time.Millisecond,
+	}
+	opts, err := c.Options()
+	assert.NoError(t, err)
+
+	o := newOptions(opts)
+	assert.NoError(t, o.err)
+	assert.Equal(t, "svc", o.clientID)
+	assert.Equal(t, 3*time.Second, o.dialTimeout)
+	assert.Equal(t, "SCRAM-SHA-512", o.sasl.Name())
+	assert.True(t, o.tls.InsecureSkipVerify)
+	assert.Equal(t, kf.LastOffset, o.startOffset)
+	assert.Equal(t, 10e3, float64(o.minBytes))
+	assert.Equal(t, 1<<20, o.maxBytes)
+	assert.IsType(t, &kf.RoundRobin{}, o.balancer)
+	assert.Equal(t, kf.Zstd, o.compression)
+	assert.Equal(t, kf.RequireOne, o.requiredAcks)
+	assert.False(t, o.async)
+	assert.Equal(t, 10, o.batchSize)
+
+	for _, bad := range []*Config{
+		{SASLMechanism: "GSSAPI"},
+		{StartOffset: "middle"},
+		{Balancer: "random"},
+		{Compression: "brotli"},
+		{RequiredAcks: "2"},
+		{TLS: true, TLSCAFile: "/nonexistent"},
+	} {
+		_, err := bad.Options()
+		assert.Error(t, err)
+	}
+
+	acks, err := parseRequiredAcks("-1")
+	assert.NoError(t, err)
+	assert.Equal(t, kf.RequireAll, acks)
+}
+
+func TestNewWriterWithOptions(t *testing.T) {
+	var called bool
+	tc := &tls.Config{}
+	w := NewWriterWithOptions([]string{"127.0.0.1:9092"}, "orders",
+		WithSASLPlain("u", "p"),
+		WithTLS(tc),
+		WithBalancer(&kf.LeastBytes{}),
+		WithCompression(0),
+		WithRequiredAcks(kf.RequireNone),
+		WithCompletion(func(messages []Message, err error) { called = true }),
+	)
+	defer w.Close()
+
+	kw := w.GetWriter()
+	assert.Equal(t, "orders", kw.Topic)
+	assert.True(t, kw.Async)
+	assert.IsType(t, &kf.LeastBytes{}, kw.Balancer)
+	assert.Equal(t, kf.Compression(0), kw.Compression)
+	assert.Equal(t, kf.RequireNone, kw.RequiredAcks)
+	assert.NotNil(t, kw.Completion)
+	kw.Completion(nil, nil)
+	assert.True(t, called)
+
+	tr := kw.Transport.(*kf.Transport)
+	assert.Equal(t, "PLAIN", tr.SASL.Name())
+	assert.Equal(t, tc, tr.TLS)
+
+	// 默认配置和原来一致
+	kw = NewWriter([]string{"127.0.0.1:9092"}).GetWriter()
+	assert.Equal(t, "", kw.Topic)
+	assert.True(t, kw.Async)
+	assert.IsType(t, &kf.Hash{}, kw.Balancer)
+	assert.Equal(t, kf.Snappy, kw.Compression)
+	assert.Equal(t, kf.RequireAll, kw.RequiredAcks)
+	assert.Equal(t, 10*time.Second, kw.WriteTimeout)
+}
+
+func TestNewReaderOptions(t *testing.T) {
+	r := NewReader([]string{"127.0.0.1:9092"}, "orders", "g",
+		WithStartOffset(kf.LastOffset), WithFetchBytes(1, 2), WithCommitInterval(time.Second), WithSASLPlain("u", "p"))
+	defer r.Close()
+
+	c := r.GetReader().Config()
+	assert.Equal(t, kf.LastOffset, c.StartOffset)
+	assert.Equal(t, 1, c.MinBytes)
+	assert.Equal(t, 2, c.MaxBytes)
+	assert.Equal(t, time.Second, c.CommitInterval)
+	assert.Equal(t, "PLAIN", c.Dialer.SASLMechanism.Name())
+}
+
+func TestOpen(t *testing.T) {
+	bad := func(o *options) { o.err = errors.New("bad option") }
+
+	// Open返回错误，New panic
+	_, err := OpenWriter([]string{"127.0.0.1:9092"}, "orders", bad)
+	assert.EqualError(t, err, "bad option")
+	assert.Panics(t, func() { NewWriterWithOptions([]string{"127.0.0.1:9092"}, "orders", bad) })
+	_, err = OpenReader([]string{"127.0.0.1:9092"}, "orders", "g", bad)
+	assert.EqualError(t, err, "bad option")
+	assert.Panics(t, func() { NewReader([]string{"127.0.0.1:9092"}, "orders", "g", bad) })
+
+	w, err := OpenWriter([]string{"127.0.0.1:9092"}, "orders")
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", w.GetWriter().Topic)
+	w.Close()
+	r, err := OpenReader([]string{"127.0.0.1:9092"}, "orders", "g")
+	assert.NoError(t, err)
+	assert.Equal(t, "g", r.GetReader().Config().GroupID)
+	r.Close()
+
+	_, err = OpenReaderFromConfig("missing")
+	assert.Error(t, err)
+	_, err = OpenWriterFromConfig("missing")
+	assert.Error(t, err)
+	assert.Panics(t, func() { NewWriterFromConfig("missing") })
+}
@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"context"
+
+	kf "github.com/segmentio/kafka-go"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+// metaInfoHeaders 将ctx中的metainfo（transient和persistent）和trace context转换成消息头
+func metaInfoHeaders(ctx context.Context) map[string]string {
+	m := make(map[string]string)
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	return m
+}
+
+func injectHeaders(m map[string]string, msg *Message) {
+	if len(m) == 0 {
+		return
+	}
+
+	headers := make([]kf.Header, 0, len(msg.Headers)+len(m))
+	for _, h := range msg.Headers {
+		if _, ok := m[h.Key]; !ok {
+			headers = append(headers, h)
+		}
+	}
+	for k, v := range m {
+		headers = append(headers, kf.Header{Key: k, Value: []byte(v)})
+	}
+	msg.Headers = headers
+}
+
+// InjectMetaInfo 将ctx中的metainfo（transient和persistent）和trace context写入消息头
+func InjectMetaInfo(ctx context.Context, msg *Message) {
+	injectHeaders(metaInfoHeaders(ctx), msg)
+}
+
+// ExtractMetaInfo 从消息头恢复metainfo和trace context到ctx，消费者作为下游调用TransferForward
+func ExtractMetaInfo(ctx context.Context, msg Message) context.Context {
+	if len(msg.Headers) == 0 {
+		return ctx
+	}
+
+	m := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		m[h.Key] = string(h.Value)
+	}
+	ctx = metainfo.SetMetaInfoFromMap(ctx, m)
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.MapHeader(m))
+	return metainfo.TransferForward(ctx)
+}
@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kf "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+func newProducerContext() context.Context {
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+	ctx = metainfo.WithValue(ctx, "tk", "tv")
+	ctx, _ = metainfo.StartSpan(ctx)
+	return ctx
+}
+
+func TestMetaInfoPropagation(t *testing.T) {
+	ctx := newProducerContext()
+	m := Message{Topic: "orders", Partition: 1, Offset: 7, Value: []byte("v"), Headers: []kf.Header{{Key: "x", Value: []byte("y")}}}
+	InjectMetaInfo(ctx, &m)
+
+	r := newFakeReader(newFakeBroker(1, 0))
+	var calls []string
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		calls = append(calls, "hook")
+		assert.Equal(t, 1, partition)
+		assert.Equal(t, int64(7), offset)
+		return nil
+	})
+	r.AddHandler(func(hctx context.Context, got Message) error {
+		calls = append(calls, "handler")
+		assert.Equal(t, m, got)
+
+		v, ok := metainfo.GetPersistentValue(hctx, "trace_id")
+		assert.True(t, ok && v == "t1", v)
+		// 消费者是下游，transient值可以读取
+		v, ok = metainfo.GetValue(hctx, "tk")
+		assert.True(t, ok && v == "tv", v)
+		assert.Equal(t, metainfo.TraceID(ctx), metainfo.TraceID(hctx))
+		return nil
+	})
+	assert.NoError(t, r.Do(m))
+	assert.Equal(t, []string{"hook", "handler"}, calls)
+}
+
+func TestInjectMetaInfoKeepsHeaders(t *testing.T) {
+	ctx := newProducerContext()
+	m := Message{Headers: []kf.Header{{Key: "x", Value: []byte("y")}}}
+	InjectMetaInfo(ctx, &m)
+	// 重复写入时覆盖而不是追加
+	InjectMetaInfo(ctx, &m)
+
+	keys := make(map[string]int)
+	for _, h := range m.Headers {
+		keys[h.Key]++
+	}
+	assert.Equal(t, 1, keys["x"])
+	for k, n := range keys {
+		assert.Equal(t, 1, n, k)
+	}
+
+	v, ok := metainfo.GetPersistentValue(ExtractMetaInfo(context.Background(), m), "trace_id")
+	assert.True(t, ok && v == "t1", v)
+	assert.Equal(t, ctx, ExtractMetaInfo(ctx, Message{}))
+}
+
+func TestConsumerSpan(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	pctx, producer := trace.Start(context.Background(), "kafka.send", trace.WithKind(trace.KindProducer))
+	m := Message{Topic: "orders", Partition: 2, Offset: 9}
+	InjectMetaInfo(pctx, &m)
+	producer.End()
+
+	r := newFakeReader(newFakeBroker(1, 0))
+	var spanID string
+	r.AddHandler(func(ctx context.Context, m Message) error {
+		spanID = metainfo.SpanID(ctx)
+		return errors.New("boom")
+	})
+	assert.Error(t, r.Do(m))
+
+	spans := me.Spans()
+	assert.Len(t, spans, 2)
+	s := spans[1]
+	assert.Equal(t, "kafka.receive", s.Name)
+	assert.Equal(t, trace.KindConsumer, s.Kind)
+	assert.Equal(t, producer.SpanContext().TraceID, s.SpanContext.TraceID)
+	assert.Equal(t, producer.SpanContext().SpanID, s.ParentSpanID)
+	assert.Equal(t, spanID, s.SpanContext.SpanID.String())
+	assert.Equal(t, trace.StatusError, s.Status.Code)
+	assert.Contains(t, s.Attributes, trace.String("messaging.destination", "orders"))
+	assert.Contains(t, s.Attributes, trace.Int64("messaging.kafka.offset", 9))
+}
+
+func TestHandle(t *testing.T) {
+	ctx := newProducerContext()
+	now := time.Now()
+	m := Message{Topic: "orders", Key: []byte("k"), Value: []byte("v"), Time: now, Headers: []kf.Header{{Key: "x", Value: []byte("y")}}}
+	InjectMetaInfo(ctx, &m)
+
+	// mq.Handler收到完整的消息和恢复了metainfo的ctx
+	r := newFakeReader(newFakeBroker(1, 0))
+	var got *mq.Message
+	r.AddHandler(Handle(func(hctx context.Context, msg *mq.Message) error {
+		got = msg
+		v, _ := metainfo.GetPersistentValue(hctx, "trace_id")
+		assert.Equal(t, "t1", v)
+		assert.Equal(t, metainfo.TraceID(ctx), metainfo.TraceID(hctx))
+		return nil
+	}))
+	assert.NoError(t, r.Do(m))
+	assert.Equal(t, "orders", got.Topic)
+	assert.Equal(t, []byte("k"), got.Key)
+	assert.Equal(t, []byte("v"), got.Body)
+	assert.Equal(t, now, got.Time)
+	assert.Equal(t, "y", got.Headers["x"])
+}
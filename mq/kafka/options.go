@@ -0,0 +1,195 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/rs/xid"
+	kf "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+type options struct {
+	err error
+
+	// 连接
+	clientID    string
+	dialTimeout time.Duration
+	sasl        sasl.Mechanism
+	tls         *tls.Config
+
+	// 消费者
+	startOffset    int64
+	minBytes       int
+	maxBytes       int
+	commitInterval time.Duration
+
+	// 生产者
+	balancer     kf.Balancer
+	compression  kf.Compression
+	requiredAcks kf.RequiredAcks
+	async        bool
+	completion   func(messages []Message, err error)
+	batchSize    int
+	batchTimeout time.Duration
+	timeout      time.Duration
+}
+
+// Option NewReader和NewWriterWithOptions的配置，对消费者或生产者无效的选项会被忽略
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		clientID:     xid.New().String(),
+		dialTimeout:  10 * time.Second,
+		startOffset:  kf.FirstOffset,
+		minBytes:     10e3, // 10KB
+		maxBytes:     10e6, // 10MB
+		balancer:     &kf.Hash{},
+		compression:  kf.Snappy,
+		requiredAcks: kf.RequireAll,
+		async:        true,
+		timeout:      10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) dialer() *kf.Dialer {
+	return &kf.Dialer{
+		ClientID:      o.clientID,
+		Timeout:       o.dialTimeout,
+		DualStack:     true,
+		SASLMechanism: o.sasl,
+		TLS:           o.tls,
+	}
+}
+
+func (o *options) transport() *kf.Transport {
+	return &kf.Transport{
+		ClientID:    o.clientID,
+		DialTimeout: o.dialTimeout,
+		SASL:        o.sasl,
+		TLS:         o.tls,
+	}
+}
+
+// WithClientID 客户端id，默认随机生成
+func WithClientID(id string) Option {
+	return func(o *options) {
+		o.clientID = id
+	}
+}
+
+// WithDialTimeout 连接超时，默认10s
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithSASL 使用SASL认证
+func WithSASL(m sasl.Mechanism) Option {
+	return func(o *options) {
+		o.sasl = m
+	}
+}
+
+// WithSASLPlain 使用SASL/PLAIN认证，一般需要同时开启TLS
+func WithSASLPlain(username, password string) Option {
+	return WithSASL(plain.Mechanism{Username: username, Password: password})
+}
+
+// WithSASLScram 使用SASL/SCRAM认证，algo为 scram.SHA256 或 scram.SHA512
+func WithSASLScram(algo scram.Algorithm, username, password string) Option {
+	return func(o *options) {
+		m, err := scram.Mechanism(algo, username, password)
+		if err != nil {
+			o.err = err
+			return
+		}
+		o.sasl = m
+	}
+}
+
+// WithTLS 使用TLS连接
+func WithTLS(c *tls.Config) Option {
+	return func(o *options) {
+		o.tls = c
+	}
+}
+
+// WithStartOffset 消费者组没有提交过offset时开始消费的位置，kafka.FirstOffset（默认）或 kafka.LastOffset
+func WithStartOffset(offset int64) Option {
+	return func(o *options) {
+		o.startOffset = offset
+	}
+}
+
+// WithFetchBytes 消费者每次拉取的最小和最大字节数，默认10KB和10MB
+func WithFetchBytes(min, max int) Option {
+	return func(o *options) {
+		o.minBytes, o.maxBytes = min, max
+	}
+}
+
+// WithCommitInterval 消费者定时批量提交offset的间隔，默认0同步提交
+func WithCommitInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.commitInterval = d
+	}
+}
+
+// WithBalancer 生产者选择partition的方式，默认按key哈希（kafka.Hash）
+func WithBalancer(b kf.Balancer) Option {
+	return func(o *options) {
+		o.balancer = b
+	}
+}
+
+// WithCompression 生产者的压缩方式，默认snappy，0不压缩
+func WithCompression(c kf.Compression) Option {
+	return func(o *options) {
+		o.compression = c
+	}
+}
+
+// WithRequiredAcks 生产者需要的确认数，默认 kafka.RequireAll
+func WithRequiredAcks(acks kf.RequiredAcks) Option {
+	return func(o *options) {
+		o.requiredAcks = acks
+	}
+}
+
+// WithAsync 生产者异步写入，默认开启。异步写入时WriteMessages不会返回写入错误，
+// 需要结果时使用WithCompletion
+func WithAsync(async bool) Option {
+	return func(o *options) {
+		o.async = async
+	}
+}
+
+// WithCompletion 每批消息写入完成后调用，err为写入的错误
+func WithCompletion(fn func(messages []Message, err error)) Option {
+	return func(o *options) {
+		o.completion = fn
+	}
+}
+
+// WithBatch 生产者每批最多的消息数和等待时间，默认100条和1s
+func WithBatch(size int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.batchSize, o.batchTimeout = size, timeout
+	}
+}
+
+// WithTimeout 生产者读写超时，默认10s
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
@@ -0,0 +1,126 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	kf "github.com/segmentio/kafka-go"
+
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+type publisher struct {
+	w Writer
+}
+
+// NewPublisher 将Writer适配为mq.Publisher
+func NewPublisher(w Writer) mq.Publisher {
+	return &publisher{w: w}
+}
+
+func (p *publisher) Publish(ctx context.Context, msgs ...*mq.Message) error {
+	// 指定了topic的writer不能再设置消息的topic
+	withTopic := p.w.GetWriter().Topic != ""
+	ms := make([]Message, len(msgs))
+	for i, m := range msgs {
+		ms[i] = Message{Key: m.Key, Value: m.Body, Time: m.Time}
+		if !withTopic {
+			ms[i].Topic = m.Topic
+		}
+		for k, v := range m.Headers {
+			ms[i].Headers = append(ms[i].Headers, kf.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return p.w.WriteMessages(ctx, ms)
+}
+
+func (p *publisher) Close() error {
+	return p.w.Close()
+}
+
+type subscriber struct {
+	r   Reader
+	cfg RunConfig
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed chan struct{}
+}
+
+// NewSubscriber 将Reader适配为mq.Subscriber，Reader需要指定groupId。
+// 使用Reader.Run消费，c是Run的配置（不使用BatchFunc，BatchSize默认1即逐条处理和提交）：
+// handler失败时按ErrorBackoff重试同一条消息，设置MaxAttempts后重试用完的消息交给OnDiscard后提交
+func NewSubscriber(r Reader, c ...RunConfig) mq.Subscriber {
+	s := &subscriber{r: r, closed: make(chan struct{})}
+	if len(c) > 0 {
+		s.cfg = c[0]
+	}
+	s.cfg.BatchFunc = nil
+	if s.cfg.BatchSize <= 0 {
+		s.cfg.BatchSize = 1
+	}
+	return s
+}
+
+// Subscribe 直到ctx结束或Close，处理完已读取的消息后返回
+func (s *subscriber) Subscribe(ctx context.Context, h mq.Handler) error {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return nil
+	default:
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cfg := s.cfg
+	cfg.handler = Handle(h)
+	return s.r.Run(ctx, cfg)
+}
+
+// toMessage 转换成mq.Message
+func toMessage(m Message) *mq.Message {
+	msg := &mq.Message{Topic: m.Topic, Key: m.Key, Body: m.Value, Time: m.Time}
+	if len(m.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(m.Headers))
+		for _, hd := range m.Headers {
+			msg.Headers[hd.Key] = string(hd.Value)
+		}
+	}
+	return msg
+}
+
+// Close 停止Subscribe，等待已读取的消息处理完后关闭Reader
+func (s *subscriber) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return s.r.Close()
+}
+
+// Handle 将mq.Handler转换成HandlerFunc，可以配合mq.Middleware使用。
+// 消息带有topic、消息头和时间，ctx中有Reader恢复的metainfo和trace context
+//
+//	r.AddHandler(kafka.Handle(mq.Chain(mq.Recovery(), mq.Logging())(handler)))
+func Handle(h mq.Handler) HandlerFunc {
+	return func(ctx context.Context, m Message) error {
+		return h(ctx, toMessage(m))
+	}
+}
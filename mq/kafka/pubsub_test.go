@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+// closeReader 关闭时不需要kafka连接
+type closeReader struct {
+	*reader
+	closed bool
+}
+
+func (r *closeReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestSubscriber(t *testing.T) {
+	b := newFakeBroker(2, 10)
+	r := &closeReader{reader: newFakeReader(b)}
+
+	var mu sync.Mutex
+	got := make(map[string]int)
+	var discarded []int64
+	sub := NewSubscriber(r, RunConfig{
+		Concurrency:  2,
+		ErrorBackoff: retry.Constant(time.Millisecond),
+		MaxAttempts:  2,
+		OnDiscard: func(ctx context.Context, msgs []Message, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			discarded = append(discarded, msgs[0].Offset)
+			return nil
+		},
+		// Subscriber逐条处理
+		BatchFunc: func(ctx context.Context, msgs []Message) error { return errors.New("not used") },
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- sub.Subscribe(context.Background(), func(ctx context.Context, msg *mq.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[string(msg.Body)]++
+			if msg.Body[0] == 1 && msg.Body[1] == 3 {
+				return errors.New("bad message")
+			}
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool { return b.offset(0) == 9 && b.offset(1) == 9 }, time.Second, time.Millisecond)
+	assert.NoError(t, sub.Close())
+	assert.NoError(t, <-done)
+	assert.True(t, r.closed)
+
+	assert.Len(t, got, 20)
+	assert.Equal(t, 2, got[string([]byte{1, 3})])
+	assert.Equal(t, []int64{3}, discarded)
+
+	// Close之后Subscribe直接返回
+	assert.NoError(t, sub.Subscribe(context.Background(), func(ctx context.Context, msg *mq.Message) error { return nil }))
+}
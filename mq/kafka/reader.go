@@ -2,9 +2,11 @@ package kafka
 
 import (
 	"context"
-	"time"
+	"fmt"
 
 	kf "github.com/segmentio/kafka-go"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
 )
 
 // 注意消费者的kafka版本必须0.10以上的版本
@@ -14,36 +16,58 @@ type Reader interface {
 	CommitMessages(ctx context.Context, msgs ...Message) error
 	GetReader() *kf.Reader
 	AddHook(...ReaderFunc)
+	// AddHandler 添加可以获取ctx的处理函数，和hook按添加的顺序执行
+	AddHandler(...HandlerFunc)
 	Do(m Message) error
+	// Run 循环读取消息并执行hook，成功后提交offset，直到ctx结束，详见RunConfig
+	Run(ctx context.Context, c ...RunConfig) error
 	Close() error
 }
 
+// broker 读取和提交消息，测试时替换成内存实现
+type broker interface {
+	FetchMessage(ctx context.Context) (Message, error)
+	CommitMessages(ctx context.Context, msgs ...Message) error
+}
+
 type reader struct {
 	kfReader *kf.Reader
-	hooks    []ReaderFunc
+	broker   broker
+	hooks    []HandlerFunc
+}
+
+// NewReader 创建消费者，opts可以配置认证、TLS、开始消费的位置等，见Option，opts错误时panic
+func NewReader(brokers []string, topic string, groupId string, opts ...Option) Reader {
+	r, err := OpenReader(brokers, topic, groupId, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("new kafka reader failed err(%v)", err))
+	}
+	return r
 }
 
-func NewReader(brokers []string, topic string, groupId string) Reader {
-	dialer := &kf.Dialer{
-		Timeout:   10 * time.Second,
-		DualStack: true,
+// OpenReader 创建消费者，opts错误时返回错误，其他同NewReader
+func OpenReader(brokers []string, topic string, groupId string, opts ...Option) (Reader, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
 	}
 
-	// make a new reader that consumes from topic-A
 	r := kf.NewReader(kf.ReaderConfig{
-		Brokers:  brokers,
-		GroupID:  groupId,
-		Dialer:   dialer,
-		Topic:    topic,
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
-		// CommitInterval: 10 * time.Second, // flushes commits to Kafka every second
+		Brokers:        brokers,
+		GroupID:        groupId,
+		Dialer:         o.dialer(),
+		Topic:          topic,
+		MinBytes:       o.minBytes,
+		MaxBytes:       o.maxBytes,
+		StartOffset:    o.startOffset,
+		CommitInterval: o.commitInterval,
 	})
 
 	return &reader{
 		kfReader: r,
-		hooks:    make([]ReaderFunc, 0),
-	}
+		broker:   r,
+		hooks:    make([]HandlerFunc, 0),
+	}, nil
 }
 
 func (r *reader) GetReader() *kf.Reader {
@@ -55,20 +79,44 @@ func (r *reader) ReadMessage(ctx context.Context) (Message, error) {
 }
 
 func (r *reader) FetchMessage(ctx context.Context) (Message, error) {
-	return r.kfReader.FetchMessage(ctx)
+	return r.broker.FetchMessage(ctx)
 }
 
 func (r *reader) CommitMessages(ctx context.Context, msgs ...Message) error {
-	return r.kfReader.CommitMessages(ctx, msgs...)
+	return r.broker.CommitMessages(ctx, msgs...)
 }
 
 func (r *reader) AddHook(hook ...ReaderFunc) {
-	r.hooks = append(r.hooks, hook...)
+	for _, h := range hook {
+		h := h
+		r.hooks = append(r.hooks, func(_ context.Context, m Message) error {
+			return h(m.Partition, m.Offset, m.Key, m.Value)
+		})
+	}
+}
+
+func (r *reader) AddHandler(h ...HandlerFunc) {
+	r.hooks = append(r.hooks, h...)
 }
 
+// Do 依次执行所有hook，消息头中的metainfo会恢复到处理函数的ctx，trace context作为消费span的父span
 func (r *reader) Do(m Message) error {
-	for _, hook := range r.hooks {
-		if err := hook(m.Partition, m.Offset, m.Key, m.Value); err != nil {
+	return r.do(context.Background(), m, r.hooks)
+}
+
+func (r *reader) do(ctx context.Context, m Message, hooks []HandlerFunc) error {
+	ctx, span := trace.Start(ExtractMetaInfo(ctx, m), "kafka.receive",
+		trace.WithKind(trace.KindConsumer), trace.WithAttributes(
+			trace.String("messaging.system", "kafka"),
+			trace.String("messaging.destination", m.Topic),
+			trace.Int("messaging.kafka.partition", m.Partition),
+			trace.Int64("messaging.kafka.offset", m.Offset),
+		))
+	defer span.End()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, m); err != nil {
+			span.RecordError(err)
 			return err
 		}
 	}
@@ -0,0 +1,28 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+type retryWriter struct {
+	Writer
+	r *retry.Retrier
+}
+
+// WithRetry 返回写入失败时按r重试的Writer。
+// NewWriter 默认异步写入，错误不会返回给调用方，需要重试时应使用 WithAsync(false) 创建
+func WithRetry(w Writer, r *retry.Retrier) Writer {
+	return &retryWriter{Writer: w, r: r}
+}
+
+func (w *retryWriter) WriteMessage(ctx context.Context, msg Message) error {
+	return w.WriteMessages(ctx, []Message{msg})
+}
+
+func (w *retryWriter) WriteMessages(ctx context.Context, msgs []Message) error {
+	return w.r.Do(ctx, func(ctx context.Context) error {
+		return w.Writer.WriteMessages(ctx, msgs)
+	})
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+// failWriter 前fails次写入失败
+type failWriter struct {
+	Writer
+	fails int
+	calls int
+	got   []Message
+}
+
+func (w *failWriter) WriteMessages(ctx context.Context, msgs []Message) error {
+	w.calls++
+	if w.calls <= w.fails {
+		return errors.New("leader not available")
+	}
+	w.got = append(w.got, msgs...)
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	r := retry.New(retry.WithMaxAttempts(3), retry.WithBackoff(retry.Constant(time.Millisecond)))
+
+	fw := &failWriter{fails: 2}
+	w := WithRetry(fw, r)
+	assert.NoError(t, w.WriteMessage(context.Background(), Message{Value: []byte("a")}))
+	assert.Equal(t, 3, fw.calls)
+	assert.Len(t, fw.got, 1)
+
+	fw = &failWriter{fails: 3}
+	assert.Error(t, WithRetry(fw, r).WriteMessages(context.Background(), []Message{{}}))
+	assert.Equal(t, 3, fw.calls)
+}
@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultBatchTimeout = time.Second
+	defaultConcurrency  = 1
+	defaultErrorBackoff = 100 * time.Millisecond
+	defaultMaxBackoff   = 30 * time.Second
+	commitTimeout       = 10 * time.Second
+)
+
+// BatchFunc 批量处理消息，返回错误时整批重试
+type BatchFunc func(ctx context.Context, msgs []Message) error
+
+// RunConfig Run的配置，零值使用默认值
+type RunConfig struct {
+	// BatchSize 每批最多的消息数，默认100
+	BatchSize int
+	// BatchTimeout 一批的第一条消息最多等待BatchTimeout就处理，默认1s
+	BatchTimeout time.Duration
+	// Concurrency 并发处理的数量，partition按 partition%Concurrency 分配，同一个partition按顺序处理，默认1
+	Concurrency int
+	// BatchFunc 批量处理消息，设置后不再执行hook
+	BatchFunc BatchFunc
+	// ErrorBackoff 处理失败后重试的间隔，默认 retry.Exponential(100ms, 30s)
+	ErrorBackoff retry.Backoff
+	// OnError 处理失败时调用，msgs是失败的消息和之后未处理的消息
+	OnError func(msgs []Message, err error)
+	// MaxAttempts 每条消息（设置BatchFunc时为整批）最多处理的次数，用完后交给OnDiscard并提交，
+	// 默认0一直重试
+	MaxAttempts int
+	// OnDiscard 消息处理MaxAttempts次仍失败时调用，可以写入死信topic，返回错误时继续重试。
+	// 没有设置时只记录日志
+	OnDiscard func(ctx context.Context, msgs []Message, err error) error
+
+	// handler 由Subscriber设置，代替hook处理消息
+	handler HandlerFunc
+}
+
+func (c RunConfig) withDefaults() RunConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.BatchTimeout <= 0 {
+		c.BatchTimeout = defaultBatchTimeout
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.ErrorBackoff == nil {
+		c.ErrorBackoff = retry.Exponential(defaultErrorBackoff, defaultMaxBackoff)
+	}
+	return c
+}
+
+// Run 读取消息按partition分配给Concurrency个worker，凑够BatchSize或等待BatchTimeout后处理一批：
+// 依次执行hook（或BatchFunc），成功的消息提交offset，保证至少一次。
+//
+// 处理失败时worker按ErrorBackoff重试失败的消息，期间不处理之后的消息，
+// worker的缓冲满了以后读取也会暂停，直到下游恢复。设置MaxAttempts后，
+// 重试用完的消息交给OnDiscard（例如写入死信topic）后提交，继续处理之后的消息。
+//
+// ctx结束后停止读取，worker处理完已读取的消息并提交后Run返回nil；
+// 此时再失败的消息不提交，下次消费时重新投递。读取出错时返回错误
+func (r *reader) Run(ctx context.Context, c ...RunConfig) error {
+	cfg := RunConfig{}
+	if len(c) > 0 {
+		cfg = c[0]
+	}
+	cfg = cfg.withDefaults()
+
+	// 处理消息使用的ctx，在worker处理完已读取的消息后才取消
+	procCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chs := make([]chan Message, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range chs {
+		chs[i] = make(chan Message, cfg.BatchSize)
+		wg.Add(1)
+		go func(ch chan Message) {
+			defer wg.Done()
+			r.work(ctx, procCtx, cfg, ch)
+		}(chs[i])
+	}
+
+	var err error
+loop:
+	for {
+		m, ferr := r.FetchMessage(ctx)
+		if ferr != nil {
+			if ctx.Err() == nil {
+				err = ferr
+			}
+			break
+		}
+		select {
+		case chs[m.Partition%cfg.Concurrency] <- m:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	for _, ch := range chs {
+		close(ch)
+	}
+	wg.Wait()
+	return err
+}
+
+// work 按批处理ch中的消息，ch关闭后处理完剩余的消息再返回
+func (r *reader) work(ctx, procCtx context.Context, cfg RunConfig, ch chan Message) {
+	batch := make([]Message, 0, cfg.BatchSize)
+	var timeout <-chan time.Time
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				r.flush(ctx, procCtx, cfg, batch)
+				return
+			}
+			if len(batch) == 0 {
+				timeout = time.After(cfg.BatchTimeout)
+			}
+			batch = append(batch, m)
+			if len(batch) < cfg.BatchSize {
+				continue
+			}
+		case <-timeout:
+		}
+
+		if !r.flush(ctx, procCtx, cfg, batch) {
+			return
+		}
+		batch = batch[:0]
+		timeout = nil
+	}
+}
+
+// flush 处理并提交一批消息，失败时重试直到成功或者用完MaxAttempts；ctx结束后失败返回false
+func (r *reader) flush(ctx, procCtx context.Context, cfg RunConfig, batch []Message) bool {
+	var delay time.Duration
+	attempts := 0
+	for len(batch) > 0 {
+		done, err := r.process(procCtx, cfg, batch)
+		if done > 0 {
+			r.commit(batch[:done])
+			batch = batch[done:]
+			attempts, delay = 0, 0
+		}
+		if err == nil {
+			return true
+		}
+		attempts++
+
+		m := batch[0]
+		log.Errorf("kafka: handle message(%s %d %d) attempt(%d) err(%v)", m.Topic, m.Partition, m.Offset, attempts, err)
+		if cfg.OnError != nil {
+			cfg.OnError(batch, err)
+		}
+		if cfg.MaxAttempts > 0 && attempts >= cfg.MaxAttempts {
+			failed := batch[:1]
+			if cfg.BatchFunc != nil {
+				failed = batch
+			}
+			if r.discard(procCtx, cfg, failed, err) {
+				r.commit(failed)
+				batch = batch[len(failed):]
+				attempts, delay = 0, 0
+				continue
+			}
+		}
+		delay = cfg.ErrorBackoff(attempts, delay)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+	return true
+}
+
+// discard 将用完重试次数的消息交给OnDiscard，返回是否可以跳过这些消息
+func (r *reader) discard(ctx context.Context, cfg RunConfig, msgs []Message, err error) bool {
+	m := msgs[0]
+	if cfg.OnDiscard == nil {
+		log.Errorf("kafka: discard %d message(s) from (%s %d %d) err(%v)", len(msgs), m.Topic, m.Partition, m.Offset, err)
+		return true
+	}
+	if derr := cfg.OnDiscard(ctx, msgs, err); derr != nil {
+		log.Errorf("kafka: discard message(%s %d %d) err(%v)", m.Topic, m.Partition, m.Offset, derr)
+		return false
+	}
+	return true
+}
+
+// process 返回按顺序处理成功的消息数
+func (r *reader) process(ctx context.Context, cfg RunConfig, batch []Message) (int, error) {
+	if cfg.BatchFunc != nil {
+		if err := cfg.BatchFunc(ctx, batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+	hooks := r.hooks
+	if cfg.handler != nil {
+		hooks = []HandlerFunc{cfg.handler}
+	}
+	for i, m := range batch {
+		if err := r.do(ctx, m, hooks); err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
+
+// commit 提交失败只记录日志，之后的提交会覆盖这些offset，或者下次消费时重新投递
+func (r *reader) commit(msgs []Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	if err := r.CommitMessages(ctx, msgs...); err != nil {
+		m := msgs[len(msgs)-1]
+		log.Errorf("kafka: commit message(%s %d %d) err(%v)", m.Topic, m.Partition, m.Offset, err)
+	}
+}
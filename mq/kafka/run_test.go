@@ -0,0 +1,333 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+// fakeBroker 内存中的broker，按partition轮流返回消息，记录每个partition提交的最大offset
+type fakeBroker struct {
+	mu        sync.Mutex
+	msgs      [][]Message
+	next      []int
+	p         int
+	committed map[int]int64
+	commits   int
+	fetchErr  error
+}
+
+func newFakeBroker(partitions, n int) *fakeBroker {
+	b := &fakeBroker{
+		msgs:      make([][]Message, partitions),
+		next:      make([]int, partitions),
+		committed: make(map[int]int64),
+	}
+	for p := 0; p < partitions; p++ {
+		for i := 0; i < n; i++ {
+			b.msgs[p] = append(b.msgs[p], Message{Topic: "t", Partition: p, Offset: int64(i), Value: []byte{byte(p), byte(i)}})
+		}
+	}
+	return b
+}
+
+func (b *fakeBroker) FetchMessage(ctx context.Context) (Message, error) {
+	for {
+		b.mu.Lock()
+		if b.fetchErr != nil {
+			b.mu.Unlock()
+			return Message{}, b.fetchErr
+		}
+		for i := 0; i < len(b.msgs); i++ {
+			p := (b.p + i) % len(b.msgs)
+			if b.next[p] < len(b.msgs[p]) {
+				m := b.msgs[p][b.next[p]]
+				b.next[p]++
+				b.p = p + 1
+				b.mu.Unlock()
+				return m, nil
+			}
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func (b *fakeBroker) CommitMessages(ctx context.Context, msgs ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commits++
+	for _, m := range msgs {
+		if o, ok := b.committed[m.Partition]; !ok || m.Offset > o {
+			b.committed[m.Partition] = m.Offset
+		}
+	}
+	return nil
+}
+
+func (b *fakeBroker) offset(p int) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o, ok := b.committed[p]; ok {
+		return o
+	}
+	return -1
+}
+
+func (b *fakeBroker) commitCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commits
+}
+
+func newFakeReader(b *fakeBroker) *reader {
+	return &reader{broker: b}
+}
+
+func TestRunOrderedConcurrency(t *testing.T) {
+	b := newFakeBroker(4, 50)
+	r := newFakeReader(b)
+
+	var mu sync.Mutex
+	got := make(map[int][]int64)
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		mu.Lock()
+		got[partition] = append(got[partition], offset)
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx, RunConfig{BatchSize: 8, BatchTimeout: 10 * time.Millisecond, Concurrency: 3})
+	}()
+
+	assert.Eventually(t, func() bool {
+		for p := 0; p < 4; p++ {
+			if b.offset(p) != 49 {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	for p := 0; p < 4; p++ {
+		assert.Len(t, got[p], 50)
+		for i, o := range got[p] {
+			assert.Equal(t, int64(i), o)
+		}
+	}
+	// 按批提交
+	assert.True(t, b.commitCount() < 200)
+}
+
+func TestRunBatch(t *testing.T) {
+	b := newFakeBroker(1, 25)
+	r := newFakeReader(b)
+
+	var mu sync.Mutex
+	var sizes []int
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx, RunConfig{
+			BatchSize:    10,
+			BatchTimeout: 20 * time.Millisecond,
+			BatchFunc: func(ctx context.Context, msgs []Message) error {
+				mu.Lock()
+				sizes = append(sizes, len(msgs))
+				mu.Unlock()
+				return nil
+			},
+		})
+	}()
+
+	// 最后5条等待BatchTimeout后处理
+	assert.Eventually(t, func() bool { return b.offset(0) == 24 }, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int{10, 10, 5}, sizes)
+}
+
+func TestRunPauseOnError(t *testing.T) {
+	b := newFakeBroker(1, 10)
+	r := newFakeReader(b)
+
+	var mu sync.Mutex
+	var got []int64
+	failures := 3
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if offset == 4 && failures > 0 {
+			failures--
+			return errors.New("downstream unavailable")
+		}
+		got = append(got, offset)
+		return nil
+	})
+
+	var errs int
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx, RunConfig{
+			BatchSize:    10,
+			BatchTimeout: 5 * time.Millisecond,
+			ErrorBackoff: retry.Constant(30 * time.Millisecond),
+			OnError: func(msgs []Message, err error) {
+				errs++
+				assert.Equal(t, int64(4), msgs[0].Offset)
+			},
+		})
+	}()
+
+	// 失败前的消息先提交，重试期间暂停
+	assert.Eventually(t, func() bool { return b.offset(0) == 3 }, time.Second, time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, int64(3), b.offset(0))
+
+	assert.Eventually(t, func() bool { return b.offset(0) == 9 }, time.Second, 5*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, errs)
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+}
+
+func TestRunMaxAttempts(t *testing.T) {
+	b := newFakeBroker(1, 10)
+	r := newFakeReader(b)
+
+	var mu sync.Mutex
+	var got []int64
+	attempts := 0
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if offset == 4 {
+			attempts++
+			return errors.New("bad message")
+		}
+		got = append(got, offset)
+		return nil
+	})
+
+	// 第一次写死信失败，继续重试
+	var discarded []int64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx, RunConfig{
+			BatchSize:    10,
+			BatchTimeout: 5 * time.Millisecond,
+			ErrorBackoff: retry.Constant(time.Millisecond),
+			MaxAttempts:  3,
+			OnDiscard: func(ctx context.Context, msgs []Message, err error) error {
+				discarded = append(discarded, msgs[0].Offset)
+				if len(discarded) == 1 {
+					return errors.New("dead letter unavailable")
+				}
+				return nil
+			},
+		})
+	}()
+
+	assert.Eventually(t, func() bool { return b.offset(0) == 9 }, time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, []int64{4, 4}, discarded)
+	assert.Equal(t, []int64{0, 1, 2, 3, 5, 6, 7, 8, 9}, got)
+
+	// BatchFunc失败时跳过整批，没有OnDiscard时只记录日志
+	b = newFakeBroker(1, 10)
+	r = newFakeReader(b)
+	var batches int
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- r.Run(ctx, RunConfig{
+			BatchSize:    10,
+			BatchTimeout: time.Minute,
+			ErrorBackoff: retry.Constant(time.Millisecond),
+			MaxAttempts:  2,
+			BatchFunc: func(ctx context.Context, msgs []Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				batches++
+				return errors.New("boom")
+			},
+		})
+	}()
+	assert.Eventually(t, func() bool { return b.offset(0) == 9 }, time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	mu.Lock()
+	assert.Equal(t, 2, batches)
+	mu.Unlock()
+}
+
+func TestRunDrainOnShutdown(t *testing.T) {
+	b := newFakeBroker(2, 20)
+	r := newFakeReader(b)
+
+	started := make(chan struct{})
+	var once sync.Once
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		once.Do(func() { close(started) })
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx, RunConfig{BatchSize: 100, BatchTimeout: time.Hour, Concurrency: 2}) }()
+
+	// 批次没有凑满，关闭时处理完已读取的消息再提交
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	<-started
+	assert.Equal(t, int64(19), b.offset(0))
+	assert.Equal(t, int64(19), b.offset(1))
+}
+
+func TestRunShutdownWithFailure(t *testing.T) {
+	b := newFakeBroker(1, 10)
+	r := newFakeReader(b)
+	r.AddHook(func(partition int, offset int64, key []byte, val []byte) error {
+		if offset >= 5 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx, RunConfig{BatchSize: 10, BatchTimeout: 5 * time.Millisecond}) }()
+
+	assert.Eventually(t, func() bool { return b.offset(0) == 4 }, time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+	// 失败的消息不提交
+	assert.Equal(t, int64(4), b.offset(0))
+}
+
+func TestRunFetchError(t *testing.T) {
+	b := newFakeBroker(1, 0)
+	b.fetchErr = errors.New("broker down")
+	assert.Equal(t, b.fetchErr, newFakeReader(b).Run(context.Background()))
+}
@@ -2,11 +2,11 @@ package kafka
 
 import (
 	"context"
-	"time"
+	"fmt"
 
-	"github.com/rs/xid"
 	kf "github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/snappy"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
 )
 
 type Writer interface {
@@ -17,44 +17,89 @@ type Writer interface {
 }
 type writer struct {
 	kfWriter *kf.Writer
-	c        *kf.WriterConfig
 }
 
 func NewWriter(brokers []string, topic ...string) Writer {
-	dialer := &kf.Dialer{
-		Timeout:  10 * time.Second,
-		ClientID: xid.New().String(),
+	t := ""
+	if len(topic) > 0 {
+		t = topic[0]
 	}
+	return NewWriterWithOptions(brokers, t)
+}
 
-	conf := kf.WriterConfig{
-		Brokers:          brokers,
-		Async:            true,
-		Balancer:         &kf.Hash{},
-		Dialer:           dialer,
-		WriteTimeout:     10 * time.Second,
-		ReadTimeout:      10 * time.Second,
-		CompressionCodec: snappy.NewCompressionCodec(),
+// NewWriterWithOptions 创建生产者，topic为空时每条消息需要指定topic，opts可以配置认证、TLS、压缩、确认数等，
+// 见Option，opts错误时panic
+func NewWriterWithOptions(brokers []string, topic string, opts ...Option) Writer {
+	w, err := OpenWriter(brokers, topic, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("new kafka writer failed err(%v)", err))
 	}
+	return w
+}
 
-	if len(topic) > 0 {
-		conf.Topic = topic[0]
+// OpenWriter 创建生产者，opts错误时返回错误，其他同NewWriterWithOptions
+func OpenWriter(brokers []string, topic string, opts ...Option) (Writer, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
 	}
 
-	return &writer{kfWriter: kf.NewWriter(conf), c: &conf}
+	return &writer{kfWriter: &kf.Writer{
+		Addr:         kf.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     o.balancer,
+		Transport:    o.transport(),
+		Compression:  o.compression,
+		RequiredAcks: o.requiredAcks,
+		Async:        o.async,
+		Completion:   o.completion,
+		BatchSize:    o.batchSize,
+		BatchTimeout: o.batchTimeout,
+		WriteTimeout: o.timeout,
+		ReadTimeout:  o.timeout,
+	}}, nil
 }
 
 func (w *writer) GetWriter() *kf.Writer {
 	return w.kfWriter
 }
 
+// WriteMessage 写入消息，tx中的metainfo和trace context会写入消息头
 func (w *writer) WriteMessage(tx context.Context, msg Message) error {
-	return w.kfWriter.WriteMessages(tx, msg)
+	return w.WriteMessages(tx, []Message{msg})
 }
 
+// WriteMessages 批量写入消息，tx中的metainfo和trace context会写入每条消息的消息头
 func (w *writer) WriteMessages(tx context.Context, msgs []Message) error {
-	return w.kfWriter.WriteMessages(tx, msgs...)
+	topic := w.kfWriter.Topic
+	if topic == "" && len(msgs) > 0 {
+		topic = msgs[0].Topic
+	}
+	ctx, span := trace.Start(tx, "kafka.send", trace.WithKind(trace.KindProducer), trace.WithAttributes(
+		trace.String("messaging.system", "kafka"),
+		trace.String("messaging.destination", topic),
+		trace.Int("messaging.batch.message_count", len(msgs)),
+	))
+
+	if m := metaInfoHeaders(ctx); len(m) > 0 {
+		ms := make([]Message, len(msgs))
+		for i := range msgs {
+			ms[i] = msgs[i]
+			injectHeaders(m, &ms[i])
+		}
+		msgs = ms
+	}
+
+	err := w.kfWriter.WriteMessages(ctx, msgs...)
+	span.RecordError(err)
+	span.End()
+	return err
 }
 
 func (w *writer) Close() error {
-	return w.kfWriter.Close()
+	err := w.kfWriter.Close()
+	if t, ok := w.kfWriter.Transport.(*kf.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	return err
 }
@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/log"
+)
+
+// ErrClosed Publisher或Subscriber已关闭
+var ErrClosed = errors.New("mq: closed")
+
+const defaultRedeliverDelay = 10 * time.Millisecond
+
+// Memory 内存实现的Publisher，用于测试。
+// 每个topic保存所有发布过的消息，每个Subscriber从第一条消息开始独立消费，
+// handler失败时间隔RedeliverDelay按顺序重试同一条消息。
+type Memory struct {
+	// RedeliverDelay handler失败后重新投递的间隔，默认10ms
+	RedeliverDelay time.Duration
+
+	mu      sync.Mutex
+	topic   string
+	topics  map[string][]*Message
+	notify  chan struct{}
+	closed  chan struct{}
+	closeMu sync.Once
+}
+
+// NewMemory 创建内存队列，topic是Publish时消息没有指定topic使用的默认topic
+func NewMemory(topic ...string) *Memory {
+	m := &Memory{
+		topics: make(map[string][]*Message),
+		notify: make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	if len(topic) > 0 {
+		m.topic = topic[0]
+	}
+	return m
+}
+
+// Publish 保存消息的副本
+func (m *Memory) Publish(ctx context.Context, msgs ...*Message) error {
+	select {
+	case <-m.closed:
+		return ErrClosed
+	default:
+	}
+
+	now := time.Now()
+	for _, msg := range msgs {
+		if msg.Topic == "" && m.topic == "" {
+			return errors.New("mq: topic is empty")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range msgs {
+		c := *msg
+		if c.Topic == "" {
+			c.Topic = m.topic
+		}
+		if c.Time.IsZero() {
+			c.Time = now
+		}
+		InjectMetaInfo(ctx, &c)
+		m.topics[c.Topic] = append(m.topics[c.Topic], &c)
+	}
+	close(m.notify)
+	m.notify = make(chan struct{})
+	return nil
+}
+
+// Messages 返回topic发布过的所有消息
+func (m *Memory) Messages(topic string) []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Message(nil), m.topics[topic]...)
+}
+
+// Subscriber 创建topic的订阅者
+func (m *Memory) Subscriber(topic string) Subscriber {
+	return &memorySubscriber{m: m, topic: topic, closed: make(chan struct{})}
+}
+
+// Close 关闭后Publish返回ErrClosed，所有Subscribe返回
+func (m *Memory) Close() error {
+	m.closeMu.Do(func() {
+		close(m.closed)
+	})
+	return nil
+}
+
+// next 返回offset处的消息，没有时返回等待新消息的channel
+func (m *Memory) next(topic string, offset int) (*Message, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if msgs := m.topics[topic]; offset < len(msgs) {
+		return msgs[offset], nil
+	}
+	return nil, m.notify
+}
+
+type memorySubscriber struct {
+	m         *Memory
+	topic     string
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (s *memorySubscriber) Subscribe(ctx context.Context, h Handler) error {
+	delay := s.m.RedeliverDelay
+	if delay <= 0 {
+		delay = defaultRedeliverDelay
+	}
+
+	offset := 0
+	for !s.done(ctx) {
+		msg, wait := s.m.next(s.topic, offset)
+		if msg == nil {
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+			case <-s.closed:
+			case <-s.m.closed:
+			}
+			return nil
+		}
+
+		c := *msg
+		if err := h(ExtractMetaInfo(ctx, &c), &c); err != nil {
+			log.Warnf("mq: memory handle message(%s) err(%v)", s.topic, err)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-ctx.Done():
+			case <-s.closed:
+			case <-s.m.closed:
+			}
+			return nil
+		}
+		offset++
+	}
+	return nil
+}
+
+func (s *memorySubscriber) done(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+	case <-s.closed:
+	case <-s.m.closed:
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
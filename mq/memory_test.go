@@ -0,0 +1,66 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory("orders")
+	m.RedeliverDelay = time.Millisecond
+	defer m.Close()
+
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+	assert.NoError(t, m.Publish(ctx, NewMessage("", []byte("a")).SetHeader("h", "v"), &Message{Key: []byte("k"), Body: []byte("b")}))
+	assert.NoError(t, m.Publish(ctx, NewMessage("other", []byte("c"))))
+	assert.Len(t, m.Messages("orders"), 2)
+	assert.Len(t, m.Messages("other"), 1)
+
+	var mu sync.Mutex
+	var got []string
+	fails := 2
+	s := m.Subscriber("orders")
+	done := make(chan error)
+	go func() {
+		done <- s.Subscribe(context.Background(), func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if string(msg.Body) == "b" && fails > 0 {
+				fails--
+				return errors.New("boom")
+			}
+			v, _ := metainfo.GetPersistentValue(ctx, "trace_id")
+			assert.Equal(t, "t1", v)
+			assert.Equal(t, "orders", msg.Topic)
+			assert.False(t, msg.Time.IsZero())
+			got = append(got, string(msg.Body))
+			return nil
+		})
+	}()
+
+	assert.NoError(t, m.Publish(ctx, NewMessage("orders", []byte("d"))))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{"a", "b", "d"}, got)
+	assert.Equal(t, 0, fails)
+	mu.Unlock()
+
+	assert.NoError(t, s.Close())
+	assert.NoError(t, <-done)
+
+	assert.NoError(t, m.Close())
+	assert.Equal(t, ErrClosed, m.Publish(ctx, NewMessage("orders", nil)))
+	assert.Error(t, NewMemory().Publish(ctx, &Message{}))
+}
@@ -0,0 +1,239 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/log"
+	"github.com/aaabigfish/gopkg/stat/counter"
+)
+
+// Middleware 包装Handler，kafka、nsq、asynq、redisstream的Subscriber和Handle都可以使用
+type Middleware func(Handler) Handler
+
+// Chain 组合多个Middleware，第一个在最外层
+//
+//	h := mq.Chain(
+//		mq.Recovery(),
+//		mq.Logging(),
+//		mq.DeadLetter(pub, "orders.dlq"),
+//		mq.Retry(retry.New(retry.WithMaxAttempts(3))),
+//		mq.Dedup(rdb, mq.DedupOptions{}),
+//	)(handler)
+func Chain(mws ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// Recovery 将handler的panic转换成错误，并打印堆栈
+func Recovery() Middleware {
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("mq: handle message(%s %s) panic(%v)\n%s", msg.Topic, msg.Key, r, debug.Stack())
+					err = fmt.Errorf("mq: panic: %v", r)
+				}
+			}()
+			return h(ctx, msg)
+		}
+	}
+}
+
+// Logging 记录处理失败的消息和耗时
+func Logging() Middleware {
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := h(ctx, msg)
+			if err != nil {
+				log.Errorf("mq: handle message(%s %s) cost(%v) err(%v)", msg.Topic, msg.Key, time.Since(start), err)
+			} else {
+				log.Debugf("mq: handle message(%s %s) cost(%v)", msg.Topic, msg.Key, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// MetricsFunc 记录一次消息处理的结果
+type MetricsFunc func(topic string, cost time.Duration, err error)
+
+// Metrics 每次处理后调用f，可以对接prometheus等监控
+func Metrics(f MetricsFunc) Middleware {
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := h(ctx, msg)
+			f(msg.Topic, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// CounterMetrics 按topic累加到counter.Group，key为 topic+".success"、topic+".failure"、topic+".cost_ms"
+func CounterMetrics(g *counter.Group) MetricsFunc {
+	return func(topic string, cost time.Duration, err error) {
+		if err != nil {
+			g.Add(topic+".failure", 1)
+		} else {
+			g.Add(topic+".success", 1)
+		}
+		g.Add(topic+".cost_ms", cost.Milliseconds())
+	}
+}
+
+// Retry 处理失败时在当前消费者内按r重试，重试仍失败时返回最后一次的错误
+func Retry(r *retry.Retrier) Middleware {
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			return r.Do(ctx, func(ctx context.Context) error {
+				return h(ctx, msg)
+			})
+		}
+	}
+}
+
+// 写入死信topic时附加的消息头
+const (
+	HeaderDeadTopic = "x-dead-topic"
+	HeaderDeadError = "x-dead-error"
+	HeaderDeadTime  = "x-dead-time"
+)
+
+// DeadLetter 处理失败时将消息发布到死信topic并返回nil（消息不再重新投递），
+// 发布失败时返回原来的错误。一般放在Retry外层，重试用完后再写入死信
+func DeadLetter(pub Publisher, topic string) Middleware {
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			err := h(ctx, msg)
+			if err == nil {
+				return nil
+			}
+
+			dead := &Message{Topic: topic, Key: msg.Key, Body: msg.Body, Time: msg.Time}
+			dead.Headers = make(map[string]string, len(msg.Headers)+3)
+			for k, v := range msg.Headers {
+				dead.Headers[k] = v
+			}
+			dead.Headers[HeaderDeadTopic] = msg.Topic
+			dead.Headers[HeaderDeadError] = err.Error()
+			dead.Headers[HeaderDeadTime] = time.Now().Format(time.RFC3339Nano)
+			if perr := pub.Publish(ctx, dead); perr != nil {
+				log.Errorf("mq: publish message(%s %s) to dead letter topic(%s) err(%v)", msg.Topic, msg.Key, topic, perr)
+				return err
+			}
+			log.Warnf("mq: message(%s %s) moved to dead letter topic(%s) err(%v)", msg.Topic, msg.Key, topic, err)
+			return nil
+		}
+	}
+}
+
+// ErrInFlight 相同key的消息正在被其他消费者处理
+var ErrInFlight = errors.New("mq: message in flight")
+
+// HeaderMessageID 消息id的消息头，生产者设置后Dedup默认按它去重
+//
+//	msg.SetHeader(mq.HeaderMessageID, orderID)
+const HeaderMessageID = "x-message-id"
+
+const (
+	defaultDedupPrefix  = "mq:dedup:"
+	defaultDedupTTL     = 24 * time.Hour
+	defaultDedupLockTTL = time.Minute
+
+	dedupProcessing = "0"
+	dedupDone       = "1"
+)
+
+// DedupOptions 去重配置，零值使用默认值
+type DedupOptions struct {
+	// Prefix redis key的前缀，默认"mq:dedup:"
+	Prefix string
+	// TTL 处理成功后记录保留的时间，默认24h
+	TTL time.Duration
+	// LockTTL 处理中的标记的过期时间，应大于处理耗时，默认1m
+	LockTTL time.Duration
+	// Key 去重的key，返回空字符串时不去重。默认 topic+":"+消息头HeaderMessageID，
+	// 没有这个消息头的消息不去重。消息的key通常是分区key，不同的消息可能相同，不能用来去重
+	Key func(msg *Message) string
+}
+
+func (o DedupOptions) withDefaults() DedupOptions {
+	if o.Prefix == "" {
+		o.Prefix = defaultDedupPrefix
+	}
+	if o.TTL <= 0 {
+		o.TTL = defaultDedupTTL
+	}
+	if o.LockTTL <= 0 {
+		o.LockTTL = defaultDedupLockTTL
+	}
+	if o.Key == nil {
+		o.Key = func(msg *Message) string {
+			id := msg.Headers[HeaderMessageID]
+			if id == "" {
+				return ""
+			}
+			return msg.Topic + ":" + id
+		}
+	}
+	return o
+}
+
+// Dedup 按DedupOptions.Key在redis中去重，处理成功过的消息直接返回nil。
+// 处理前用 SET NX 标记处理中，成功后标记为已处理保留TTL，失败时删除标记以便重新投递后再处理；
+// 相同key的消息正在被处理时返回ErrInFlight，redis出错时返回错误
+func Dedup(rdb gredis.UniversalClient, opt DedupOptions) Middleware {
+	opt = opt.withDefaults()
+	return func(h Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			k := opt.Key(msg)
+			if k == "" {
+				return h(ctx, msg)
+			}
+			k = opt.Prefix + k
+
+			ok, err := rdb.SetNX(ctx, k, dedupProcessing, opt.LockTTL).Result()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				v, err := rdb.Get(ctx, k).Result()
+				switch {
+				case err == nil && v == dedupDone:
+					log.Debugf("mq: skip duplicate message(%s %s)", msg.Topic, msg.Key)
+					return nil
+				case err == gredis.Nil:
+					// 标记刚好过期，交给下次投递
+					return ErrInFlight
+				case err != nil:
+					return err
+				default:
+					return ErrInFlight
+				}
+			}
+
+			if err := h(ctx, msg); err != nil {
+				if derr := rdb.Del(context.Background(), k).Err(); derr != nil {
+					log.Warnf("mq: delete dedup key(%s) err(%v)", k, derr)
+				}
+				return err
+			}
+			if err := rdb.Set(context.Background(), k, dedupDone, opt.TTL).Err(); err != nil {
+				log.Warnf("mq: set dedup key(%s) err(%v)", k, err)
+			}
+			return nil
+		}
+	}
+}
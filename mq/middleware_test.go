@@ -0,0 +1,136 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+	"github.com/aaabigfish/gopkg/stat/counter"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return func(ctx context.Context, msg *Message) error {
+				order = append(order, name)
+				return h(ctx, msg)
+			}
+		}
+	}
+	h := Chain(mw("a"), mw("b"), Logging())(func(ctx context.Context, msg *Message) error {
+		order = append(order, "h")
+		return nil
+	})
+	assert.NoError(t, h(context.Background(), NewMessage("t", nil)))
+	assert.Equal(t, []string{"a", "b", "h"}, order)
+}
+
+func TestRecoveryRetryMetrics(t *testing.T) {
+	g := &counter.Group{New: counter.NewGauge}
+	calls := 0
+	h := Chain(
+		Metrics(CounterMetrics(g)),
+		Retry(retry.New(retry.WithMaxAttempts(3), retry.WithBackoff(retry.Constant(time.Millisecond)))),
+		Recovery(),
+	)(func(ctx context.Context, msg *Message) error {
+		calls++
+		if calls < 3 {
+			panic("boom")
+		}
+		return nil
+	})
+
+	assert.NoError(t, h(context.Background(), NewMessage("t", nil)))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, int64(1), g.Value("t.success"))
+
+	boom := errors.New("boom")
+	h = Chain(Metrics(CounterMetrics(g)), Recovery())(func(ctx context.Context, msg *Message) error {
+		return boom
+	})
+	assert.Equal(t, boom, h(context.Background(), NewMessage("t", nil)))
+	assert.Equal(t, int64(1), g.Value("t.failure"))
+}
+
+func TestDeadLetter(t *testing.T) {
+	m := NewMemory()
+	boom := errors.New("boom")
+	h := DeadLetter(m, "orders.dlq")(func(ctx context.Context, msg *Message) error {
+		if string(msg.Body) == "bad" {
+			return boom
+		}
+		return nil
+	})
+
+	assert.NoError(t, h(context.Background(), NewMessage("orders", []byte("ok"))))
+	assert.NoError(t, h(context.Background(), NewMessage("orders", []byte("bad")).SetHeader("h", "v")))
+	dead := m.Messages("orders.dlq")
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, []byte("bad"), dead[0].Body)
+		assert.Equal(t, "v", dead[0].Headers["h"])
+		assert.Equal(t, "orders", dead[0].Headers[HeaderDeadTopic])
+		assert.Equal(t, "boom", dead[0].Headers[HeaderDeadError])
+	}
+
+	// 发布失败时返回原来的错误
+	m.Close()
+	assert.Equal(t, boom, h(context.Background(), NewMessage("orders", []byte("bad"))))
+}
+
+func TestDedup(t *testing.T) {
+	s := miniredis.RunT(t)
+	rdb := gredis.NewClient(&gredis.Options{Addr: s.Addr()})
+	defer rdb.Close()
+
+	calls := 0
+	fail := true
+	h := Dedup(rdb, DedupOptions{TTL: time.Hour})(func(ctx context.Context, msg *Message) error {
+		calls++
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	msg := (&Message{Topic: "orders", Key: []byte("user:1")}).SetHeader(HeaderMessageID, "1")
+
+	// 失败后可以重新处理
+	assert.Error(t, h(context.Background(), msg))
+	assert.False(t, s.Exists("mq:dedup:orders:1"))
+	fail = false
+	assert.NoError(t, h(context.Background(), msg))
+	assert.NoError(t, h(context.Background(), msg))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, time.Hour, s.TTL("mq:dedup:orders:1"))
+
+	// 没有消息id的消息不去重
+	assert.NoError(t, h(context.Background(), &Message{Topic: "orders", Key: []byte("user:1")}))
+	assert.NoError(t, h(context.Background(), &Message{Topic: "orders", Key: []byte("user:1")}))
+	assert.Equal(t, 4, calls)
+
+	// key相同的不同消息都会处理
+	other := (&Message{Topic: "orders", Key: []byte("user:1")}).SetHeader(HeaderMessageID, "2")
+	assert.NoError(t, h(context.Background(), other))
+	assert.Equal(t, 5, calls)
+
+	// 处理中
+	s.Set("mq:dedup:orders:3", dedupProcessing)
+	assert.Equal(t, ErrInFlight, h(context.Background(), (&Message{Topic: "orders"}).SetHeader(HeaderMessageID, "3")))
+	assert.Equal(t, 5, calls)
+
+	// 自定义key
+	h = Dedup(rdb, DedupOptions{Key: func(msg *Message) string { return string(msg.Body) }})(func(ctx context.Context, msg *Message) error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, h(context.Background(), &Message{Topic: "orders", Body: []byte("a")}))
+	assert.NoError(t, h(context.Background(), &Message{Topic: "orders", Body: []byte("a")}))
+	assert.Equal(t, 6, calls)
+	assert.True(t, s.Exists("mq:dedup:a"))
+}
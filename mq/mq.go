@@ -0,0 +1,83 @@
+// Package mq 定义与队列实现无关的Publisher和Subscriber，
+// kafka、nsq、asynq、redisstream 各自提供适配器（NewPublisher、NewSubscriber），
+// 切换队列时生产和消费代码不需要修改。测试时可以使用内存实现 NewMemory。
+package mq
+
+import (
+	"context"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+// Message 通用消息
+type Message struct {
+	// Topic 发布时为空使用Publisher默认的topic（kafka的topic、nsq的topic、asynq的任务类型、redis的stream）
+	Topic   string
+	Key     []byte
+	Headers map[string]string
+	Body    []byte
+	// Time 发布时为零值自动设置为当前时间
+	Time time.Time
+}
+
+// NewMessage 创建消息
+func NewMessage(topic string, body []byte) *Message {
+	return &Message{Topic: topic, Body: body}
+}
+
+// SetHeader 设置消息头
+func (m *Message) SetHeader(key, val string) *Message {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = val
+	return m
+}
+
+// Handler 处理消息，返回错误时消息按各队列的语义重新投递
+type Handler func(ctx context.Context, msg *Message) error
+
+// Publisher 发布消息
+type Publisher interface {
+	// Publish 发布消息，ctx中的metainfo和trace context会写入消息头
+	Publish(ctx context.Context, msgs ...*Message) error
+	Close() error
+}
+
+// Subscriber 订阅消息
+type Subscriber interface {
+	// Subscribe 阻塞消费消息直到ctx结束或Close，handler的ctx中带有生产者的metainfo
+	Subscribe(ctx context.Context, h Handler) error
+	Close() error
+}
+
+// InjectMetaInfo 将ctx中的metainfo（transient和persistent）和trace context写入消息头
+func InjectMetaInfo(ctx context.Context, msg *Message) {
+	m := make(map[string]string)
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	if len(m) == 0 {
+		return
+	}
+
+	headers := make(map[string]string, len(msg.Headers)+len(m))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	for k, v := range m {
+		headers[k] = v
+	}
+	msg.Headers = headers
+}
+
+// ExtractMetaInfo 从消息头恢复metainfo和trace context到ctx，消费者作为下游调用TransferForward
+func ExtractMetaInfo(ctx context.Context, msg *Message) context.Context {
+	if msg == nil || len(msg.Headers) == 0 {
+		return ctx
+	}
+
+	ctx = metainfo.SetMetaInfoFromMap(ctx, msg.Headers)
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.MapHeader(msg.Headers))
+	return metainfo.TransferForward(ctx)
+}
@@ -0,0 +1,76 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+// ContextHandlerFunc 处理PushMessage/PushMessageContext写入的消息，ctx中带有生产者的metainfo
+type ContextHandlerFunc func(context.Context, *Message) error
+
+// InjectMetaInfo 将ctx中的metainfo（transient和persistent）和trace context写入消息头
+func InjectMetaInfo(ctx context.Context, msg *Message) {
+	m := make(map[string]string)
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	if len(m) == 0 {
+		return
+	}
+
+	headers := make([]Header, 0, len(msg.Headers)+len(m))
+	for _, h := range msg.Headers {
+		if _, ok := m[h.Key]; !ok {
+			headers = append(headers, h)
+		}
+	}
+	for k, v := range m {
+		headers = append(headers, Header{Key: k, Value: []byte(v)})
+	}
+	msg.Headers = headers
+}
+
+// ExtractMetaInfo 从消息头恢复metainfo和trace context到ctx，消费者作为下游调用TransferForward
+func ExtractMetaInfo(ctx context.Context, msg *Message) context.Context {
+	if msg == nil || len(msg.Headers) == 0 {
+		return ctx
+	}
+
+	m := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		m[h.Key] = string(h.Value)
+	}
+	ctx = metainfo.SetMetaInfoFromMap(ctx, m)
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.MapHeader(m))
+	return metainfo.TransferForward(ctx)
+}
+
+// DecodeMessage 解析PushMessage写入的消息
+func DecodeMessage(m *NsqMessage) (*Message, error) {
+	msg := &Message{}
+	if err := json.Unmarshal(m.Body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// WithMetaInfo 将ContextHandlerFunc转换成HandlerFunc，解析消息、恢复metainfo并创建消费span
+func WithMetaInfo(h ContextHandlerFunc) HandlerFunc {
+	return func(m *NsqMessage) error {
+		msg, err := DecodeMessage(m)
+		if err != nil {
+			return err
+		}
+		ctx, span := trace.Start(ExtractMetaInfo(context.Background(), msg), "nsq.receive",
+			trace.WithKind(trace.KindConsumer), trace.WithAttributes(
+				trace.String("messaging.system", "nsq"),
+				trace.String("messaging.destination", msg.Topic),
+			))
+		err = h(ctx, msg)
+		span.RecordError(err)
+		span.End()
+		return err
+	}
+}
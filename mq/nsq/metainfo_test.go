@@ -0,0 +1,93 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+func TestMetaInfoPropagation(t *testing.T) {
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+	ctx = metainfo.WithValue(ctx, "tk", "tv")
+	ctx, _ = metainfo.StartSpan(ctx)
+
+	msg := NewMessage().SetTopic("orders").SetHeader("x", []byte("y")).SetBody([]byte(`{"id":1}`))
+	sent := *msg
+	InjectMetaInfo(ctx, &sent)
+	assert.True(t, len(sent.Headers) > 1)
+
+	body, err := json.Marshal(&sent)
+	assert.NoError(t, err)
+
+	var called bool
+	h := WithMetaInfo(func(hctx context.Context, m *Message) error {
+		called = true
+		assert.Equal(t, "orders", m.Topic)
+		assert.Equal(t, []byte(`{"id":1}`), m.Body)
+
+		v, ok := metainfo.GetPersistentValue(hctx, "trace_id")
+		assert.True(t, ok && v == "t1", v)
+		v, ok = metainfo.GetValue(hctx, "tk")
+		assert.True(t, ok && v == "tv", v)
+		assert.Equal(t, metainfo.TraceID(ctx), metainfo.TraceID(hctx))
+		return nil
+	})
+	assert.NoError(t, h(nsq.NewMessage(nsq.MessageID{}, body)))
+	assert.True(t, called)
+
+	// 解析失败
+	assert.Error(t, h(nsq.NewMessage(nsq.MessageID{}, []byte("x"))))
+}
+
+func TestPushMessageContextKeepsMessage(t *testing.T) {
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+	msg := NewMessage().SetHeader("x", []byte("y"))
+
+	// 没有producer，发送失败，和kafka一样不修改调用方的消息
+	w := &writer{topic: "orders"}
+	assert.Error(t, w.PushMessageContext(ctx, msg))
+	assert.Equal(t, []Header{{Key: "x", Value: []byte("y")}}, msg.Headers)
+}
+
+func TestSpans(t *testing.T) {
+	me := trace.NewMemoryExporter()
+	old := trace.GetProvider()
+	trace.SetProvider(trace.NewProvider(trace.WithSyncer(me)))
+	defer trace.SetProvider(old)
+
+	// 发送失败的producer span
+	ctx, root := trace.Start(context.Background(), "root")
+	w := &writer{topic: "orders"}
+	assert.Error(t, w.PushMessageContext(ctx, NewMessage()))
+	root.End()
+
+	spans := me.Spans()
+	assert.Len(t, spans, 2)
+	send := spans[0]
+	assert.Equal(t, "nsq.send", send.Name)
+	assert.Equal(t, trace.KindProducer, send.Kind)
+	assert.Equal(t, root.SpanContext().SpanID, send.ParentSpanID)
+	assert.Equal(t, trace.StatusError, send.Status.Code)
+	assert.Contains(t, send.Attributes, trace.String("messaging.destination", "orders"))
+
+	// consumer span的父span是producer span
+	me.Reset()
+	msg := NewMessage().SetTopic("orders")
+	InjectMetaInfo(ctx, msg)
+	body, _ := json.Marshal(msg)
+	h := WithMetaInfo(func(ctx context.Context, m *Message) error { return nil })
+	assert.NoError(t, h(nsq.NewMessage(nsq.MessageID{}, body)))
+
+	spans = me.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "nsq.receive", spans[0].Name)
+	assert.Equal(t, trace.KindConsumer, spans[0].Kind)
+	assert.Equal(t, root.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, root.SpanContext().SpanID, spans[0].ParentSpanID)
+}
@@ -1,6 +1,7 @@
 package nsq
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"time"
 
 	"github.com/nsqio/go-nsq"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
 )
 
 type Producer = nsq.Producer
@@ -18,10 +21,13 @@ type Writer interface {
 	Push(data interface{}, key ...[]byte) error
 	PushTopic(topic string, data interface{}, key ...[]byte) error
 	PushMessage(msg *Message) error
+	PushMessageContext(ctx context.Context, msg *Message) error
 	Publish(topic string, body []byte, key ...[]byte) error
 	MultiPublish(topic string, bodys [][]byte, key ...[]byte) error
 	PublishDelay(topic string, t time.Duration, body []byte, key ...[]byte) error
 	GetProducer() *Producer
+	// Topic 返回Push使用的topic，没有时为空
+	Topic() string
 	Close()
 }
 
@@ -110,6 +116,10 @@ func (w *writer) GetProducer() *Producer {
 	return producer.pub
 }
 
+func (w *writer) Topic() string {
+	return w.topic
+}
+
 // 获取平衡器，默认是循环所有节点
 func (w *writer) getBalancer() Balancer {
 	if w.balancer != nil {
@@ -255,6 +265,25 @@ func (w *writer) PushMessage(msg *Message) error {
 	return w.Publish(topic, payload, msg.Key)
 }
 
+// 发送消息，ctx中的metainfo和trace context会写入消息头（不修改msg），消费者使用WithMetaInfo恢复
+func (w *writer) PushMessageContext(ctx context.Context, msg *Message) error {
+	topic := w.topic
+	if msg.Topic != "" {
+		topic = msg.Topic
+	}
+	ctx, span := trace.Start(ctx, "nsq.send", trace.WithKind(trace.KindProducer), trace.WithAttributes(
+		trace.String("messaging.system", "nsq"),
+		trace.String("messaging.destination", topic),
+	))
+
+	m := *msg
+	InjectMetaInfo(ctx, &m)
+	err := w.PushMessage(&m)
+	span.RecordError(err)
+	span.End()
+	return err
+}
+
 func (w *writer) Close() {
 	for _, p := range w.producers {
 		p.unPubFunc()
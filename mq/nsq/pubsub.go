@@ -0,0 +1,105 @@
+package nsq
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+type publisher struct {
+	w Writer
+}
+
+// NewPublisher 将Writer适配为mq.Publisher，消息用PushMessageContext写入
+func NewPublisher(w Writer) mq.Publisher {
+	return &publisher{w: w}
+}
+
+func (p *publisher) Publish(ctx context.Context, msgs ...*mq.Message) error {
+	for _, m := range msgs {
+		msg := &Message{Topic: m.Topic, Key: m.Key, Body: m.Body}
+		if !m.Time.IsZero() {
+			msg.Time = m.Time.UnixNano()
+		}
+		for k, v := range m.Headers {
+			msg.Headers = append(msg.Headers, Header{Key: k, Value: []byte(v)})
+		}
+		if err := p.w.PushMessageContext(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *publisher) Close() error {
+	p.w.Close()
+	return nil
+}
+
+type subscriber struct {
+	r         Reader
+	n         int
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewSubscriber 将Reader适配为mq.Subscriber，只能消费PushMessage格式的消息，
+// concurrency是并发处理的数量，默认1。handler失败的消息由nsq重新入队
+func NewSubscriber(r Reader, concurrency ...int) mq.Subscriber {
+	s := &subscriber{r: r, n: 1, closed: make(chan struct{})}
+	if len(concurrency) > 0 && concurrency[0] > 0 {
+		s.n = concurrency[0]
+	}
+	return s
+}
+
+func (s *subscriber) Subscribe(ctx context.Context, h mq.Handler) error {
+	s.r.AddHandlers(s.n, handle(s.r.Topic(), h))
+	if err := s.r.Run(); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-s.closed:
+	}
+	s.r.Close()
+	<-s.r.GetConsumer().StopChan
+	return nil
+}
+
+// Close 停止Subscribe
+func (s *subscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+// Handle 将mq.Handler转换成HandlerFunc，只能处理PushMessage格式的消息，可以配合mq.Middleware使用
+//
+//	r.AddHandler(nsq.Handle(mq.Chain(mq.Recovery(), mq.Logging())(handler)))
+func Handle(h mq.Handler) HandlerFunc {
+	return handle("", h)
+}
+
+func handle(topic string, h mq.Handler) HandlerFunc {
+	return WithMetaInfo(func(ctx context.Context, m *Message) error {
+		msg := &mq.Message{Topic: m.Topic, Key: m.Key, Body: m.Body}
+		if msg.Topic == "" {
+			msg.Topic = topic
+		}
+		if m.Time > 0 {
+			msg.Time = time.Unix(0, m.Time)
+		}
+		if len(m.Headers) > 0 {
+			msg.Headers = make(map[string]string, len(m.Headers))
+			for _, hd := range m.Headers {
+				msg.Headers[hd.Key] = string(hd.Value)
+			}
+		}
+		return h(ctx, msg)
+	})
+}
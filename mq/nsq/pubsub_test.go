@@ -0,0 +1,43 @@
+package nsq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+// hookReader 包装Reader，记录注册的处理函数
+type hookReader struct {
+	Reader
+	h HandlerFunc
+}
+
+func (r *hookReader) AddHandlers(n int, h HandlerFunc) {
+	r.h = h
+}
+
+func (r *hookReader) Run() error {
+	return errors.New("no lookupd")
+}
+
+func TestSubscriberTopic(t *testing.T) {
+	// 包装的Reader也使用其topic
+	r := &hookReader{Reader: &reader{topic: "orders"}}
+	var got *mq.Message
+	err := NewSubscriber(r).Subscribe(context.Background(), func(ctx context.Context, m *mq.Message) error {
+		got = m
+		return nil
+	})
+	assert.Error(t, err)
+
+	body, _ := json.Marshal(NewMessage().SetBody([]byte("x")))
+	assert.NoError(t, r.h(nsq.NewMessage(nsq.MessageID{}, body)))
+	assert.Equal(t, "orders", got.Topic)
+	assert.Equal(t, []byte("x"), got.Body)
+}
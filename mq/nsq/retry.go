@@ -0,0 +1,52 @@
+package nsq
+
+import (
+	"context"
+	"time"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+type retryWriter struct {
+	Writer
+	r *retry.Retrier
+}
+
+// WithRetry 返回发送失败时按r重试的Writer，每次重试都会重新选择生产者
+func WithRetry(w Writer, r *retry.Retrier) Writer {
+	return &retryWriter{Writer: w, r: r}
+}
+
+func (w *retryWriter) do(ctx context.Context, fn func() error) error {
+	return w.r.Do(ctx, func(context.Context) error {
+		return fn()
+	})
+}
+
+func (w *retryWriter) Push(data interface{}, key ...[]byte) error {
+	return w.do(context.Background(), func() error { return w.Writer.Push(data, key...) })
+}
+
+func (w *retryWriter) PushTopic(topic string, data interface{}, key ...[]byte) error {
+	return w.do(context.Background(), func() error { return w.Writer.PushTopic(topic, data, key...) })
+}
+
+func (w *retryWriter) PushMessage(msg *Message) error {
+	return w.do(context.Background(), func() error { return w.Writer.PushMessage(msg) })
+}
+
+func (w *retryWriter) PushMessageContext(ctx context.Context, msg *Message) error {
+	return w.do(ctx, func() error { return w.Writer.PushMessageContext(ctx, msg) })
+}
+
+func (w *retryWriter) Publish(topic string, body []byte, key ...[]byte) error {
+	return w.do(context.Background(), func() error { return w.Writer.Publish(topic, body, key...) })
+}
+
+func (w *retryWriter) MultiPublish(topic string, bodys [][]byte, key ...[]byte) error {
+	return w.do(context.Background(), func() error { return w.Writer.MultiPublish(topic, bodys, key...) })
+}
+
+func (w *retryWriter) PublishDelay(topic string, t time.Duration, body []byte, key ...[]byte) error {
+	return w.do(context.Background(), func() error { return w.Writer.PublishDelay(topic, t, body, key...) })
+}
@@ -0,0 +1,58 @@
+package nsq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+// failWriter 前fails次发送失败
+type failWriter struct {
+	Writer
+	fails  int
+	calls  int
+	topics []string
+}
+
+func (w *failWriter) try(topic string) error {
+	w.calls++
+	if w.calls <= w.fails {
+		return errors.New("connection refused")
+	}
+	w.topics = append(w.topics, topic)
+	return nil
+}
+
+func (w *failWriter) Publish(topic string, body []byte, key ...[]byte) error {
+	return w.try(topic)
+}
+
+func (w *failWriter) PushMessageContext(ctx context.Context, msg *Message) error {
+	return w.try(msg.Topic)
+}
+
+func TestWithRetry(t *testing.T) {
+	r := retry.New(retry.WithMaxAttempts(3), retry.WithBackoff(retry.Constant(time.Millisecond)))
+
+	fw := &failWriter{fails: 2}
+	w := WithRetry(fw, r)
+	assert.NoError(t, w.Publish("orders", []byte("a")))
+	assert.Equal(t, 3, fw.calls)
+	assert.Equal(t, []string{"orders"}, fw.topics)
+
+	fw = &failWriter{fails: 3}
+	assert.Error(t, WithRetry(fw, r).Publish("orders", nil))
+	assert.Equal(t, 3, fw.calls)
+
+	// ctx结束后不再重试
+	fw = &failWriter{fails: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, WithRetry(fw, retry.New(retry.WithMaxAttempts(0))).PushMessageContext(ctx, NewMessage()))
+	assert.Equal(t, 1, fw.calls)
+}
@@ -21,6 +21,8 @@ type Reader interface {
 	GetConsumer() *nsq.Consumer
 	AddHandler(HandlerFunc)
 	AddHandlers(int, HandlerFunc)
+	// Topic 返回消费的topic
+	Topic() string
 	Run() error
 	Close()
 }
@@ -68,6 +70,10 @@ func (r *reader) AddHandlers(n int, hookFunc HandlerFunc) {
 	r.consumer.AddConcurrentHandlers(HandlerFunc(hookFunc), n)
 }
 
+func (r *reader) Topic() string {
+	return r.topic
+}
+
 func (r *reader) Run() error {
 	return r.consumer.ConnectToNSQLookupds(r.addrs)
 }
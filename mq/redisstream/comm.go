@@ -0,0 +1,145 @@
+package redisstream
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+)
+
+type Client = gredis.UniversalClient
+
+type HandlerFunc func(context.Context, *Message) error
+
+// 消息在stream中的字段，消息头的字段加上headerPrefix前缀
+const (
+	fieldKey     = "key"
+	fieldBody    = "body"
+	fieldTime    = "time"
+	headerPrefix = "h:"
+)
+
+// 写入死信stream时附加的消息头
+const (
+	HeaderDeadStream     = "x-dead-stream"
+	HeaderDeadID         = "x-dead-id"
+	HeaderDeadGroup      = "x-dead-group"
+	HeaderDeadDeliveries = "x-dead-deliveries"
+)
+
+type Message struct {
+	// Stream 写入时为空使用Writer的stream
+	Stream string
+	// ID 消息id，写入后由redis生成
+	ID      string
+	Key     []byte
+	Body    []byte
+	Headers map[string]string
+
+	// Time 消息时间（unix纳秒），为0时写入前设置为当前时间，id的时间部分是redis写入时的毫秒时间
+	Time int64
+
+	// Deliveries 消息被投递的次数，第一次消费时为1
+	Deliveries int64
+}
+
+func (m *Message) values() map[string]interface{} {
+	values := make(map[string]interface{}, len(m.Headers)+3)
+	if len(m.Key) > 0 {
+		values[fieldKey] = m.Key
+	}
+	values[fieldBody] = m.Body
+	values[fieldTime] = m.Time
+	for k, v := range m.Headers {
+		values[headerPrefix+k] = v
+	}
+	return values
+}
+
+func newMessage(stream string, xm gredis.XMessage) *Message {
+	m := &Message{Stream: stream, ID: xm.ID, Deliveries: 1}
+	for k, v := range xm.Values {
+		s, _ := v.(string)
+		switch {
+		case k == fieldKey:
+			m.Key = []byte(s)
+		case k == fieldBody:
+			m.Body = []byte(s)
+		case k == fieldTime:
+			m.Time, _ = strconv.ParseInt(s, 10, 64)
+		case strings.HasPrefix(k, headerPrefix):
+			if m.Headers == nil {
+				m.Headers = make(map[string]string)
+			}
+			m.Headers[k[len(headerPrefix):]] = s
+		}
+	}
+	return m
+}
+
+// WriterConfig 生产者配置
+type WriterConfig struct {
+	// Stream 默认写入的stream
+	Stream string
+	// MaxLen 写入时按 XADD MAXLEN 裁剪stream，0不裁剪
+	MaxLen int64
+	// ExactTrim 精确裁剪到MaxLen，默认使用 MAXLEN ~ 近似裁剪，性能更好
+	ExactTrim bool
+}
+
+const (
+	defaultCount        = 10
+	defaultBlock        = 2 * time.Second
+	defaultMinIdle      = time.Minute
+	defaultDeadSuffix   = ":dead"
+	defaultStartID      = "$"
+	defaultFailInterval = time.Second
+)
+
+// ReaderConfig 消费者配置，零值使用默认值
+type ReaderConfig struct {
+	// Stream 消费的stream
+	Stream string
+	// Group 消费者组，不存在时自动创建
+	Group string
+	// Consumer 消费者名称，同一组内唯一，默认 hostname-pid
+	Consumer string
+	// StartID 创建消费者组时的起始id，默认"$"只消费新消息，"0"从头消费
+	StartID string
+	// Count 每次读取的消息数量，默认10
+	Count int64
+	// Block 没有消息时阻塞等待的时间，默认2s
+	Block time.Duration
+	// MinIdle 未ACK的消息空闲超过MinIdle后被 XAUTOCLAIM 转移给当前消费者重新投递，默认1m，负数不转移
+	MinIdle time.Duration
+	// MaxDeliveries 最大投递次数，超过后写入死信stream并ACK，0不限制
+	MaxDeliveries int64
+	// DeadLetterStream 死信stream，默认 Stream+":dead"
+	DeadLetterStream string
+	// DeadLetterMaxLen 死信stream的最大长度，0不裁剪
+	DeadLetterMaxLen int64
+}
+
+func (c ReaderConfig) withDefaults() ReaderConfig {
+	if c.Consumer == "" {
+		c.Consumer = defaultConsumer()
+	}
+	if c.StartID == "" {
+		c.StartID = defaultStartID
+	}
+	if c.Count <= 0 {
+		c.Count = defaultCount
+	}
+	if c.Block <= 0 {
+		c.Block = defaultBlock
+	}
+	if c.MinIdle == 0 {
+		c.MinIdle = defaultMinIdle
+	}
+	if c.DeadLetterStream == "" {
+		c.DeadLetterStream = c.Stream + defaultDeadSuffix
+	}
+	return c
+}
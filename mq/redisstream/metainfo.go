@@ -0,0 +1,46 @@
+package redisstream
+
+import (
+	"context"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+)
+
+// metaInfoHeaders 将ctx中的metainfo（transient和persistent）和trace context转换成消息头
+func metaInfoHeaders(ctx context.Context) map[string]string {
+	m := make(map[string]string)
+	metainfo.SaveMetaInfoToMap(ctx, m)
+	metainfo.ToTraceHeader(ctx, metainfo.MapHeader(m))
+	return m
+}
+
+func injectHeaders(m map[string]string, msg *Message) {
+	if len(m) == 0 {
+		return
+	}
+
+	headers := make(map[string]string, len(msg.Headers)+len(m))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	for k, v := range m {
+		headers[k] = v
+	}
+	msg.Headers = headers
+}
+
+// InjectMetaInfo 将ctx中的metainfo（transient和persistent）和trace context写入消息头
+func InjectMetaInfo(ctx context.Context, msg *Message) {
+	injectHeaders(metaInfoHeaders(ctx), msg)
+}
+
+// ExtractMetaInfo 从消息头恢复metainfo和trace context到ctx，消费者作为下游调用TransferForward
+func ExtractMetaInfo(ctx context.Context, msg *Message) context.Context {
+	if msg == nil || len(msg.Headers) == 0 {
+		return ctx
+	}
+
+	ctx = metainfo.SetMetaInfoFromMap(ctx, msg.Headers)
+	ctx = metainfo.FromTraceHeader(ctx, metainfo.MapHeader(msg.Headers))
+	return metainfo.TransferForward(ctx)
+}
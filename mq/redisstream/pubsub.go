@@ -0,0 +1,56 @@
+package redisstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+type publisher struct {
+	w Writer
+}
+
+// NewPublisher 将Writer适配为mq.Publisher，消息的topic作为stream
+func NewPublisher(w Writer) mq.Publisher {
+	return &publisher{w: w}
+}
+
+func (p *publisher) Publish(ctx context.Context, msgs ...*mq.Message) error {
+	ms := make([]Message, len(msgs))
+	for i, m := range msgs {
+		ms[i] = Message{Stream: m.Topic, Key: m.Key, Body: m.Body, Headers: m.Headers}
+		if !m.Time.IsZero() {
+			ms[i].Time = m.Time.UnixNano()
+		}
+	}
+	return p.w.WriteMessages(ctx, ms)
+}
+
+func (p *publisher) Close() error {
+	return p.w.Close()
+}
+
+type subscriber struct {
+	r Reader
+}
+
+// NewSubscriber 将Reader适配为mq.Subscriber，handler失败的消息按Reader的配置重新投递或写入死信stream
+func NewSubscriber(r Reader) mq.Subscriber {
+	return &subscriber{r: r}
+}
+
+func (s *subscriber) Subscribe(ctx context.Context, h mq.Handler) error {
+	s.r.AddHook(func(ctx context.Context, m *Message) error {
+		msg := &mq.Message{Topic: m.Stream, Key: m.Key, Body: m.Body, Headers: m.Headers}
+		if m.Time > 0 {
+			msg.Time = time.Unix(0, m.Time)
+		}
+		return h(ctx, msg)
+	})
+	return s.r.Run(ctx)
+}
+
+func (s *subscriber) Close() error {
+	return s.r.Close()
+}
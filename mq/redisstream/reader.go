@@ -0,0 +1,336 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+	"github.com/aaabigfish/gopkg/log"
+)
+
+type Reader interface {
+	// FetchMessage 读取一条消息，消息处理完需要CommitMessages，否则空闲MinIdle后会被重新投递
+	FetchMessage(ctx context.Context) (*Message, error)
+	// CommitMessages ACK消息
+	CommitMessages(ctx context.Context, msgs ...*Message) error
+	GetClient() Client
+	AddHook(...HandlerFunc)
+	Do(ctx context.Context, m *Message) error
+	// Run 循环读取消息并依次执行hook，全部成功后ACK，直到ctx结束或Close
+	Run(ctx context.Context) error
+	Close() error
+}
+
+type reader struct {
+	client Client
+	c      ReaderConfig
+	hooks  []HandlerFunc
+
+	mu        sync.Mutex
+	created   bool
+	buf       []*Message
+	cursor    string
+	nextClaim time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewReader 创建消费者组的消费者，client由调用方管理，Close不会关闭client
+func NewReader(client Client, c ReaderConfig) Reader {
+	if c.Stream == "" || c.Group == "" {
+		panic("redisstream: stream and group should not be empty")
+	}
+	return &reader{
+		client: client,
+		c:      c.withDefaults(),
+		hooks:  make([]HandlerFunc, 0),
+		cursor: "0-0",
+		closed: make(chan struct{}),
+	}
+}
+
+func defaultConsumer() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (r *reader) GetClient() Client {
+	return r.client
+}
+
+func (r *reader) AddHook(hook ...HandlerFunc) {
+	r.hooks = append(r.hooks, hook...)
+}
+
+// ensureGroup 创建消费者组，已存在时忽略
+func (r *reader) ensureGroup(ctx context.Context) error {
+	if r.created {
+		return nil
+	}
+	err := r.client.XGroupCreateMkStream(ctx, r.c.Stream, r.c.Group, r.c.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	r.created = true
+	return nil
+}
+
+func (r *reader) FetchMessage(ctx context.Context) (*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(r.buf) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := r.ensureGroup(ctx); err != nil {
+			return nil, err
+		}
+		if err := r.fill(ctx); err != nil {
+			// stream或消费者组被删除后重新创建
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				r.created = false
+			}
+			return nil, err
+		}
+	}
+
+	m := r.buf[0]
+	r.buf = r.buf[1:]
+	return m, nil
+}
+
+// fill 先转移空闲的未ACK消息，没有时读取新消息
+func (r *reader) fill(ctx context.Context) error {
+	if r.c.MinIdle > 0 && !time.Now().Before(r.nextClaim) {
+		if err := r.reclaim(ctx); err != nil {
+			return err
+		}
+		if len(r.buf) > 0 {
+			return nil
+		}
+	}
+
+	streams, err := r.client.XReadGroup(ctx, &gredis.XReadGroupArgs{
+		Group:    r.c.Group,
+		Consumer: r.c.Consumer,
+		Streams:  []string{r.c.Stream, ">"},
+		Count:    r.c.Count,
+		Block:    r.c.Block,
+	}).Result()
+	if err == gredis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		for _, xm := range s.Messages {
+			r.buf = append(r.buf, newMessage(r.c.Stream, xm))
+		}
+	}
+	return nil
+}
+
+// reclaim 用 XAUTOCLAIM 转移空闲超过MinIdle的消息，超过MaxDeliveries的写入死信stream。
+// 每轮扫描完整个pending列表后等待MinIdle/2再开始下一轮
+func (r *reader) reclaim(ctx context.Context) error {
+	xms, next, err := r.client.XAutoClaim(ctx, &gredis.XAutoClaimArgs{
+		Stream:   r.c.Stream,
+		Group:    r.c.Group,
+		MinIdle:  r.c.MinIdle,
+		Start:    r.cursor,
+		Count:    r.c.Count,
+		Consumer: r.c.Consumer,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	r.cursor = next
+	if next == "0-0" {
+		r.nextClaim = time.Now().Add(r.c.MinIdle / 2)
+	}
+	if len(xms) == 0 {
+		return nil
+	}
+
+	deliveries, err := r.deliveries(ctx, xms)
+	if err != nil {
+		return err
+	}
+	for _, xm := range xms {
+		// 已被XDEL或裁剪的消息没有内容，直接ACK
+		if xm.Values == nil {
+			if err := r.client.XAck(ctx, r.c.Stream, r.c.Group, xm.ID).Err(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		m := newMessage(r.c.Stream, xm)
+		if n, ok := deliveries[xm.ID]; ok {
+			m.Deliveries = n
+		}
+		if r.c.MaxDeliveries > 0 && m.Deliveries > r.c.MaxDeliveries {
+			if err := r.deadLetter(ctx, m); err != nil {
+				return err
+			}
+			continue
+		}
+		r.buf = append(r.buf, m)
+	}
+	return nil
+}
+
+// deliveries 查询转移到当前消费者的消息的投递次数。
+// 按ID逐个查询，范围查询会被范围内其它未ACK的消息占用Count
+func (r *reader) deliveries(ctx context.Context, xms []gredis.XMessage) (map[string]int64, error) {
+	cmds := make([]*gredis.XPendingExtCmd, 0, len(xms))
+	_, err := r.client.Pipelined(ctx, func(p gredis.Pipeliner) error {
+		for _, xm := range xms {
+			cmds = append(cmds, p.XPendingExt(ctx, &gredis.XPendingExtArgs{
+				Stream:   r.c.Stream,
+				Group:    r.c.Group,
+				Start:    xm.ID,
+				End:      xm.ID,
+				Count:    1,
+				Consumer: r.c.Consumer,
+			}))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]int64, len(xms))
+	for _, cmd := range cmds {
+		for _, p := range cmd.Val() {
+			m[p.ID] = p.RetryCount
+		}
+	}
+	return m, nil
+}
+
+// deadLetter 将消息写入死信stream后ACK，消息头中记录原stream、id、消费者组和投递次数
+func (r *reader) deadLetter(ctx context.Context, m *Message) error {
+	dead := *m
+	dead.Stream = r.c.DeadLetterStream
+	dead.Headers = make(map[string]string, len(m.Headers)+4)
+	for k, v := range m.Headers {
+		dead.Headers[k] = v
+	}
+	dead.Headers[HeaderDeadStream] = m.Stream
+	dead.Headers[HeaderDeadID] = m.ID
+	dead.Headers[HeaderDeadGroup] = r.c.Group
+	dead.Headers[HeaderDeadDeliveries] = strconv.FormatInt(m.Deliveries, 10)
+
+	err := r.client.XAdd(ctx, &gredis.XAddArgs{
+		Stream: r.c.DeadLetterStream,
+		MaxLen: r.c.DeadLetterMaxLen,
+		Approx: true,
+		Values: dead.values(),
+	}).Err()
+	if err != nil {
+		return err
+	}
+	log.Warnf("redisstream: message(%s %s) delivered %d times, moved to %s",
+		m.Stream, m.ID, m.Deliveries, r.c.DeadLetterStream)
+	return r.client.XAck(ctx, r.c.Stream, r.c.Group, m.ID).Err()
+}
+
+func (r *reader) CommitMessages(ctx context.Context, msgs ...*Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	return r.client.XAck(ctx, r.c.Stream, r.c.Group, ids...).Err()
+}
+
+// Do 依次执行所有hook，消息头中的trace context会作为消费span的父span
+func (r *reader) Do(ctx context.Context, m *Message) error {
+	ctx, span := trace.Start(ExtractMetaInfo(ctx, m), "redisstream.receive",
+		trace.WithKind(trace.KindConsumer), trace.WithAttributes(
+			trace.String("messaging.system", "redis"),
+			trace.String("messaging.destination", m.Stream),
+			trace.String("messaging.message_id", m.ID),
+			trace.Int64("messaging.redis.deliveries", m.Deliveries),
+		))
+	defer span.End()
+
+	for _, hook := range r.hooks {
+		if err := hook(ctx, m); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run hook失败的消息不ACK，空闲MinIdle后重新投递，超过MaxDeliveries后写入死信stream。
+// 读取时最多阻塞Block，Close最多等待Block后返回
+func (r *reader) Run(ctx context.Context) error {
+	select {
+	case <-r.closed:
+		return errors.New("redisstream: reader is closed")
+	default:
+	}
+	r.wg.Add(1)
+	defer r.wg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		m, err := r.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Errorf("redisstream: fetch %s err(%v)", r.c.Stream, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(defaultFailInterval):
+			}
+			continue
+		}
+
+		if err := r.Do(ctx, m); err != nil {
+			log.Errorf("redisstream: handle message(%s %s) err(%v)", m.Stream, m.ID, err)
+			continue
+		}
+		if err := r.CommitMessages(ctx, m); err != nil {
+			log.Errorf("redisstream: ack message(%s %s) err(%v)", m.Stream, m.ID, err)
+		}
+	}
+}
+
+// Close 停止Run，未处理的消息会在空闲MinIdle后被重新投递
+func (r *reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+	r.wg.Wait()
+	return nil
+}
@@ -0,0 +1,217 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	gredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aaabigfish/gopkg/cloud/metainfo"
+	"github.com/aaabigfish/gopkg/mq"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, Client) {
+	s := miniredis.RunT(t)
+	c := gredis.NewClient(&gredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+func TestWriteAndFetch(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	r := NewReader(c, ReaderConfig{Stream: "orders", Group: "g", StartID: "0", Block: 10 * time.Millisecond})
+	defer r.Close()
+	// 创建消费者组
+	fctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err := r.FetchMessage(fctx)
+	cancel()
+	assert.Error(t, err)
+
+	w := NewWriter(c, WriterConfig{Stream: "orders", MaxLen: 2, ExactTrim: true})
+	id, err := w.Push(metainfo.WithPersistentValue(ctx, "trace_id", "t1"), []byte("a"), []byte("k1"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	m, err := r.FetchMessage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, id, m.ID)
+	assert.Equal(t, "orders", m.Stream)
+	assert.Equal(t, []byte("k1"), m.Key)
+	assert.Equal(t, []byte("a"), m.Body)
+	assert.True(t, m.Time > 0)
+	assert.Equal(t, int64(1), m.Deliveries)
+	v, _ := metainfo.GetPersistentValue(ExtractMetaInfo(ctx, m), "trace_id")
+	assert.Equal(t, "t1", v)
+	assert.NoError(t, r.CommitMessages(ctx, m))
+
+	assert.NoError(t, w.WriteMessages(ctx, []Message{{Body: []byte("b")}, {Body: []byte("c")}, {Body: []byte("d")}}))
+	n, err := c.XLen(ctx, "orders").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	assert.Error(t, NewWriter(c, WriterConfig{}).WriteMessage(ctx, Message{Body: []byte("x")}))
+}
+
+func TestReclaimAndDeadLetter(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+
+	r := NewReader(c, ReaderConfig{
+		Stream:        "jobs",
+		Group:         "g",
+		Consumer:      "c1",
+		StartID:       "0",
+		Block:         10 * time.Millisecond,
+		MinIdle:       time.Minute,
+		MaxDeliveries: 2,
+	})
+	defer r.Close()
+
+	w := NewWriter(c, WriterConfig{Stream: "jobs"})
+	assert.NoError(t, w.WriteMessage(ctx, Message{Key: []byte("k"), Body: []byte("job")}))
+
+	m, err := r.FetchMessage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), m.Deliveries)
+
+	// 未ACK，空闲超过MinIdle后被重新投递
+	now := time.Now()
+	s.SetTime(now.Add(2 * time.Minute))
+	r.(*reader).nextClaim = time.Time{}
+	m2, err := r.FetchMessage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m.ID, m2.ID)
+	assert.Equal(t, int64(2), m2.Deliveries)
+
+	// 超过MaxDeliveries写入死信stream并ACK
+	s.SetTime(now.Add(4 * time.Minute))
+	r.(*reader).nextClaim = time.Time{}
+	fctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = r.FetchMessage(fctx)
+	cancel()
+	assert.Error(t, err)
+
+	dead, err := c.XRange(ctx, "jobs:dead", "-", "+").Result()
+	assert.NoError(t, err)
+	if assert.Len(t, dead, 1) {
+		dm := newMessage("jobs:dead", dead[0])
+		assert.Equal(t, []byte("job"), dm.Body)
+		assert.Equal(t, []byte("k"), dm.Key)
+		assert.Equal(t, "jobs", dm.Headers[HeaderDeadStream])
+		assert.Equal(t, m.ID, dm.Headers[HeaderDeadID])
+		assert.Equal(t, "3", dm.Headers[HeaderDeadDeliveries])
+	}
+	pending, err := c.XPending(ctx, "jobs", "g").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestReclaimDeliveries(t *testing.T) {
+	s, c := newTestClient(t)
+	ctx := context.Background()
+
+	r := NewReader(c, ReaderConfig{Stream: "jobs", Group: "g", Consumer: "c1", StartID: "0", Block: 10 * time.Millisecond, MinIdle: time.Minute})
+	defer r.Close()
+	w := NewWriter(c, WriterConfig{Stream: "jobs"})
+	var ids []string
+	for _, body := range []string{"a", "b", "c"} {
+		id, err := w.Push(ctx, []byte(body), nil)
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	for range ids {
+		_, err := r.FetchMessage(ctx)
+		assert.NoError(t, err)
+	}
+
+	// b is pending on c1 but not idle, it is between the reclaimed a and c
+	now := time.Now()
+	s.SetTime(now.Add(2 * time.Minute))
+	assert.NoError(t, c.XClaim(ctx, &gredis.XClaimArgs{Stream: "jobs", Group: "g", Consumer: "c1", Messages: ids[1:2]}).Err())
+	r.(*reader).nextClaim = time.Time{}
+	for _, id := range []string{ids[0], ids[2]} {
+		m, err := r.FetchMessage(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, id, m.ID)
+		assert.Equal(t, int64(2), m.Deliveries)
+	}
+}
+
+func TestRun(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := context.Background()
+
+	r := NewReader(c, ReaderConfig{Stream: "events", Group: "g", StartID: "0", Block: 10 * time.Millisecond})
+	var mu sync.Mutex
+	var got []string
+	fail := true
+	r.AddHook(func(ctx context.Context, m *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(m.Body) == "bad" && fail {
+			fail = false
+			return errors.New("boom")
+		}
+		got = append(got, string(m.Body))
+		return nil
+	})
+
+	w := NewWriter(c, WriterConfig{Stream: "events"})
+	assert.NoError(t, w.WriteMessages(ctx, []Message{{Body: []byte("a")}, {Body: []byte("bad")}, {Body: []byte("b")}}))
+
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, r.Close())
+	assert.NoError(t, <-done)
+
+	mu.Lock()
+	assert.Equal(t, []string{"a", "b"}, got)
+	mu.Unlock()
+
+	// 失败的消息未ACK
+	pending, err := c.XPending(ctx, "events", "g").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count)
+	assert.Error(t, r.Run(ctx))
+}
+
+func TestPubSub(t *testing.T) {
+	_, c := newTestClient(t)
+	ctx := metainfo.WithPersistentValue(context.Background(), "trace_id", "t1")
+
+	sub := NewSubscriber(NewReader(c, ReaderConfig{Stream: "events", Group: "g", StartID: "0", Block: 10 * time.Millisecond}))
+	pub := NewPublisher(NewWriter(c, WriterConfig{Stream: "events"}))
+	now := time.Unix(100, 0)
+	assert.NoError(t, pub.Publish(ctx, &mq.Message{Key: []byte("k"), Body: []byte("a"), Time: now}))
+
+	got := make(chan *mq.Message, 1)
+	done := make(chan error)
+	go func() {
+		done <- sub.Subscribe(context.Background(), func(ctx context.Context, msg *mq.Message) error {
+			v, _ := metainfo.GetPersistentValue(ctx, "trace_id")
+			assert.Equal(t, "t1", v)
+			got <- msg
+			return nil
+		})
+	}()
+
+	msg := <-got
+	assert.Equal(t, "events", msg.Topic)
+	assert.Equal(t, []byte("k"), msg.Key)
+	assert.Equal(t, []byte("a"), msg.Body)
+	assert.True(t, now.Equal(msg.Time))
+	assert.NoError(t, sub.Close())
+	assert.NoError(t, <-done)
+}
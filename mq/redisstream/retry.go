@@ -0,0 +1,38 @@
+package redisstream
+
+import (
+	"context"
+
+	"github.com/aaabigfish/gopkg/cloud/retry"
+)
+
+type retryWriter struct {
+	Writer
+	r *retry.Retrier
+}
+
+// WithRetry 返回写入失败时按r重试的Writer。
+// XADD不是幂等的，写入成功但响应丢失时重试会写入重复的消息，消费者需要按Key去重
+func WithRetry(w Writer, r *retry.Retrier) Writer {
+	return &retryWriter{Writer: w, r: r}
+}
+
+func (w *retryWriter) WriteMessage(ctx context.Context, msg Message) error {
+	return w.WriteMessages(ctx, []Message{msg})
+}
+
+func (w *retryWriter) WriteMessages(ctx context.Context, msgs []Message) error {
+	return w.r.Do(ctx, func(ctx context.Context) error {
+		return w.Writer.WriteMessages(ctx, msgs)
+	})
+}
+
+func (w *retryWriter) Push(ctx context.Context, body []byte, key ...[]byte) (string, error) {
+	var id string
+	err := w.r.Do(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = w.Writer.Push(ctx, body, key...)
+		return err
+	})
+	return id, err
+}
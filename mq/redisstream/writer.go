@@ -0,0 +1,119 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	gredis "github.com/redis/go-redis/v9"
+
+	"github.com/aaabigfish/gopkg/cloud/trace"
+)
+
+type Writer interface {
+	WriteMessage(ctx context.Context, msg Message) error
+	WriteMessages(ctx context.Context, msgs []Message) error
+	// Push 写入body到默认stream，返回消息id
+	Push(ctx context.Context, body []byte, key ...[]byte) (string, error)
+	GetClient() Client
+	Close() error
+}
+
+type writer struct {
+	client Client
+	c      WriterConfig
+}
+
+// NewWriter 创建生产者，client由调用方管理，Close不会关闭client
+func NewWriter(client Client, c WriterConfig) Writer {
+	return &writer{client: client, c: c}
+}
+
+func (w *writer) GetClient() Client {
+	return w.client
+}
+
+func (w *writer) args(msg *Message) (*gredis.XAddArgs, error) {
+	stream := w.c.Stream
+	if msg.Stream != "" {
+		stream = msg.Stream
+	}
+	if stream == "" {
+		return nil, errors.New("stream is empty")
+	}
+	if msg.Time <= 0 {
+		msg.Time = time.Now().UnixNano()
+	}
+	return &gredis.XAddArgs{
+		Stream: stream,
+		MaxLen: w.c.MaxLen,
+		Approx: !w.c.ExactTrim,
+		Values: msg.values(),
+	}, nil
+}
+
+func (w *writer) Push(ctx context.Context, body []byte, key ...[]byte) (string, error) {
+	msg := Message{Body: body}
+	if len(key) > 0 {
+		msg.Key = key[0]
+	}
+
+	ctx, span := w.startSpan(ctx, w.c.Stream, 1)
+	defer span.End()
+
+	InjectMetaInfo(ctx, &msg)
+	args, err := w.args(&msg)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	id, err := w.client.XAdd(ctx, args).Result()
+	span.RecordError(err)
+	return id, err
+}
+
+// WriteMessage 写入消息，ctx中的metainfo和trace context会写入消息头
+func (w *writer) WriteMessage(ctx context.Context, msg Message) error {
+	return w.WriteMessages(ctx, []Message{msg})
+}
+
+// WriteMessages 用pipeline批量写入消息，ctx中的metainfo和trace context会写入每条消息的消息头
+func (w *writer) WriteMessages(ctx context.Context, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	stream := w.c.Stream
+	if msgs[0].Stream != "" {
+		stream = msgs[0].Stream
+	}
+	ctx, span := w.startSpan(ctx, stream, len(msgs))
+	defer span.End()
+
+	m := metaInfoHeaders(ctx)
+	pipe := w.client.Pipeline()
+	for i := range msgs {
+		msg := msgs[i]
+		injectHeaders(m, &msg)
+		args, err := w.args(&msg)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		pipe.XAdd(ctx, args)
+	}
+	_, err := pipe.Exec(ctx)
+	span.RecordError(err)
+	return err
+}
+
+func (w *writer) startSpan(ctx context.Context, stream string, n int) (context.Context, *trace.Span) {
+	return trace.Start(ctx, "redisstream.send", trace.WithKind(trace.KindProducer), trace.WithAttributes(
+		trace.String("messaging.system", "redis"),
+		trace.String("messaging.destination", stream),
+		trace.Int("messaging.batch.message_count", n),
+	))
+}
+
+func (w *writer) Close() error {
+	return nil
+}